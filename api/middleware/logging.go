@@ -1,32 +1,110 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
+// loggingWriter はハンドラーが書き込んだステータスコードとバイト数を記録する http.ResponseWriter
 type loggingWriter struct {
 	http.ResponseWriter
-	code int
+	code  int // WriteHeader も Write も呼ばれていない場合は 0
+	bytes int64
 }
 
 func newLoggingWriter(w http.ResponseWriter) *loggingWriter {
-	return &loggingWriter{ResponseWriter: w, code: http.StatusInternalServerError}
+	return &loggingWriter{ResponseWriter: w}
 }
 
 func (lw *loggingWriter) WriteHeader(code int) {
-	lw.code = code
+	if lw.code == 0 {
+		lw.code = code
+	}
 	lw.ResponseWriter.WriteHeader(code)
 }
 
+// Write は WriteHeader を呼ばずに書き込んだ場合、net/http と同じく 200 を送ったものとして記録する
+func (lw *loggingWriter) Write(b []byte) (int, error) {
+	if lw.code == 0 {
+		lw.code = http.StatusOK
+	}
+	n, err := lw.ResponseWriter.Write(b)
+	lw.bytes += int64(n)
+	return n, err
+}
+
+// Flush はエクスポートなどでレスポンスを少しずつ送り出せるように、元の ResponseWriter の Flush を呼び出す
+func (lw *loggingWriter) Flush() {
+	if lw.code == 0 {
+		lw.code = http.StatusOK
+	}
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap は http.ResponseController が元の ResponseWriter の機能を使えるように、元の ResponseWriter を返す
+func (lw *loggingWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// status は記録したステータスコードを返す。ハンドラーが何も書き込まなかった場合は net/http が返す 200
+func (lw *loggingWriter) status() int {
+	if lw.code == 0 {
+		return http.StatusOK
+	}
+	return lw.code
+}
+
+// LoggingMiddleware はリクエストごとに 1 行のアクセスログを slog.Default() に出力する
+// X-Request-ID ヘッダーのリクエストIDを引き継ぐか生成して、レスポンスのヘッダーと context に設定する（RequestIDFromContext で取得できる）
+// path にはルートのテンプレート（/singers/{id} など）を出力し、どのルートにも一致しなかった場合はリクエストのパスを出力する
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		log.Printf("uri: %s, method: %s\n", req.RequestURI, req.Method)
+		start := time.Now()
+		id := requestID(req.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, id)
+		ctx := WithRequestID(req.Context(), id)
+		req = req.WithContext(ctx)
+
+		path := req.URL.Path
+		if route := mux.CurrentRoute(req); route != nil {
+			if tmpl, err := route.GetPathTemplate(); err == nil {
+				path = tmpl
+			}
+		}
 
 		rlw := newLoggingWriter(w)
+		aborted := true
+		defer func() { // ハンドラーが panic した場合（エクスポートを途中で打ち切った場合など）も出力する
+			status := rlw.status()
+			level := slog.LevelInfo
+			if status >= 500 || aborted {
+				level = slog.LevelError
+			}
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("path", path),
+			}
+			// panic する前にステータスコードを送っていない場合は、net/http はレスポンスを返さずに接続を切るので status を出力しない
+			if !aborted || rlw.code != 0 {
+				attrs = append(attrs, slog.Int("status", status))
+			}
+			attrs = append(attrs,
+				slog.Int64("bytes", rlw.bytes),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("remote_addr", req.RemoteAddr),
+			)
+			if aborted {
+				attrs = append(attrs, slog.Bool("aborted", true))
+			}
+			slog.Default().LogAttrs(ctx, level, "request", attrs...)
+		}()
 
 		next.ServeHTTP(rlw, req)
-
-		log.Printf("response code: %d", rlw.code)
+		aborted = false
 	})
 }
@@ -0,0 +1,187 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"server-recruit-challenge-sample/api/middleware"
+)
+
+// captureLogs はテストの間 slog.Default() の出力を JSON で記録し、出力した行を返す関数を返す
+func captureLogs(t *testing.T) func() []map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(middleware.NewLogHandler(slog.NewJSONHandler(&buf, nil))))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return func() []map[string]any {
+		var entries []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var entry map[string]any
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("decode log %q: %v", line, err)
+			}
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+}
+
+// accessLog はアクセスログの 1 行だけを返す
+func accessLog(t *testing.T, logs func() []map[string]any) map[string]any {
+	t.Helper()
+	var found []map[string]any
+	for _, entry := range logs() {
+		if entry["msg"] == "request" {
+			found = append(found, entry)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("got %d access logs, want 1: %v", len(found), found)
+	}
+	return found[0]
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestLoggingStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		fn     http.HandlerFunc
+		status float64
+		bytes  float64
+		level  string
+	}{
+		{"write without WriteHeader", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") }, 200, 2, "INFO"},
+		{"no write", func(w http.ResponseWriter, r *http.Request) {}, 200, 0, "INFO"},
+		{"WriteHeader", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(404) }, 404, 0, "INFO"},
+		{"first WriteHeader wins", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(503); w.WriteHeader(200) }, 503, 0, "ERROR"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			serve(middleware.LoggingMiddleware(tc.fn), httptest.NewRequest("GET", "/singers", nil))
+			entry := accessLog(t, logs)
+			if entry["status"] != tc.status || entry["bytes"] != tc.bytes || entry["level"] != tc.level {
+				t.Fatalf("got status=%v bytes=%v level=%v, want %v %v %v", entry["status"], entry["bytes"], entry["level"], tc.status, tc.bytes, tc.level)
+			}
+			if _, ok := entry["aborted"]; ok {
+				t.Fatalf("completed request is logged as aborted: %v", entry)
+			}
+		})
+	}
+}
+
+func TestLoggingAbortedRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		fn     http.HandlerFunc
+		status any // nil の場合は status を出力しない
+	}{
+		{"before WriteHeader", func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) }, nil},
+		{"after Write", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "partial")
+			panic(http.ErrAbortHandler)
+		}, float64(200)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			func() {
+				defer func() {
+					if p := recover(); p != http.ErrAbortHandler {
+						t.Fatalf("panic was not propagated: got %v", p)
+					}
+				}()
+				serve(middleware.LoggingMiddleware(tc.fn), httptest.NewRequest("GET", "/export", nil))
+			}()
+			entry := accessLog(t, logs)
+			if entry["aborted"] != true || entry["level"] != "ERROR" || entry["status"] != tc.status {
+				t.Fatalf("got %v, want an aborted error log with status %v", entry, tc.status)
+			}
+		})
+	}
+}
+
+func TestLoggingRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	for _, tc := range []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"valid", "req-123_ABC.x", true},
+		{"missing", "", false},
+		{"contains a space", "req 123", false},
+		{"contains a control character", "req\x01", false},
+		{"non-ASCII", "リクエスト", false},
+		{"too long", strings.Repeat("a", 129), false},
+		{"max length", strings.Repeat("a", 128), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			var fromContext string
+			handler := middleware.LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = middleware.RequestIDFromContext(r.Context())
+				slog.InfoContext(r.Context(), "inside handler")
+			}))
+			r := httptest.NewRequest("GET", "/singers", nil)
+			if tc.header != "" {
+				r.Header.Set(middleware.RequestIDHeader, tc.header)
+			}
+			w := serve(handler, r)
+
+			id := w.Header().Get(middleware.RequestIDHeader)
+			if tc.keep && id != tc.header {
+				t.Fatalf("response header: got %q, want %q", id, tc.header)
+			}
+			if !tc.keep && !generated.MatchString(id) {
+				t.Fatalf("response header: got %q, want a generated id", id)
+			}
+			if fromContext != id {
+				t.Fatalf("context: got %q, want %q", fromContext, id)
+			}
+			// ハンドラーのログとアクセスログに同じリクエストIDが付く
+			for _, entry := range logs() {
+				if entry["request_id"] != id {
+					t.Fatalf("log %v: got request_id %v, want %q", entry["msg"], entry["request_id"], id)
+				}
+			}
+		})
+	}
+}
+
+func TestLoggingPathTemplate(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/singers/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	router.Use(middleware.LoggingMiddleware)
+	router.NotFoundHandler = middleware.LoggingMiddleware(http.NotFoundHandler())
+
+	for _, tc := range []struct {
+		target string
+		path   string
+	}{
+		{"/singers/42", "/singers/{id:[0-9]+}"},
+		{"/unknown/42", "/unknown/42"}, // どのルートにも一致しない場合はリクエストのパス
+	} {
+		logs := captureLogs(t)
+		serve(router, httptest.NewRequest("GET", tc.target, nil))
+		if got := accessLog(t, logs)["path"]; got != tc.path {
+			t.Fatalf("%s: got path %v, want %q", tc.target, got, tc.path)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+// RequestIDHeader はリクエストIDを受け渡すHTTPヘッダー
+// リクエストに含まれていればそれを引き継ぎ、含まれていなければ生成して、どちらの場合もレスポンスに付ける
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength は引き継ぐリクエストIDの最大の長さ（これより長い場合や使えない文字を含む場合は生成し直す）
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID はリクエストIDを持つ context を返す
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext は context のリクエストIDを返す。ない場合は空文字を返す
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestID はリクエストヘッダーの値を引き継げる場合はそのまま返し、引き継げない場合は新しいIDを生成する
+// ログに安全に書けるように、空白や制御文字を含まない ASCII の値だけを引き継ぐ
+func requestID(header string) string {
+	if header != "" && len(header) <= maxRequestIDLength {
+		valid := true
+		for i := 0; i < len(header); i++ {
+			if c := header[i]; c <= ' ' || c > '~' {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return header
+		}
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// contextHandler は context にリクエストIDがある場合に request_id の属性を加える slog.Handler
+type contextHandler struct {
+	slog.Handler
+}
+
+// NewLogHandler は h に書き込む前に、context のリクエストIDを request_id の属性として加える slog.Handler を返す
+// slog.InfoContext(r.Context(), ...) のように context を渡して出力したログは、アクセスログと同じリクエストIDで検索できる
+func NewLogHandler(h slog.Handler) slog.Handler {
+	return &contextHandler{Handler: h}
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -8,33 +8,80 @@ import (
 	"github.com/gorilla/mux"
 	"server-recruit-challenge-sample/api/middleware"
 	"server-recruit-challenge-sample/controller"
-	"server-recruit-challenge-sample/infra/memorydb"
+	"server-recruit-challenge-sample/repository"
 	"server-recruit-challenge-sample/service"
 )
 
+// Config はルーターを作成するときの設定
+type Config struct {
+	SingerRepository   repository.SingerRepository // 歌手データの保存先（infra/memorydb または infra/sqldb）
+	AlbumRepository    repository.AlbumRepository  // アルバムデータの保存先（infra/memorydb または infra/sqldb）
+	TrackRepository    repository.TrackRepository  // 曲データの保存先（infra/memorydb または infra/sqldb）
+	SearchRepository   repository.SearchRepository // 歌手とアルバムを全文検索する（保存先と同じ実装のもの）
+	Transactor         repository.Transactor       // 歌手とアルバムにまたがる操作を 1 つのトランザクションで実行する（保存先と同じ実装のもの）
+	SingerDeletePolicy service.SingerDeletePolicy  // アルバムが紐づいている歌手を削除するときの振る舞い
+}
+
 // 新しい mux.Router インスタンスを作成し、それに対して歌手に関するエンドポイントのハンドラーを設定
-func NewRouter() *mux.Router {
-	singerRepo := memorydb.NewSingerRepository() // infra/memorydb/singer.go ファイルの NewSingerRepository 関数を呼び出す
-	singerService := service.NewSingerService(singerRepo) // service/singer.go ファイルの NewSingerService 関数を呼び出す
+func NewRouter(cfg Config) *mux.Router {
+	singerRepo := cfg.SingerRepository // main.go で選択された歌手のリポジトリ
+	albumRepo := cfg.AlbumRepository // main.go で選択されたアルバムのリポジトリ
+
+	singerService := service.NewSingerService(singerRepo, albumRepo, cfg.Transactor, cfg.SingerDeletePolicy) // service/singer.go ファイルの NewSingerService 関数を呼び出す
 	singerController := controller.NewSingerController(singerService) // controller/singer.go ファイルの NewSingerController 関数を呼び出す
 
-	albumRepo := memorydb.NewAlbumRepository() // infra/memorydb/album.go ファイルの NewAlbumRepository 関数を呼び出す
-	albumService := service.NewAlbumService(albumRepo) // service/album.go ファイルの NewAlbumService 関数を呼び出す
+	albumService := service.NewAlbumService(albumRepo, singerRepo, cfg.Transactor) // service/album.go ファイルの NewAlbumService 関数を呼び出す（歌手の情報を付加するため singerRepo も渡す）
 	albumController := controller.NewAlbumController(albumService) // controller/album.go ファイルの NewAlbumController 関数を呼び出す
 
+	trackService := service.NewTrackService(cfg.TrackRepository, albumRepo, cfg.Transactor) // service/track.go ファイルの NewTrackService 関数を呼び出す（アルバムの存在を確認するため albumRepo も渡す）
+	trackController := controller.NewTrackController(trackService) // controller/track.go ファイルの NewTrackController 関数を呼び出す
+
+	searchService := service.NewSearchService(cfg.SearchRepository) // service/search.go ファイルの NewSearchService 関数を呼び出す
+	searchController := controller.NewSearchController(searchService) // controller/search.go ファイルの NewSearchController 関数を呼び出す
+
+	catalogService := service.NewCatalogService(singerService, albumService, singerRepo, albumRepo, cfg.Transactor) // service/catalog.go ファイルの NewCatalogService 関数を呼び出す（入力値の検証を個別の API と同じにするため singerService と albumService を渡す）
+	catalogController := controller.NewCatalogController(catalogService) // controller/catalog.go ファイルの NewCatalogController 関数を呼び出す
+
 	r := mux.NewRouter()
 
 	r.HandleFunc("/singers", singerController.GetSingerListHandler).Methods(http.MethodGet) // GET /singers のハンドラー
 	r.HandleFunc("/singers/{id:[0-9]+}", singerController.GetSingerDetailHandler).Methods(http.MethodGet) // GET /singers/{id} のハンドラー
 	r.HandleFunc("/singers", singerController.PostSingerHandler).Methods(http.MethodPost) // POST /singers のハンドラー
+	r.HandleFunc("/singers/{id:[0-9]+}", singerController.PutSingerHandler).Methods(http.MethodPut) // PUT /singers/{id} のハンドラー
+	r.HandleFunc("/singers/{id:[0-9]+}", singerController.PatchSingerHandler).Methods(http.MethodPatch) // PATCH /singers/{id} のハンドラー
 	r.HandleFunc("/singers/{id:[0-9]+}", singerController.DeleteSingerHandler).Methods(http.MethodDelete) // DELETE /singers/{id} のハンドラー
+	r.HandleFunc("/singers/{id:[0-9]+}:restore", singerController.RestoreSingerHandler).Methods(http.MethodPost) // POST /singers/{id}:restore のハンドラー
+	r.HandleFunc("/singers:batch", singerController.PostSingerBatchHandler).Methods(http.MethodPost) // POST /singers:batch のハンドラー
+	r.HandleFunc("/singers/{id:[0-9]+}/albums", albumController.GetSingerAlbumListHandler).Methods(http.MethodGet) // GET /singers/{id}/albums のハンドラー
 
 	r.HandleFunc("/albums", albumController.GetAlbumListHandler).Methods(http.MethodGet) // GET /albums のハンドラー
 	r.HandleFunc("/albums/{id:[0-9]+}", albumController.GetAlbumDetailHandler).Methods(http.MethodGet) // GET /albums/{id} のハンドラー
 	r.HandleFunc("/albums", albumController.PostAlbumHandler).Methods(http.MethodPost) // POST /albums のハンドラー
+	r.HandleFunc("/albums/{id:[0-9]+}", albumController.PutAlbumHandler).Methods(http.MethodPut) // PUT /albums/{id} のハンドラー
+	r.HandleFunc("/albums/{id:[0-9]+}", albumController.PatchAlbumHandler).Methods(http.MethodPatch) // PATCH /albums/{id} のハンドラー
 	r.HandleFunc("/albums/{id:[0-9]+}", albumController.DeleteAlbumHandler).Methods(http.MethodDelete) // DELETE /albums/{id} のハンドラー
+	r.HandleFunc("/albums/{id:[0-9]+}:restore", albumController.RestoreAlbumHandler).Methods(http.MethodPost) // POST /albums/{id}:restore のハンドラー
+
+	r.HandleFunc("/albums:batch", albumController.PostAlbumBatchHandler).Methods(http.MethodPost) // POST /albums:batch のハンドラー
+
+	r.HandleFunc("/albums/{id:[0-9]+}/tracks", trackController.GetTrackListHandler).Methods(http.MethodGet) // GET /albums/{id}/tracks のハンドラー
+	r.HandleFunc("/albums/{id:[0-9]+}/tracks/{track_id:[0-9]+}", trackController.GetTrackDetailHandler).Methods(http.MethodGet) // GET /albums/{id}/tracks/{track_id} のハンドラー
+	r.HandleFunc("/albums/{id:[0-9]+}/tracks", trackController.PostTrackHandler).Methods(http.MethodPost) // POST /albums/{id}/tracks のハンドラー
+	r.HandleFunc("/albums/{id:[0-9]+}/tracks/{track_id:[0-9]+}", trackController.PutTrackHandler).Methods(http.MethodPut) // PUT /albums/{id}/tracks/{track_id} のハンドラー
+	r.HandleFunc("/albums/{id:[0-9]+}/tracks/{track_id:[0-9]+}", trackController.PatchTrackHandler).Methods(http.MethodPatch) // PATCH /albums/{id}/tracks/{track_id} のハンドラー
+	r.HandleFunc("/albums/{id:[0-9]+}/tracks/{track_id:[0-9]+}", trackController.DeleteTrackHandler).Methods(http.MethodDelete) // DELETE /albums/{id}/tracks/{track_id} のハンドラー
+
+	r.HandleFunc("/search", searchController.GetSearchHandler).Methods(http.MethodGet) // GET /search のハンドラー
+
+	r.HandleFunc("/import", catalogController.PostImportHandler).Methods(http.MethodPost) // POST /import のハンドラー
+	r.HandleFunc("/export", catalogController.GetExportHandler).Methods(http.MethodGet) // GET /export のハンドラー
 
 	r.Use(middleware.LoggingMiddleware) // ログ出力用のミドルウェアを適用
+	// どのルートにも一致しなかったリクエストには r.Use のミドルウェアが適用されないので、アクセスログを出力するために個別に適用する
+	r.NotFoundHandler = middleware.LoggingMiddleware(http.NotFoundHandler())
+	r.MethodNotAllowedHandler = middleware.LoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
 
 	return r
 }
@@ -0,0 +1,107 @@
+// アプリケーション全体で共有するエラーの種類を定義するためのパッケージ
+// リポジトリやサービスはこのパッケージのエラーを返し、コントローラーが errors.Is / errors.As で HTTP ステータスコードに変換する
+
+package apperror // このファイルが apperror パッケージであることを示す
+
+import (
+	"errors"
+	"fmt"
+)
+
+// エラーの種類（Kind）を表すセンチネルエラー
+var (
+	ErrInvalidArgument = errors.New("invalid argument")    // クエリパラメータなどリクエストの指定が不正
+	ErrNotFound        = errors.New("not found")           // 対象のリソースが存在しない
+	ErrAlreadyExists   = errors.New("already exists")      // 同じリソースがすでに存在する
+	ErrConflict        = errors.New("conflict")            // 現在の状態と矛盾するため操作できない
+	ErrValidation      = errors.New("validation failed")   // 入力値が不正
+	ErrPrecondition    = errors.New("precondition failed") // 指定されたバージョンと現在のバージョンが一致しない
+)
+
+// 機械可読なエラーコード。レスポンスの code フィールドに入る値で、クライアントとの契約なので変更しないこと
+const (
+	CodeSingerNotFound          = "singer_not_found"
+	CodeAlbumNotFound           = "album_not_found"
+	CodeSingerAlreadyExists     = "singer_already_exists"
+	CodeAlbumAlreadyExists      = "album_already_exists"
+	CodeSingerInTrash           = "singer_in_trash"
+	CodeAlbumInTrash            = "album_in_trash"
+	CodeTrackNotFound           = "track_not_found"
+	CodeTrackAlreadyExists      = "track_already_exists"
+	CodeTrackNumberTaken        = "track_number_taken"
+	CodeSingerHasAlbums         = "singer_has_albums"
+	CodeSingerNameTaken         = "singer_name_taken"
+	CodeReferencedSingerMissing = "referenced_singer_not_found"
+	CodeImmutableField          = "immutable_field"
+	CodeInvalidPatch            = "invalid_patch"
+	CodeVersionMismatch         = "version_mismatch"
+	CodeInvalidCursor           = "invalid_cursor"
+	CodeInvalidSearchQuery      = "invalid_search_query"
+	CodeInvalidBatchOp          = "invalid_batch_operation"
+	CodeValidationFailed        = "validation_failed"
+)
+
+// Error は種類（Kind）と機械可読なコード（Code）を持つエラー
+type Error struct {
+	Kind       error       // ErrNotFound などのセンチネルエラー
+	Code       string      // 機械可読なエラーコード
+	Message    string      // 人が読むためのエラーメッセージ
+	Violations []Violation // 入力値の検証に失敗した項目（ErrValidation の場合のみ）
+}
+
+// Violation は入力値の検証に失敗した項目とその理由を表す
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap は errors.Is(err, apperror.ErrNotFound) のように種類で判定できるようにする
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// newError は指定された種類の Error を生成する
+func newError(kind error, code, format string, args ...any) *Error {
+	return &Error{Kind: kind, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// InvalidArgument はクエリパラメータなどリクエストの指定が不正であることを表すエラーを生成する
+func InvalidArgument(code, format string, args ...any) *Error {
+	return newError(ErrInvalidArgument, code, format, args...)
+}
+
+// NotFound は対象のリソースが存在しないことを表すエラーを生成する
+func NotFound(code, format string, args ...any) *Error {
+	return newError(ErrNotFound, code, format, args...)
+}
+
+// AlreadyExists は同じリソースがすでに存在することを表すエラーを生成する
+func AlreadyExists(code, format string, args ...any) *Error {
+	return newError(ErrAlreadyExists, code, format, args...)
+}
+
+// Conflict は現在の状態と矛盾するため操作できないことを表すエラーを生成する
+func Conflict(code, format string, args ...any) *Error {
+	return newError(ErrConflict, code, format, args...)
+}
+
+// Validation は入力値が不正であることを表すエラーを生成する
+func Validation(code, format string, args ...any) *Error {
+	return newError(ErrValidation, code, format, args...)
+}
+
+// ValidationFailed は入力値の検証に失敗した項目をまとめたエラーを生成する
+func ValidationFailed(violations []Violation) *Error {
+	e := newError(ErrValidation, CodeValidationFailed, "%d field(s) failed validation", len(violations))
+	e.Violations = violations
+	return e
+}
+
+// Precondition は指定されたバージョンと現在のバージョンが一致しないことを表すエラーを生成する
+func Precondition(code, format string, args ...any) *Error {
+	return newError(ErrPrecondition, code, format, args...)
+}
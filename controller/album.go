@@ -2,11 +2,13 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"server-recruit-challenge-sample/apperror"
 	"server-recruit-challenge-sample/model"
 	"server-recruit-challenge-sample/service"
 )
@@ -22,103 +24,244 @@ func NewAlbumController(s service.AlbumService) *albumController {
 }
 
 // GET /albums のハンドラー
-// GETリクエストを処理してアルバムリストを取得し、JSON形式でレスポンスを返す
+// GETリクエストを処理してアルバムリストを絞り込み（?singer_id=&title_contains=）・並び替え（?sort=title|-title|id|-id）・ページング（?limit=&cursor=）して取得し、
+// 歌手の情報を付加したJSON形式でレスポンスを返す
 func (c *albumController) GetAlbumListHandler(w http.ResponseWriter, r *http.Request) {
-	albums, err := c.service.GetAlbumListService(r.Context()) // service/album.go ファイルの GetAlbumListService メソッドを呼び出す
+	query, err := parseAlbumQuery(r) // クエリパラメータから絞り込み・並び替え・ページの指定を取得
 	if err != nil {
-		errorHandler(w, r, 500, err.Error())
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
 		return
 	}
+
+	albums, err := c.service.GetAlbumListService(r.Context(), query) // service/album.go ファイルの GetAlbumListService メソッドを呼び出す
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+	setNextLink(w, r, albums.NextCursor) // 次のページがある場合は Link ヘッダーで URL を返す
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(albums)
+	json.NewEncoder(w).Encode(albums.Items)
 }
 
 // GET /albums/{id} のハンドラー
-// GETリクエストを処理してアルバムを取得し、JSON形式でレスポンスを返す
+// GETリクエストを処理してアルバムを取得し、ETag ヘッダーを付けて、歌手の情報を付加したJSON形式でレスポンスを返す
 func (c *albumController) GetAlbumDetailHandler(w http.ResponseWriter, r *http.Request) {
 	albumID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータからアルバムIDを取得
 	if err != nil {
 		err = fmt.Errorf("invalid path param: %w", err)
-		errorHandler(w, r, 400, err.Error())
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
 		return
 	}
 
-
 	// service/album.go ファイルの GetAlbumService メソッドを呼び出す
 	album, err := c.service.GetAlbumService(r.Context(), model.AlbumID(albumID))
 	if err != nil {
-		errorHandler(w, r, 500, err.Error())
+		serviceErrorHandler(w, r, err)
 		return
 	}
 
-	// 歌手の情報を取得するための SingerService を取得
-	//singerService := service.NewSingerService(c.service.GetSingerRepository()) // GetSingerRepository は AlbumService に必要なメソッドと仮定しています
-
-	// AlbumRepository を直接取得
-	//albumRepo := c.service.GetAlbumRepository() // GetAlbumRepository は AlbumService に必要なメソッドと仮定しています
-
-	// 歌手の情報を取得
-	//singer, err := c.service.GetSingerService(r.Context(), album.SingerID)
-	//singer, err := singerService.GetSingerService(r.Context(), album.SingerID)
-	//singer, err := albumRepo.GetSinger(r.Context(), album.SingerID)
-	// if err != nil {
-	// 	errorHandler(w, r, 500, err.Error())
-	// 	return
-	// }
+	tag := albumETag(album) // 埋め込んだ歌手が変わった場合も If-None-Match と一致しないようにする
+	w.Header().Set("ETag", tag)
+	if notModified(r, tag) { // If-None-Match が現在の ETag と一致する場合は本文を返さない
+		w.WriteHeader(304)
+		return
+	}
 
-	// 歌手の情報を手動で指定 -> 成功
-	// 歌手情報を取得できれば成功しそう
-	singer := &model.Singer{ID: 1, Name: "Alice"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(album)
+}
 
-	albumWithSinger := struct {
-		*model.Album
-		Singer *model.Singer `json:"singer"`
-	}{
-		Album:  album,
-		Singer: singer,
+// GET /singers/{id}/albums のハンドラー
+// GETリクエストを処理して指定された歌手のアルバムリストを取得し、歌手の情報を付加したJSON形式でレスポンスを返す
+func (c *albumController) GetSingerAlbumListHandler(w http.ResponseWriter, r *http.Request) {
+	singerID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータから歌手IDを取得
+	if err != nil {
+		err = fmt.Errorf("invalid path param: %w", err)
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
 	}
 
+	// service/album.go ファイルの GetSingerAlbumListService メソッドを呼び出す
+	albums, err := c.service.GetSingerAlbumListService(r.Context(), model.SingerID(singerID))
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	//json.NewEncoder(w).Encode(album)
-	json.NewEncoder(w).Encode(albumWithSinger)
+	json.NewEncoder(w).Encode(albums)
 }
 
 // POST /albums のハンドラー
-// POSTリクエストを処理してアルバムを登録し、JSON形式でレスポンスを返す
+// POSTリクエストを処理してアルバムを登録し、201 Created と Location ヘッダー付きで、歌手の情報を付加したJSON形式でレスポンスを返す
+// id を省略した場合はサーバーが採番し、既存の id を指定した場合は 409 を返す
 func (c *albumController) PostAlbumHandler(w http.ResponseWriter, r *http.Request) {
 	var album *model.Album
 	if err := json.NewDecoder(r.Body).Decode(&album); err != nil { // リクエストボディからアルバムデータを取得
 		err = fmt.Errorf("invalid body param: %w", err) // リクエストボディが不正な場合はエラーを返す
-		errorHandler(w, r, 400, err.Error())
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
+		return
+	}
+
+	created, err := c.service.PostAlbumService(r.Context(), album) // service/album.go ファイルの PostAlbumService メソッドを呼び出す
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/albums/%d", created.ID)) // 作成されたリソースの URL
+	w.Header().Set("ETag", albumETag(created))
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(created)
+}
+
+// PUT /albums/{id} のハンドラー
+// PUTリクエストを処理してアルバムを置き換え、歌手の情報を付加したJSON形式でレスポンスを返す
+// If-Match ヘッダーがある場合はバージョンが一致するときだけ更新し、一致しない場合は 412 を返す
+// ボディの id は省略するか、URLパラメータの id と同じ値にする必要がある
+func (c *albumController) PutAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	albumID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータからアルバムIDを取得
+	if err != nil {
+		err = fmt.Errorf("invalid path param: %w", err)
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	var album model.Album
+	if err := json.NewDecoder(r.Body).Decode(&album); err != nil { // リクエストボディからアルバムデータを取得
+		err = fmt.Errorf("invalid body param: %w", err) // リクエストボディが不正な場合はエラーを返す
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
+		return
+	}
+	if album.ID != 0 && album.ID != model.AlbumID(albumID) {
+		errorHandler(w, r, 400, codeIDMismatch, "id in body does not match path")
+		return
+	}
+	album.ID = model.AlbumID(albumID)
+
+	album.Version, err = parseIfMatch(r) // If-Match ヘッダーから期待するバージョンを取得（ボディの version は使わない）
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidHeader, err.Error())
+		return
+	}
+
+	updated, err := c.service.PutAlbumService(r.Context(), &album) // service/album.go ファイルの PutAlbumService メソッドを呼び出す
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", albumETag(updated))
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(updated)
+}
+
+// PATCH /albums/{id} のハンドラー
+// PATCHリクエストを処理してアルバムを JSON Merge Patch（RFC 7396）で部分的に更新し、歌手の情報を付加したJSON形式でレスポンスを返す
+// If-Match ヘッダーがある場合はバージョンが一致するときだけ更新し、一致しない場合は 412 を返す
+func (c *albumController) PatchAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	albumID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータからアルバムIDを取得
+	if err != nil {
+		err = fmt.Errorf("invalid path param: %w", err)
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	version, err := parseIfMatch(r) // If-Match ヘッダーから期待するバージョンを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidHeader, err.Error())
+		return
+	}
+
+	patch, err := readMergePatch(r) // リクエストボディからパッチを取得
+	if err != nil {
+		err = fmt.Errorf("invalid body param: %w", err) // リクエストボディが不正な場合はエラーを返す
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
 		return
 	}
 
-	if err := c.service.PostAlbumService(r.Context(), album); err != nil { // service/album.go ファイルの PostAlbumService メソッドを呼び出す
-		errorHandler(w, r, 500, err.Error())
+	// service/album.go ファイルの PatchAlbumService メソッドを呼び出す
+	album, err := c.service.PatchAlbumService(r.Context(), model.AlbumID(albumID), version, func(a *model.Album) error {
+		return applyMergePatch(a, patch)
+	})
+	if err != nil {
+		serviceErrorHandler(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", albumETag(album))
 	w.WriteHeader(200)
 	json.NewEncoder(w).Encode(album)
 }
 
 // DELETE /albums/{id} のハンドラー
-// DELETEリクエストを処理してアルバムを削除する
+// DELETEリクエストを処理してアルバムをゴミ箱に移動する（If-Match ヘッダーがある場合はバージョンが一致するときだけ移動する）
+// アルバムが存在しない場合は 404 を返す。?idempotent=true を指定した場合は 204 を返す
 func (c *albumController) DeleteAlbumHandler(w http.ResponseWriter, r *http.Request) {
 	albumID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータから歌手IDを取得
 	if err != nil {
 		err = fmt.Errorf("invalid path param: %w", err)
-		errorHandler(w, r, 400, err.Error())
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	version, err := parseIfMatch(r) // If-Match ヘッダーから期待するバージョンを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidHeader, err.Error())
+		return
+	}
+
+	idempotent, err := parseDeleteQuery(r) // クエリパラメータから存在しない場合の扱いを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
 		return
 	}
 
 	// service/album.go ファイルの DeleteAlbumService メソッドを呼び出す
-	if err := c.service.DeleteAlbumService(r.Context(), model.AlbumID(albumID)); err != nil {
-		errorHandler(w, r, 500, err.Error())
+	if err := c.service.DeleteAlbumService(r.Context(), model.AlbumID(albumID), version); err != nil {
+		if idempotent && errors.Is(err, apperror.ErrNotFound) { // すでに存在しない場合も削除できたものとして扱う
+			w.WriteHeader(204)
+			return
+		}
+		serviceErrorHandler(w, r, err)
 		return
 	}
 	w.WriteHeader(204)
 }
+
+// POST /albums/{id}:restore のハンドラー
+// POSTリクエストを処理してゴミ箱のアルバムを元に戻し、ETag ヘッダーを付けて、歌手の情報を付加したJSON形式でレスポンスを返す
+// アルバムがゴミ箱に入っていない場合は 404 を、歌手がゴミ箱に入っている場合は 422 を返す
+func (c *albumController) RestoreAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	albumID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータからアルバムIDを取得
+	if err != nil {
+		err = fmt.Errorf("invalid path param: %w", err)
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	// service/album.go ファイルの RestoreAlbumService メソッドを呼び出す
+	album, err := c.service.RestoreAlbumService(r.Context(), model.AlbumID(albumID))
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", albumETag(album))
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(album)
+}
+
+// POST /albums:batch のハンドラー
+// POSTリクエストを処理してアルバムの追加（create）・置き換え（update）・削除（delete）をまとめて実行し、操作ごとのステータスコードと結果をJSON形式で返す
+// ?atomic=true の場合は 1 件でも失敗したらすべて取り消す
+func (c *albumController) PostAlbumBatchHandler(w http.ResponseWriter, r *http.Request) {
+	idOf := func(album *model.Album) int { return int(album.ID) }
+	handleBatch(w, r, idOf, c.service.BatchAlbumService) // service/album.go ファイルの BatchAlbumService メソッドを呼び出す
+}
@@ -0,0 +1,159 @@
+// 歌手とアルバムのバッチ処理（POST /singers:batch と POST /albums:batch）のリクエストとレスポンスを扱うためのファイル
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/service"
+)
+
+// maxBatchOperations は 1 回のバッチで実行できる操作の最大件数
+const maxBatchOperations = 100
+
+// codeBatchAborted は atomic のバッチでほかの操作が失敗したため、取り消した（または実行しなかった）操作のエラーコード
+const codeBatchAborted = "batch_aborted"
+
+// batchOperation はバッチのリクエストボディの 1 件の操作
+type batchOperation[T any] struct {
+	Op      service.BatchOp `json:"op"`      // create / update / delete
+	ID      int             `json:"id"`      // update と delete の対象のID
+	Version model.Version   `json:"version"` // update と delete で指定した場合は、現在のバージョンと一致するときだけ実行する（If-Match と同じ）
+	Value   *T              `json:"value"`   // create と update の内容（個別の POST・PUT のリクエストボディと同じ）
+}
+
+// batchResponse はバッチのレスポンスの本文
+type batchResponse struct {
+	Atomic    bool           `json:"atomic"`
+	Committed bool           `json:"committed"` // 変更を反映したか（atomic で失敗した操作がある場合は false）
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`  // 失敗した操作の数（atomic で取り消した操作は含まない）
+	Results   []*batchResult `json:"results"` // リクエストの操作の順
+}
+
+// batchResult は 1 件の操作の結果
+type batchResult struct {
+	Op     service.BatchOp `json:"op"`
+	ID     int             `json:"id,omitempty"`    // 操作したデータのID（atomic で取り消した create は採番したIDが使われないので返さない）
+	Status int             `json:"status"`          // 個別の API で実行した場合の HTTP ステータスコード（取り消した操作は 424）
+	Value  any             `json:"value,omitempty"` // create と update で書き込んだ内容
+	Error  *problem        `json:"error,omitempty"` // 失敗した理由（個別の API のエラーレスポンスと同じ形式）
+}
+
+// batchStatus は成功した操作の HTTP ステータスコード
+var batchStatus = map[service.BatchOp]int{service.BatchCreate: 201, service.BatchUpdate: 200, service.BatchDelete: 204}
+
+// handleBatch はバッチのリクエストを読み込んで run で実行し、操作ごとの結果をJSON形式で返す
+// リクエストボディは操作の配列で、?atomic=true の場合は 1 件でも失敗したらすべての操作を取り消して 422 を返す。省略した場合は成功した操作だけを反映して 200 を返す
+// 操作の形式が不正な場合（op が不正、value や id が足りないなど）は、何も実行せずに 400 を返す
+// atomic で取り消した操作は 424 にし、create の場合は id を返さない（取り消したので採番したIDは存在しない）
+// idOf は value に指定されたIDを返す（update で id と一致しているかを確認するため）。結果の value は個別の API のレスポンスと同じ形式（R）で返す
+func handleBatch[T, R any](w http.ResponseWriter, r *http.Request, idOf func(*T) int, run func(ctx context.Context, ops []*service.BatchOperation[T], atomic bool) ([]*service.BatchResult[R], error)) {
+	if err := checkQueryParams(r, "atomic"); err != nil {
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
+		return
+	}
+	atomic, err := parseBoolParam(r, "atomic")
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
+		return
+	}
+
+	var items []*batchOperation[T]
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil { // リクエストボディから操作の配列を取得
+		err = fmt.Errorf("invalid body param: %w", err)
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
+		return
+	}
+	ops, err := batchOperations(items, idOf)
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
+		return
+	}
+
+	results, err := run(r.Context(), ops, atomic)
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	res := &batchResponse{Atomic: atomic, Committed: true, Results: make([]*batchResult, len(results))}
+	failed := -1 // atomic で失敗した操作の位置
+	for i, result := range results {
+		item := &batchResult{Op: result.Op, ID: result.ID, Status: batchStatus[result.Op]}
+		switch {
+		case result.Err != nil:
+			item.Error = problemOf(r.Context(), result.Err)
+			item.Status = item.Error.Status
+			res.Failed++
+			failed = i
+		case !result.Aborted:
+			if result.Value != nil {
+				item.Value = result.Value
+			}
+			res.Succeeded++
+		}
+		res.Results[i] = item
+	}
+	statusCode := 200
+	if atomic && failed >= 0 {
+		for _, item := range res.Results {
+			if item.Error == nil {
+				item.Status = 424
+				item.Error = &problem{Title: http.StatusText(424), Status: 424, Code: codeBatchAborted, Message: fmt.Sprintf("not applied because operations[%d] failed", failed)}
+			}
+		}
+		res.Committed = false
+		statusCode = 422
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(res)
+}
+
+// batchOperations はリクエストボディの操作の形式を確認し、サービスに渡す操作に変換する
+func batchOperations[T any](items []*batchOperation[T], idOf func(*T) int) ([]*service.BatchOperation[T], error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("at least one operation is required")
+	}
+	if len(items) > maxBatchOperations {
+		return nil, fmt.Errorf("at most %d operations are allowed, got %d", maxBatchOperations, len(items))
+	}
+	ops := make([]*service.BatchOperation[T], len(items))
+	for i, item := range items {
+		if item == nil {
+			return nil, fmt.Errorf("operations[%d]: must be an object", i)
+		}
+		switch item.Op {
+		case service.BatchCreate:
+			if item.Value == nil {
+				return nil, fmt.Errorf("operations[%d]: value is required for create", i)
+			}
+			if item.ID != 0 || item.Version != 0 {
+				return nil, fmt.Errorf("operations[%d]: id and version are not allowed for create (set the id in value)", i)
+			}
+		case service.BatchUpdate:
+			if item.ID <= 0 || item.Value == nil {
+				return nil, fmt.Errorf("operations[%d]: id and value are required for update", i)
+			}
+			if id := idOf(item.Value); id != 0 && id != item.ID {
+				return nil, fmt.Errorf("operations[%d]: id in value does not match id", i)
+			}
+		case service.BatchDelete:
+			if item.ID <= 0 {
+				return nil, fmt.Errorf("operations[%d]: id is required for delete", i)
+			}
+			if item.Value != nil {
+				return nil, fmt.Errorf("operations[%d]: value is not allowed for delete", i)
+			}
+		default:
+			return nil, fmt.Errorf("operations[%d]: op must be %s, %s or %s", i, service.BatchCreate, service.BatchUpdate, service.BatchDelete)
+		}
+		ops[i] = &service.BatchOperation[T]{Op: item.Op, ID: item.ID, Version: item.Version, Value: item.Value}
+	}
+	return ops, nil
+}
@@ -0,0 +1,135 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"server-recruit-challenge-sample/controller"
+	"server-recruit-challenge-sample/infra/memorydb"
+	"server-recruit-challenge-sample/service"
+)
+
+// batchResponse は POST /singers:batch と POST /albums:batch のレスポンスの本文
+type batchResponse struct {
+	Committed bool `json:"committed"`
+	Succeeded int  `json:"succeeded"`
+	Failed    int  `json:"failed"`
+	Results   []struct {
+		ID     int             `json:"id"`
+		Status int             `json:"status"`
+		Value  json.RawMessage `json:"value"`
+		Error  *struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	} `json:"results"`
+}
+
+// postBatch は memorydb のリポジトリ（初期データの歌手 1〜5 とアルバム 1〜3 を持つ）でバッチのハンドラーを実行する
+func postBatch(t *testing.T, resource, query, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	singers, albums := memorydb.NewSingerRepository(), memorydb.NewAlbumRepository()
+	tx := memorydb.NewTransactor(singers, albums)
+	handler := controller.NewSingerController(service.NewSingerService(singers, albums, tx, service.SingerDeleteRestrict)).PostSingerBatchHandler
+	if resource == "albums" {
+		handler = controller.NewAlbumController(service.NewAlbumService(albums, singers, tx)).PostAlbumBatchHandler
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/"+resource+":batch"+query, strings.NewReader(body)))
+	return w
+}
+
+func decodeBatch(t *testing.T, w *httptest.ResponseRecorder) *batchResponse {
+	t.Helper()
+	var res batchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	return &res
+}
+
+func TestBatchStatuses(t *testing.T) {
+	w := postBatch(t, "singers", "", `[
+		{"op": "create", "value": {"name": "Frank"}},
+		{"op": "update", "id": 1, "value": {"name": "Alicia"}},
+		{"op": "update", "id": 99, "value": {"name": "Nobody"}},
+		{"op": "delete", "id": 2},
+		{"op": "delete", "id": 5}
+	]`)
+	if w.Code != 200 {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	res := decodeBatch(t, w)
+	if !res.Committed || res.Succeeded != 3 || res.Failed != 2 {
+		t.Fatalf("got %+v", res)
+	}
+	for i, want := range []int{201, 200, 404, 409, 204} {
+		if got := res.Results[i].Status; got != want {
+			t.Fatalf("results[%d].status: got %d, want %d", i, got, want)
+		}
+	}
+	if r := res.Results[0]; r.ID == 0 || len(r.Value) == 0 {
+		t.Fatalf("create: got id=%d value=%s", r.ID, r.Value)
+	}
+	if r := res.Results[4]; r.ID != 5 || len(r.Value) != 0 || r.Error != nil {
+		t.Fatalf("delete: got %+v", r)
+	}
+}
+
+func TestBatchAtomicAbort(t *testing.T) {
+	w := postBatch(t, "albums", "?atomic=true", `[
+		{"op": "create", "value": {"title": "New", "singer_id": 1}},
+		{"op": "delete", "id": 99},
+		{"op": "update", "id": 1, "value": {"title": "Renamed", "singer_id": 1}}
+	]`)
+	if w.Code != 422 {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	res := decodeBatch(t, w)
+	if res.Committed || res.Succeeded != 0 || res.Failed != 1 {
+		t.Fatalf("got %+v", res)
+	}
+	for i, want := range []struct {
+		status int
+		code   string
+		id     int
+	}{
+		{424, "batch_aborted", 0}, // 取り消した create は id を返さない
+		{404, "album_not_found", 99},
+		{424, "batch_aborted", 1},
+	} {
+		r := res.Results[i]
+		if r.Status != want.status || r.Error == nil || r.Error.Code != want.code || r.ID != want.id || len(r.Value) != 0 {
+			t.Fatalf("results[%d]: got %+v, want %+v", i, r, want)
+		}
+	}
+}
+
+func TestBatchRejectsMalformedOperations(t *testing.T) {
+	tooMany := "[" + strings.Repeat(`{"op": "delete", "id": 1},`, 100) + `{"op": "delete", "id": 1}]`
+	for _, tc := range []struct {
+		name, query, body string
+	}{
+		{"not an array", "", `{"op": "delete", "id": 1}`},
+		{"empty", "", `[]`},
+		{"too many", "", tooMany},
+		{"null operation", "", `[null]`},
+		{"unknown op", "", `[{"op": "merge", "id": 1}]`},
+		{"create without value", "", `[{"op": "create"}]`},
+		{"create with id", "", `[{"op": "create", "id": 1, "value": {"name": "X"}}]`},
+		{"update without id", "", `[{"op": "update", "value": {"name": "X"}}]`},
+		{"update with another id in value", "", `[{"op": "update", "id": 1, "value": {"id": 2, "name": "X"}}]`},
+		{"delete with value", "", `[{"op": "delete", "id": 1, "value": {"name": "X"}}]`},
+		{"invalid atomic", "?atomic=maybe", `[{"op": "delete", "id": 1}]`},
+		{"unknown query param", "?dry_run=true", `[{"op": "delete", "id": 1}]`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := postBatch(t, "singers", tc.query, tc.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("got %d: %s", w.Code, w.Body)
+			}
+		})
+	}
+}
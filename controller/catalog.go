@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/service"
+)
+
+// maxImportBody はインポートのリクエストボディの最大バイト数
+const maxImportBody = 32 << 20
+
+// exportFlushEvery はエクスポートでレスポンスをクライアントに送り出す間隔（件数）
+const exportFlushEvery = 100
+
+// catalogController 構造体は、service.CatalogService インターフェースを持ち、カタログのインポート・エクスポートのHTTPリクエストを処理
+type catalogController struct {
+	service service.CatalogService
+}
+
+// NewCatalogController 関数：catalogController インスタンスを作成して返す
+func NewCatalogController(s service.CatalogService) *catalogController {
+	return &catalogController{service: s}
+}
+
+// importReport は POST /import のレスポンスの本文
+type importReport struct {
+	DryRun    bool            `json:"dry_run"`
+	Atomic    bool            `json:"atomic"`
+	Committed bool            `json:"committed"` // 変更を反映したか
+	Total     int             `json:"total"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Results   []*importResult `json:"results"` // 入力の行の順
+}
+
+// importResult は 1 行の結果
+type importResult struct {
+	Line   int                     `json:"line"`
+	Type   model.CatalogRecordType `json:"type,omitempty"`
+	ID     int                     `json:"id,omitempty"`
+	Result service.ImportAction    `json:"result"`          // created / updated / failed / skipped
+	Error  *problem                `json:"error,omitempty"` // 失敗した理由（個別の API のエラーレスポンスと同じ形式）
+}
+
+// POST /import のハンドラー
+// NDJSON（Content-Type: application/x-ndjson）または CSV（Content-Type: text/csv）の歌手とアルバムを 1 行ずつ追加または置き換え、行ごとの結果をJSON形式で返す
+// id が既存のものと一致する行は置き換え、それ以外の行は追加する。アルバムが参照する歌手は、それより前の行か既存のデータにある必要がある
+// ?dry_run=true の場合は結果を返すだけで変更は反映しない
+// ?atomic=true の場合は 1 行でも失敗したらすべての行を反映せず 422 を返す。省略した場合は成功した行だけを反映して 200 を返す
+func (c *catalogController) PostImportHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkQueryParams(r, "dry_run", "atomic"); err != nil {
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
+		return
+	}
+	var opts service.ImportOptions
+	var err error
+	if opts.DryRun, err = parseBoolParam(r, "dry_run"); err != nil {
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
+		return
+	}
+	if opts.Atomic, err = parseBoolParam(r, "atomic"); err != nil {
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
+		return
+	}
+
+	var read func(io.Reader) ([]*service.ImportRow, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson":
+		read = readNDJSON
+	case "text/csv":
+		read = readCSV
+	default:
+		errorHandler(w, r, 415, codeUnsupportedMedia, "content type must be application/x-ndjson or text/csv")
+		return
+	}
+	rows, err := read(http.MaxBytesReader(w, r.Body, maxImportBody)) // リクエストボディから行ごとのデータを取得
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			errorHandler(w, r, 413, codeBodyTooLarge, fmt.Sprintf("request body must be at most %d bytes", maxImportBody))
+			return
+		}
+		err = fmt.Errorf("invalid body param: %w", err)
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
+		return
+	}
+
+	report, err := c.service.ImportCatalogService(r.Context(), rows, opts) // service/catalog.go ファイルの ImportCatalogService メソッドを呼び出す
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	res := &importReport{DryRun: opts.DryRun, Atomic: opts.Atomic, Committed: report.Committed, Total: len(rows), Succeeded: report.Succeeded, Failed: report.Failed, Results: make([]*importResult, len(report.Results))}
+	for i, result := range report.Results {
+		res.Results[i] = &importResult{Line: result.Line, Type: result.Type, ID: result.ID, Result: result.Action}
+		if result.Err != nil {
+			res.Results[i].Error = problemOf(r.Context(), result.Err)
+		}
+	}
+	statusCode := 200
+	if opts.Atomic && report.Failed > 0 {
+		statusCode = 422
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(res)
+}
+
+// GET /export のハンドラー
+// ゴミ箱に入っていない歌手とアルバムをすべて、NDJSON（?format=ndjson、省略時）または CSV（?format=csv）で返す
+// 歌手をすべて書き出してからアルバムを書き出すので、レスポンスをそのまま POST /import に渡せる
+// カタログ全体をメモリに保持せず、少しずつ読み出しながらレスポンスに書き込む
+func (c *catalogController) GetExportHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkQueryParams(r, "format"); err != nil {
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
+		return
+	}
+	format := r.URL.Query().Get("format")
+	var contentType string
+	switch format {
+	case "", formatNDJSON:
+		format, contentType = formatNDJSON, "application/x-ndjson"
+	case formatCSV:
+		contentType = "text/csv; charset=utf-8"
+	default:
+		errorHandler(w, r, 400, codeInvalidQueryParam, fmt.Sprintf("unknown format: %s (allowed: %s, %s)", format, formatNDJSON, formatCSV))
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	csvWriter := csv.NewWriter(w)
+	started := false
+	start := func() { // 最初のデータを読み出せた時点でヘッダーを送る（それまでに失敗した場合はエラーレスポンスを返せる）
+		started = true
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="catalog.%s"`, format))
+		w.WriteHeader(200)
+		if format == formatCSV {
+			csvWriter.Write(csvColumns)
+		}
+	}
+	count := 0
+	emit := func(record *model.CatalogRecord) error {
+		if !started {
+			start()
+		}
+		var err error
+		if format == formatCSV {
+			err = writeCSVRecord(csvWriter, record)
+		} else {
+			err = writeNDJSON(w, record)
+		}
+		if err != nil {
+			return err
+		}
+		if count++; count%exportFlushEvery == 0 {
+			return flush(csvWriter, flusher)
+		}
+		return nil
+	}
+
+	err := c.service.ExportCatalogService(r.Context(), emit) // service/catalog.go ファイルの ExportCatalogService メソッドを呼び出す
+	if err != nil && !started {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+	if !started { // 空のカタログでもヘッダー（CSV の場合はヘッダー行）は返す
+		start()
+	}
+	if err == nil {
+		err = flush(csvWriter, flusher)
+	}
+	if err != nil {
+		// ステータスコードはすでに送っているので、接続を切ってクライアントにレスポンスが途中で終わったことを伝える
+		slog.ErrorContext(r.Context(), "export aborted", "records", count, "error", err.Error())
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// flush は CSV のバッファとレスポンスをクライアントに送り出す
+func flush(csvWriter *csv.Writer, flusher http.Flusher) error {
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
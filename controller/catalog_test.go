@@ -0,0 +1,120 @@
+package controller_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"server-recruit-challenge-sample/controller"
+	"server-recruit-challenge-sample/infra/memorydb"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+	"server-recruit-challenge-sample/service"
+)
+
+// catalogFixture は memorydb のリポジトリ（初期データの歌手 1〜5 とアルバム 1〜3 を持つ）と、それを使うカタログのコントローラー
+type catalogFixture struct {
+	singers    repository.SingerRepository
+	albums     repository.AlbumRepository
+	controller interface {
+		PostImportHandler(http.ResponseWriter, *http.Request)
+		GetExportHandler(http.ResponseWriter, *http.Request)
+	}
+}
+
+func newCatalogFixture() *catalogFixture {
+	singers, albums := memorydb.NewSingerRepository(), memorydb.NewAlbumRepository()
+	tx := memorydb.NewTransactor(singers, albums)
+	singerService := service.NewSingerService(singers, albums, tx, service.SingerDeleteRestrict)
+	albumService := service.NewAlbumService(albums, singers, tx)
+	catalogService := service.NewCatalogService(singerService, albumService, singers, albums, tx)
+	return &catalogFixture{singers: singers, albums: albums, controller: controller.NewCatalogController(catalogService)}
+}
+
+// dump はバージョンを除いたすべての歌手とアルバムを文字列にする（2 つのカタログの内容を API から見える形で比べるため）
+func (f *catalogFixture) dump(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+	singers, err := f.singers.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	albums, err := f.albums.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, singer := range singers {
+		singer.Version = 0
+		fmt.Fprintf(&buf, "%+v\n", *singer)
+	}
+	for _, album := range albums {
+		album.Version = 0
+		album.Credits = album.CreditList() // 初期データのようにクレジットを省略したアルバムは、サービスを通して書き込むと SingerID の歌手が primary として登録される
+		fmt.Fprintf(&buf, "%+v\n", *album)
+	}
+	return buf.String()
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		format      string
+		contentType string
+	}{
+		{"ndjson", "application/x-ndjson"},
+		{"csv", "text/csv"},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			ctx := context.Background()
+			src := newCatalogFixture()
+			if err := src.singers.Add(ctx, &model.Singer{Name: "浜田, \"Frank\"", NameKana: "はまだ", NameRomaji: "Hamada"}); err != nil {
+				t.Fatal(err)
+			}
+			duet := &model.Album{Title: "Duet, Vol. 1", SingerID: 1, ReleaseDate: "2024-01-02", Genres: []string{"pop", "rock"}, Credits: []model.Credit{
+				{SingerID: 1, Role: model.CreditPrimary},
+				{SingerID: 6, Role: model.CreditFeatured},
+			}}
+			if err := src.albums.Add(ctx, duet); err != nil {
+				t.Fatal(err)
+			}
+			if err := src.albums.Update(ctx, &model.Album{ID: 2, Title: "Orphan", SingerID: 2}); err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			src.controller.GetExportHandler(w, httptest.NewRequest("GET", "/export?format="+tc.format, nil))
+			if w.Code != 200 {
+				t.Fatalf("export: got %d: %s", w.Code, w.Body)
+			}
+			exported := w.Body.Bytes()
+
+			dst := newCatalogFixture()
+			r := httptest.NewRequest("POST", "/import?atomic=true", bytes.NewReader(exported))
+			r.Header.Set("Content-Type", tc.contentType)
+			w = httptest.NewRecorder()
+			dst.controller.PostImportHandler(w, r)
+			if w.Code != 200 {
+				t.Fatalf("import: got %d: %s", w.Code, w.Body)
+			}
+			var report struct {
+				Committed bool `json:"committed"`
+				Total     int  `json:"total"`
+				Failed    int  `json:"failed"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			if !report.Committed || report.Total != 10 || report.Failed != 0 {
+				t.Fatalf("import report: got %+v", report)
+			}
+
+			if got, want := dst.dump(t), src.dump(t); got != want {
+				t.Fatalf("imported catalog differs from the exported one\ngot:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
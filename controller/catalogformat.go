@@ -0,0 +1,247 @@
+// カタログのインポート・エクスポートで使う NDJSON と CSV の形式を読み書きするためのファイル
+
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/service"
+)
+
+// カタログの形式
+const (
+	formatNDJSON = "ndjson" // 1 行に 1 件の JSON。歌手とアルバムの項目は個別の API の JSON と同じで、"type" に種類を入れる
+	formatCSV    = "csv"    // 1 行目がヘッダーの CSV。csvColumns の列を持つ
+)
+
+// csvColumns は CSV の列。歌手の行ではアルバムの列を、アルバムの行では歌手の列を空にする
+// genres はセミコロン区切り、credits は "歌手ID:役割" のセミコロン区切り（例: "1:primary;2:featured"）
+// セミコロンを含むジャンルは CSV では表せないので、NDJSON を使うこと
+var csvColumns = []string{"type", "id", "name", "name_kana", "name_romaji", "title", "singer_id", "release_date", "genres", "credits"}
+
+// maxNDJSONLine は NDJSON の 1 行の最大バイト数
+const maxNDJSONLine = 1 << 20
+
+// ndjsonSinger と ndjsonAlbum は NDJSON の 1 行。歌手とアルバムの項目に "type" を加えたもの
+type ndjsonSinger struct {
+	Type model.CatalogRecordType `json:"type"`
+	*model.Singer
+}
+
+type ndjsonAlbum struct {
+	Type model.CatalogRecordType `json:"type"`
+	*model.Album
+}
+
+// invalidRow は読み込めなかった行のエラーを返す（行ごとの結果として 422 で報告する）
+func invalidRow(format string, args ...any) error {
+	return apperror.Validation(codeInvalidImportRow, format, args...)
+}
+
+// readNDJSON は NDJSON を読み込み、行ごとのデータを返す。空行は無視する
+// 行の内容が不正な場合はその行の ParseErr に設定し、本文そのものを読めない場合だけエラーを返す
+func readNDJSON(body io.Reader) ([]*service.ImportRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLine)
+	var rows []*service.ImportRow
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		record, err := decodeNDJSONRecord(data)
+		rows = append(rows, &service.ImportRow{Line: line, Record: record, ParseErr: err})
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("line %d is longer than %d bytes", line+1, maxNDJSONLine)
+		}
+		return nil, err
+	}
+	return rows, nil
+}
+
+// decodeNDJSONRecord は NDJSON の 1 行を読み込む
+func decodeNDJSONRecord(data []byte) (*model.CatalogRecord, error) {
+	var head struct {
+		Type model.CatalogRecordType `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, invalidRow("invalid json: %v", err)
+	}
+	switch head.Type {
+	case model.CatalogSinger:
+		v := ndjsonSinger{Singer: &model.Singer{}}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, invalidRow("invalid singer: %v", err)
+		}
+		return &model.CatalogRecord{Type: model.CatalogSinger, Singer: v.Singer}, nil
+	case model.CatalogAlbum:
+		v := ndjsonAlbum{Album: &model.Album{}}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, invalidRow("invalid album: %v", err)
+		}
+		return &model.CatalogRecord{Type: model.CatalogAlbum, Album: v.Album}, nil
+	}
+	return nil, invalidRow("type must be %s or %s", model.CatalogSinger, model.CatalogAlbum)
+}
+
+// writeNDJSON は 1 件のデータを NDJSON の 1 行として書き込む
+func writeNDJSON(w io.Writer, record *model.CatalogRecord) error {
+	var v any = ndjsonSinger{Type: record.Type, Singer: record.Singer}
+	if record.Type == model.CatalogAlbum {
+		v = ndjsonAlbum{Type: record.Type, Album: record.Album}
+	}
+	return json.NewEncoder(w).Encode(v) // Encode は末尾に改行を付ける
+}
+
+// readCSV は 1 行目がヘッダーの CSV を読み込み、行ごとのデータを返す
+// ヘッダーには csvColumns のうち type を含む任意の列を任意の順で指定でき、省略した列は空として扱う
+// 列の数が合わない行や値が不正な行はその行の ParseErr に設定し、ヘッダーが不正な場合や CSV として読めない場合はエラーを返す
+func readCSV(body io.Reader) ([]*service.ImportRow, error) {
+	reader := csv.NewReader(body)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")) // 表計算ソフトが付ける BOM は無視する
+		if !contains(csvColumns, name) {
+			return nil, fmt.Errorf("unknown csv column: %q (allowed: %s)", name, strings.Join(csvColumns, ", "))
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("csv column %q must not be repeated", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["type"]; !ok {
+		return nil, fmt.Errorf("csv header must have a type column")
+	}
+
+	var rows []*service.ImportRow
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil { // 列の数が合わない行も読み込みは続けられる
+			rows = append(rows, &service.ImportRow{Line: line, ParseErr: invalidRow("expected %d fields, got %d", len(header), len(fields))})
+			continue
+		}
+		get := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+		record, err := decodeCSVRecord(get)
+		rows = append(rows, &service.ImportRow{Line: line, Record: record, ParseErr: err})
+	}
+}
+
+// decodeCSVRecord は CSV の 1 行を読み込む。get は列の名前から値を返す
+func decodeCSVRecord(get func(name string) string) (*model.CatalogRecord, error) {
+	id, err := csvInt(get, "id")
+	if err != nil {
+		return nil, err
+	}
+	switch model.CatalogRecordType(get("type")) {
+	case model.CatalogSinger:
+		singer := &model.Singer{ID: model.SingerID(id), Name: get("name"), NameKana: get("name_kana"), NameRomaji: get("name_romaji")}
+		return &model.CatalogRecord{Type: model.CatalogSinger, Singer: singer}, nil
+	case model.CatalogAlbum:
+		singerID, err := csvInt(get, "singer_id")
+		if err != nil {
+			return nil, err
+		}
+		album := &model.Album{ID: model.AlbumID(id), Title: get("title"), SingerID: model.SingerID(singerID), ReleaseDate: get("release_date")}
+		if s := get("genres"); s != "" {
+			album.Genres = strings.Split(s, ";")
+		}
+		if album.Credits, err = parseCSVCredits(get("credits")); err != nil {
+			return nil, err
+		}
+		return &model.CatalogRecord{Type: model.CatalogAlbum, Album: album}, nil
+	}
+	return nil, invalidRow("type must be %s or %s", model.CatalogSinger, model.CatalogAlbum)
+}
+
+// csvInt は整数の列を読み込む。空の場合は 0 を返す
+func csvInt(get func(name string) string, name string) (int, error) {
+	s := get(name)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, invalidRow("%s must be an integer: %q", name, s)
+	}
+	return n, nil
+}
+
+// parseCSVCredits は "歌手ID:役割" のセミコロン区切りのクレジットを読み込む
+func parseCSVCredits(s string) ([]model.Credit, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var credits []model.Credit
+	for _, item := range strings.Split(s, ";") {
+		id, role, ok := strings.Cut(strings.TrimSpace(item), ":")
+		singerID, err := strconv.Atoi(id)
+		if !ok || err != nil {
+			return nil, invalidRow("credits must be singer_id:role separated by semicolons: %q", item)
+		}
+		credits = append(credits, model.Credit{SingerID: model.SingerID(singerID), Role: model.CreditRole(role)})
+	}
+	return credits, nil
+}
+
+// writeCSVRecord は 1 件のデータを csvColumns の順で CSV の 1 行として書き込む
+func writeCSVRecord(w *csv.Writer, record *model.CatalogRecord) error {
+	fields := make([]string, len(csvColumns))
+	fields[0] = string(record.Type)
+	switch record.Type {
+	case model.CatalogSinger:
+		s := record.Singer
+		fields[1], fields[2], fields[3], fields[4] = strconv.Itoa(int(s.ID)), s.Name, s.NameKana, s.NameRomaji
+	case model.CatalogAlbum:
+		a := record.Album
+		credits := make([]string, len(a.Credits))
+		for i, c := range a.Credits {
+			credits[i] = fmt.Sprintf("%d:%s", c.SingerID, c.Role)
+		}
+		fields[1], fields[5], fields[6], fields[7] = strconv.Itoa(int(a.ID)), a.Title, strconv.Itoa(int(a.SingerID)), a.ReleaseDate
+		fields[8], fields[9] = strings.Join(a.Genres, ";"), strings.Join(credits, ";")
+	}
+	return w.Write(fields)
+}
+
+// contains は values に value が含まれているかを返す
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
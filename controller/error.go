@@ -3,24 +3,85 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+
+	"server-recruit-challenge-sample/apperror"
+)
+
+// リクエストの形式に問題がある場合など、コントローラー自身が返すエラーのコード
+const (
+	codeInvalidPathParam  = "invalid_path_param"
+	codeInvalidBodyParam  = "invalid_body_param"
+	codeInvalidQueryParam = "invalid_query_param"
+	codeIDMismatch        = "id_mismatch"
+	codeInvalidHeader     = "invalid_header"
+	codeUnsupportedMedia  = "unsupported_media_type"
+	codeBodyTooLarge      = "body_too_large"
+	codeInvalidImportRow  = "invalid_import_row"
+	codeInternal          = "internal_error"
 )
 
+// エラーレスポンスの本文（RFC 9457 の problem details 形式）
+// type は省略しているため "about:blank" として扱われ、title は HTTP ステータスの説明になる
+type problem struct {
+	Title      string               `json:"title"`
+	Status     int                  `json:"status"`
+	Code       string               `json:"code"`                 // 機械可読なエラーコード
+	Message    string               `json:"message"`              // エラーメッセージ
+	Violations []apperror.Violation `json:"violations,omitempty"` // 入力値の検証に失敗した項目
+}
+
 // エラーが発生したときのレスポンス処理をここで行う
 // w http.ResponseWriter：HTTPレスポンスを書き込むための構造体
 // r *http.Request：HTTPリクエストを表す構造体
 // statusCode int：HTTPステータスコード
+// code string：機械可読なエラーコード
 // message string：エラーメッセージ
-func errorHandler(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
-	log.Printf("error: %s\n", message) // エラーをログに出力する
+func errorHandler(w http.ResponseWriter, r *http.Request, statusCode int, code string, message string) {
+	writeProblem(w, r, &problem{Status: statusCode, Code: code, Message: message})
+}
 
-	type ErrorMessage struct { // エラーメッセージをJSON形式で返す
-		Message string `json:"message"`
+// writeProblem はエラーをログに出力し、problem details 形式の JSON でレスポンスを返す
+func writeProblem(w http.ResponseWriter, r *http.Request, p *problem) {
+	slog.InfoContext(r.Context(), "error response", "status", p.Status, "code", p.Code, "message", p.Message) // エラーをログに出力する（リクエストIDはアクセスログと同じ）
+
+	p.Title = http.StatusText(p.Status)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// サービスから返されたエラーを apperror の種類に応じた HTTP ステータスコードに変換してレスポンスを返す
+// apperror 以外のエラーは内部エラーとして 500 を返し、詳細はログにのみ出力する
+func serviceErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, r, problemOf(r.Context(), err))
+}
+
+// problemOf はサービスから返されたエラーを problem details に変換する（インポートの行ごとの結果にも使う）
+// apperror 以外のエラーは内部エラーとして 500 にし、詳細はログにのみ出力する
+func problemOf(ctx context.Context, err error) *problem {
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) {
+		slog.ErrorContext(ctx, "internal error", "error", err.Error())
+		return &problem{Title: http.StatusText(500), Status: 500, Code: codeInternal, Message: "internal server error"}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(&ErrorMessage{Message: message})
+	statusCode := 500
+	switch {
+	case errors.Is(err, apperror.ErrInvalidArgument):
+		statusCode = 400
+	case errors.Is(err, apperror.ErrNotFound):
+		statusCode = 404
+	case errors.Is(err, apperror.ErrAlreadyExists), errors.Is(err, apperror.ErrConflict):
+		statusCode = 409
+	case errors.Is(err, apperror.ErrValidation):
+		statusCode = 422
+	case errors.Is(err, apperror.ErrPrecondition):
+		statusCode = 412
+	}
+	return &problem{Title: http.StatusText(statusCode), Status: statusCode, Code: appErr.Code, Message: appErr.Message, Violations: appErr.Violations}
 }
@@ -0,0 +1,75 @@
+// ETag / If-Match / If-None-Match による楽観的排他制御と条件付きリクエストを扱うためのファイル
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server-recruit-challenge-sample/model"
+)
+
+// etag はバージョンから ETag ヘッダーの値（例: "3"）を生成する
+func etag(version model.Version) string {
+	return strconv.Quote(strconv.Itoa(int(version)))
+}
+
+// albumETag は歌手の情報を付加したアルバムの ETag ヘッダーの値（例: "3-5f1c2a9e"）を生成する
+// アルバムのバージョンに、クレジットされた歌手の ID とバージョンのハッシュを付け加えるので、歌手が更新・削除された場合も ETag が変わる
+func albumETag(album *model.AlbumWithSinger) string {
+	h := fnv.New32a()
+	for _, c := range album.Credits {
+		var version model.Version // 歌手が見つからない（削除された）場合は 0
+		if c.Singer != nil {
+			version = c.Singer.Version
+		}
+		fmt.Fprintf(h, "%d:%d;", c.SingerID, version)
+	}
+	return strconv.Quote(fmt.Sprintf("%d-%08x", album.Version, h.Sum32()))
+}
+
+// parseIfMatch は If-Match ヘッダーから期待するバージョンを取得する
+// ヘッダーがない場合や "*" の場合は 0（バージョンを確認しない）を返す
+// albumETag の ETag はアルバム自体のバージョン（"-" より前）だけを比較する（歌手が更新されてもアルバムは更新できる）
+// 弱い ETag（W/"3"）は If-Match では比較できない（RFC 9110 13.1.1）ため、一致しないものとして扱う
+func parseIfMatch(r *http.Request) (model.Version, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	if strings.Contains(header, ",") {
+		return 0, errors.New("multiple entity tags in If-Match are not supported")
+	}
+	if strings.HasPrefix(header, "W/") {
+		return -1, nil // どのバージョンとも一致しない
+	}
+	unquoted, err := strconv.Unquote(header)
+	if err != nil {
+		return 0, fmt.Errorf("malformed If-Match: %w", err)
+	}
+	unquoted, _, _ = strings.Cut(unquoted, "-")
+	version, err := strconv.Atoi(unquoted)
+	if err != nil || version <= 0 {
+		return -1, nil // このサーバーが発行していない ETag はどのバージョンとも一致しない
+	}
+	return model.Version(version), nil
+}
+
+// notModified は If-None-Match ヘッダーが現在の ETag と一致するかを弱い比較で判定する
+func notModified(r *http.Request, current string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+// PATCH リクエストで使う JSON Merge Patch（RFC 7396）の処理を提供するためのファイル
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"server-recruit-challenge-sample/apperror"
+)
+
+// readMergePatch はリクエストボディから JSON Merge Patch を読み込む
+// パッチはオブジェクトである必要があるため、それ以外の JSON の場合はエラーを返す
+func readMergePatch(r *http.Request) (map[string]any, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var patch any
+	if err := decodeJSON(body, &patch); err != nil {
+		return nil, err
+	}
+	obj, ok := patch.(map[string]any)
+	if !ok {
+		return nil, errors.New("merge patch must be a JSON object")
+	}
+	return obj, nil
+}
+
+// applyMergePatch は v（構造体へのポインタ）に RFC 7396 の手順でパッチを適用する
+// v を一度 JSON に変換してからパッチをマージし、その結果を v に書き戻す
+func applyMergePatch(v any, patch map[string]any) error {
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var target any
+	if err := decodeJSON(doc, &target); err != nil {
+		return err
+	}
+
+	merged, err := json.Marshal(mergeValue(target, patch))
+	if err != nil {
+		return err
+	}
+	// null で削除されたメンバーがゼロ値になるように、書き戻す前に v をゼロ値にしておく
+	rv := reflect.ValueOf(v).Elem()
+	rv.Set(reflect.Zero(rv.Type()))
+	if err := json.Unmarshal(merged, v); err != nil { // 型が合わない値（"name": 1 など）はここでエラーになる
+		return apperror.Validation(apperror.CodeInvalidPatch, "invalid merge patch: %s", err.Error())
+	}
+	return nil
+}
+
+// mergeValue は RFC 7396 の MergePatch 関数の実装
+// パッチがオブジェクトでない場合はパッチの値で置き換え、null のメンバーは削除する
+func mergeValue(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = make(map[string]any, len(patchObj))
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergeValue(targetObj[k], v)
+	}
+	return targetObj
+}
+
+// decodeJSON は数値の精度を失わないように json.Number を使って JSON を読み込む
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after JSON value")
+	}
+	return nil
+}
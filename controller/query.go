@@ -0,0 +1,183 @@
+// 一覧取得 API のクエリパラメータ（絞り込み・並び替え・ページング）を扱うためのファイル
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+const (
+	defaultPageLimit = 20  // limit を省略した場合の件数
+	maxPageLimit     = 100 // limit に指定できる最大の件数
+)
+
+// parsePageRequest はクエリパラメータ limit と cursor からページの指定を取得する
+func parsePageRequest(r *http.Request) (repository.PageRequest, error) {
+	query := r.URL.Query()
+	page := repository.PageRequest{Limit: defaultPageLimit, Cursor: query.Get("cursor")}
+
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return page, fmt.Errorf("limit must be an integer between 1 and %d", maxPageLimit)
+		}
+		page.Limit = limit
+	}
+	return page, nil
+}
+
+// parseSingerQuery は GET /singers のクエリパラメータ（name_prefix, include_deleted, sort, limit, cursor）から一覧取得の条件を取得する
+func parseSingerQuery(r *http.Request) (repository.SingerQuery, error) {
+	var query repository.SingerQuery
+	if err := checkQueryParams(r, "name_prefix", "include_deleted", "sort", "limit", "cursor"); err != nil {
+		return query, err
+	}
+
+	var err error
+	query.NamePrefix = r.URL.Query().Get("name_prefix")
+	if query.IncludeDeleted, err = parseBoolParam(r, "include_deleted"); err != nil {
+		return query, err
+	}
+	if query.Sort, err = parseSort(r, repository.SortFieldID, repository.SortFieldName); err != nil {
+		return query, err
+	}
+	if query.Page, err = parsePageRequest(r); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// parseAlbumQuery は GET /albums のクエリパラメータ（singer_id, title_contains, include_deleted, sort, limit, cursor）から一覧取得の条件を取得する
+func parseAlbumQuery(r *http.Request) (repository.AlbumQuery, error) {
+	var query repository.AlbumQuery
+	if err := checkQueryParams(r, "singer_id", "title_contains", "include_deleted", "sort", "limit", "cursor"); err != nil {
+		return query, err
+	}
+
+	if s := r.URL.Query().Get("singer_id"); s != "" {
+		singerID, err := strconv.Atoi(s)
+		if err != nil || singerID < 1 {
+			return query, fmt.Errorf("singer_id must be a positive integer")
+		}
+		query.SingerID = model.SingerID(singerID)
+	}
+
+	var err error
+	query.TitleContains = r.URL.Query().Get("title_contains")
+	if query.IncludeDeleted, err = parseBoolParam(r, "include_deleted"); err != nil {
+		return query, err
+	}
+	if query.Sort, err = parseSort(r, repository.SortFieldID, repository.SortFieldTitle); err != nil {
+		return query, err
+	}
+	if query.Page, err = parsePageRequest(r); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// parseSearchQuery は GET /search のクエリパラメータ（q, type, limit）から検索の条件を取得する
+// type はカンマ区切りで複数指定でき（例: "singer,album"）、省略した場合はすべての種類を検索する
+func parseSearchQuery(r *http.Request) (repository.SearchQuery, error) {
+	query := repository.SearchQuery{Limit: defaultPageLimit}
+	if err := checkQueryParams(r, "q", "type", "limit"); err != nil {
+		return query, err
+	}
+
+	query.Text = strings.TrimSpace(r.URL.Query().Get("q"))
+	if query.Text == "" {
+		return query, fmt.Errorf("q is required")
+	}
+	if s := r.URL.Query().Get("type"); s != "" {
+		for _, t := range strings.Split(s, ",") {
+			switch typ := model.SearchType(t); typ {
+			case model.SearchTypeSinger, model.SearchTypeAlbum:
+				query.Types = append(query.Types, typ)
+			default:
+				return query, fmt.Errorf("unknown type: %s (allowed: %s, %s)", t, model.SearchTypeSinger, model.SearchTypeAlbum)
+			}
+		}
+	}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		return query, err
+	}
+	query.Limit = page.Limit
+	return query, nil
+}
+
+// parseDeleteQuery は DELETE のクエリパラメータ（idempotent）を取得する
+// idempotent=true の場合は、存在しないリソースの削除も成功（204）として扱う
+func parseDeleteQuery(r *http.Request) (idempotent bool, err error) {
+	if err := checkQueryParams(r, "idempotent"); err != nil {
+		return false, err
+	}
+	return parseBoolParam(r, "idempotent")
+}
+
+// parseBoolParam は true / false を指定するクエリパラメータを取得する。省略した場合は false を返す
+func parseBoolParam(r *http.Request, name string) (bool, error) {
+	switch r.URL.Query().Get(name) {
+	case "", "false":
+		return false, nil
+	case "true":
+		return true, nil
+	}
+	return false, fmt.Errorf("%s must be true or false", name)
+}
+
+// checkQueryParams は allowed 以外のクエリパラメータが指定されていないか、同じパラメータが複数回指定されていないかを確認する
+func checkQueryParams(r *http.Request, allowed ...string) error {
+	for name, values := range r.URL.Query() {
+		known := false
+		for _, a := range allowed {
+			if name == a {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown query param: %s (allowed: %s)", name, strings.Join(allowed, ", "))
+		}
+		if len(values) > 1 {
+			return fmt.Errorf("query param %s must not be repeated", name)
+		}
+	}
+	return nil
+}
+
+// parseSort はクエリパラメータ sort（例: "title", "-title"）から並び順を取得する
+// 先頭に "-" を付けると降順になり、allowed 以外の項目を指定した場合はエラーを返す
+func parseSort(r *http.Request, allowed ...string) (repository.Sort, error) {
+	value := r.URL.Query().Get("sort")
+	if value == "" {
+		return repository.Sort{Field: repository.SortFieldID}, nil
+	}
+
+	sort := repository.Sort{Field: strings.TrimPrefix(value, "-"), Desc: strings.HasPrefix(value, "-")}
+	for _, a := range allowed {
+		if sort.Field == a {
+			return sort, nil
+		}
+	}
+	return sort, fmt.Errorf("unknown sort field: %s (allowed: %s)", sort.Field, strings.Join(allowed, ", "))
+}
+
+// setNextLink は次のページがある場合に Link ヘッダー（rel="next"）を設定する
+// 次のページの URL は今回のリクエストのクエリパラメータを引き継ぎ、cursor だけを置き換える
+func setNextLink(w http.ResponseWriter, r *http.Request, nextCursor string) {
+	if nextCursor == "" {
+		return
+	}
+	query := r.URL.Query()
+	query.Set("cursor", nextCursor)
+	next := *r.URL
+	next.RawQuery = query.Encode()
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+}
@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"server-recruit-challenge-sample/service"
+)
+
+// searchController 構造体は、service.SearchService インターフェースを持ち、全文検索のHTTPリクエストを処理
+type searchController struct {
+	service service.SearchService
+}
+
+// NewSearchController 関数：searchController インスタンスを作成して返す
+func NewSearchController(s service.SearchService) *searchController {
+	return &searchController{service: s}
+}
+
+// GET /search のハンドラー
+// GETリクエストを処理して歌手の名前とアルバムのタイトルを検索語（?q=）で検索し、種類（?type=singer|album）と件数（?limit=）を指定して、
+// 一致の度合いが大きい順にJSON形式でレスポンスを返す
+func (c *searchController) GetSearchHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseSearchQuery(r) // クエリパラメータから検索語・種類・件数を取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
+		return
+	}
+
+	hits, err := c.service.GetSearchResultService(r.Context(), query) // service/search.go ファイルの GetSearchResultService メソッドを呼び出す
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(hits)
+}
@@ -2,11 +2,13 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"server-recruit-challenge-sample/apperror"
 	"server-recruit-challenge-sample/model"
 	"server-recruit-challenge-sample/service"
 )
@@ -22,32 +24,46 @@ func NewSingerController(s service.SingerService) *singerController {
 }
 
 // GET /singers のハンドラー
-// GETリクエストを処理して歌手リストを取得し、JSON形式でレスポンスを返す
+// GETリクエストを処理して歌手リストを絞り込み（?name_prefix=）・並び替え（?sort=name|-name|id|-id）・ページング（?limit=&cursor=）して取得し、JSON形式でレスポンスを返す
 func (c *singerController) GetSingerListHandler(w http.ResponseWriter, r *http.Request) {
-	singers, err := c.service.GetSingerListService(r.Context()) // service/singer.go ファイルの GetSingerListService メソッドを呼び出す
+	query, err := parseSingerQuery(r) // クエリパラメータから絞り込み・並び替え・ページの指定を取得
 	if err != nil {
-		errorHandler(w, r, 500, err.Error())
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
 		return
 	}
+
+	singers, err := c.service.GetSingerListService(r.Context(), query) // service/singer.go ファイルの GetSingerListService メソッドを呼び出す
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+	setNextLink(w, r, singers.NextCursor) // 次のページがある場合は Link ヘッダーで URL を返す
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(singers)
+	json.NewEncoder(w).Encode(singers.Items)
 }
 
 // GET /singers/{id} のハンドラー
-// GETリクエストを処理して歌手を取得し、JSON形式でレスポンスを返す
+// GETリクエストを処理して歌手を取得し、ETag ヘッダーを付けて、JSON形式でレスポンスを返す
 func (c *singerController) GetSingerDetailHandler(w http.ResponseWriter, r *http.Request) {
 	singerID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータから歌手IDを取得
 	if err != nil {
 		err = fmt.Errorf("invalid path param: %w", err)
-		errorHandler(w, r, 400, err.Error())
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
 		return
 	}
 
 	// service/singer.go ファイルの GetSingerService メソッドを呼び出す
 	singer, err := c.service.GetSingerService(r.Context(), model.SingerID(singerID))
 	if err != nil {
-		errorHandler(w, r, 500, err.Error())
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	tag := etag(singer.Version)
+	w.Header().Set("ETag", tag)
+	if notModified(r, tag) { // If-None-Match が現在の ETag と一致する場合は本文を返さない
+		w.WriteHeader(304)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -56,39 +72,171 @@ func (c *singerController) GetSingerDetailHandler(w http.ResponseWriter, r *http
 }
 
 // POST /singers のハンドラー
-// POSTリクエストを処理して歌手を登録し、JSON形式でレスポンスを返す
+// POSTリクエストを処理して歌手を登録し、201 Created と Location ヘッダー付きのJSON形式でレスポンスを返す
+// id を省略した場合はサーバーが採番し、既存の id を指定した場合は 409 を返す
 func (c *singerController) PostSingerHandler(w http.ResponseWriter, r *http.Request) {
 	var singer *model.Singer
 	if err := json.NewDecoder(r.Body).Decode(&singer); err != nil { // リクエストボディから歌手データを取得
 		err = fmt.Errorf("invalid body param: %w", err) // リクエストボディが不正な場合はエラーを返す
-		errorHandler(w, r, 400, err.Error())
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
 		return
 	}
 
 	if err := c.service.PostSingerService(r.Context(), singer); err != nil { // service/singer.go ファイルの PostSingerService メソッドを呼び出す
-		errorHandler(w, r, 500, err.Error())
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/singers/%d", singer.ID)) // 作成されたリソースの URL
+	w.Header().Set("ETag", etag(singer.Version))
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(singer)
+}
+
+// PUT /singers/{id} のハンドラー
+// PUTリクエストを処理して歌手を置き換え、JSON形式でレスポンスを返す
+// If-Match ヘッダーがある場合はバージョンが一致するときだけ更新し、一致しない場合は 412 を返す
+// ボディの id は省略するか、URLパラメータの id と同じ値にする必要がある
+func (c *singerController) PutSingerHandler(w http.ResponseWriter, r *http.Request) {
+	singerID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータから歌手IDを取得
+	if err != nil {
+		err = fmt.Errorf("invalid path param: %w", err)
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	var singer model.Singer
+	if err := json.NewDecoder(r.Body).Decode(&singer); err != nil { // リクエストボディから歌手データを取得
+		err = fmt.Errorf("invalid body param: %w", err) // リクエストボディが不正な場合はエラーを返す
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
+		return
+	}
+	if singer.ID != 0 && singer.ID != model.SingerID(singerID) {
+		errorHandler(w, r, 400, codeIDMismatch, "id in body does not match path")
+		return
+	}
+	singer.ID = model.SingerID(singerID)
+
+	singer.Version, err = parseIfMatch(r) // If-Match ヘッダーから期待するバージョンを取得（ボディの version は使わない）
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidHeader, err.Error())
+		return
+	}
+
+	if err := c.service.PutSingerService(r.Context(), &singer); err != nil { // service/singer.go ファイルの PutSingerService メソッドを呼び出す
+		serviceErrorHandler(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(singer.Version))
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(&singer)
+}
+
+// PATCH /singers/{id} のハンドラー
+// PATCHリクエストを処理して歌手を JSON Merge Patch（RFC 7396）で部分的に更新し、JSON形式でレスポンスを返す
+// If-Match ヘッダーがある場合はバージョンが一致するときだけ更新し、一致しない場合は 412 を返す
+func (c *singerController) PatchSingerHandler(w http.ResponseWriter, r *http.Request) {
+	singerID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータから歌手IDを取得
+	if err != nil {
+		err = fmt.Errorf("invalid path param: %w", err)
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	version, err := parseIfMatch(r) // If-Match ヘッダーから期待するバージョンを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidHeader, err.Error())
+		return
+	}
+
+	patch, err := readMergePatch(r) // リクエストボディからパッチを取得
+	if err != nil {
+		err = fmt.Errorf("invalid body param: %w", err) // リクエストボディが不正な場合はエラーを返す
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
+		return
+	}
+
+	// service/singer.go ファイルの PatchSingerService メソッドを呼び出す
+	singer, err := c.service.PatchSingerService(r.Context(), model.SingerID(singerID), version, func(s *model.Singer) error {
+		return applyMergePatch(s, patch)
+	})
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(singer.Version))
 	w.WriteHeader(200)
 	json.NewEncoder(w).Encode(singer)
 }
 
 // DELETE /singers/{id} のハンドラー
-// DELETEリクエストを処理して歌手を削除する
+// DELETEリクエストを処理して歌手をゴミ箱に移動する（If-Match ヘッダーがある場合はバージョンが一致するときだけ移動する）
+// 歌手が存在しない場合は 404 を返す。?idempotent=true を指定した場合は 204 を返す
 func (c *singerController) DeleteSingerHandler(w http.ResponseWriter, r *http.Request) {
 	singerID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータから歌手IDを取得
 	if err != nil {
 		err = fmt.Errorf("invalid path param: %w", err)
-		errorHandler(w, r, 400, err.Error())
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	version, err := parseIfMatch(r) // If-Match ヘッダーから期待するバージョンを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidHeader, err.Error())
+		return
+	}
+
+	idempotent, err := parseDeleteQuery(r) // クエリパラメータから存在しない場合の扱いを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
 		return
 	}
 
 	// service/singer.go ファイルの DeleteSingerService メソッドを呼び出す
-	if err := c.service.DeleteSingerService(r.Context(), model.SingerID(singerID)); err != nil {
-		errorHandler(w, r, 500, err.Error())
+	if err := c.service.DeleteSingerService(r.Context(), model.SingerID(singerID), version); err != nil {
+		if idempotent && errors.Is(err, apperror.ErrNotFound) { // すでに存在しない場合も削除できたものとして扱う
+			w.WriteHeader(204)
+			return
+		}
+		serviceErrorHandler(w, r, err)
 		return
 	}
 	w.WriteHeader(204)
 }
+
+// POST /singers/{id}:restore のハンドラー
+// POSTリクエストを処理してゴミ箱の歌手を元に戻し、ETag ヘッダーを付けて、JSON形式でレスポンスを返す
+// 歌手がゴミ箱に入っていない場合は 404 を返す
+func (c *singerController) RestoreSingerHandler(w http.ResponseWriter, r *http.Request) {
+	singerID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータから歌手IDを取得
+	if err != nil {
+		err = fmt.Errorf("invalid path param: %w", err)
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	// service/singer.go ファイルの RestoreSingerService メソッドを呼び出す
+	singer, err := c.service.RestoreSingerService(r.Context(), model.SingerID(singerID))
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(singer.Version))
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(singer)
+}
+
+// POST /singers:batch のハンドラー
+// POSTリクエストを処理して歌手の追加（create）・置き換え（update）・削除（delete）をまとめて実行し、操作ごとのステータスコードと結果をJSON形式で返す
+// ?atomic=true の場合は 1 件でも失敗したらすべて取り消す
+func (c *singerController) PostSingerBatchHandler(w http.ResponseWriter, r *http.Request) {
+	idOf := func(singer *model.Singer) int { return int(singer.ID) }
+	handleBatch(w, r, idOf, c.service.BatchSingerService) // service/singer.go ファイルの BatchSingerService メソッドを呼び出す
+}
@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/service"
+)
+
+// trackController 構造体は、service.TrackService インターフェースを持ち、アルバムの曲に関するHTTPリクエストを処理
+type trackController struct {
+	service service.TrackService
+}
+
+// NewTrackController 関数：trackController インスタンスを作成して返す
+func NewTrackController(s service.TrackService) *trackController {
+	return &trackController{service: s}
+}
+
+// GET /albums/{id}/tracks のハンドラー
+// GETリクエストを処理して指定されたアルバムの曲リストを曲順に取得し、JSON形式でレスポンスを返す
+func (c *trackController) GetTrackListHandler(w http.ResponseWriter, r *http.Request) {
+	albumID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータからアルバムIDを取得
+	if err != nil {
+		err = fmt.Errorf("invalid path param: %w", err)
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	// service/track.go ファイルの GetTrackListService メソッドを呼び出す
+	tracks, err := c.service.GetTrackListService(r.Context(), model.AlbumID(albumID))
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(tracks)
+}
+
+// GET /albums/{id}/tracks/{track_id} のハンドラー
+// GETリクエストを処理して曲を取得し、ETag ヘッダーを付けてJSON形式でレスポンスを返す
+func (c *trackController) GetTrackDetailHandler(w http.ResponseWriter, r *http.Request) {
+	albumID, trackID, err := parseTrackPath(r) // URLパラメータからアルバムIDと曲IDを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	// service/track.go ファイルの GetTrackService メソッドを呼び出す
+	track, err := c.service.GetTrackService(r.Context(), albumID, trackID)
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	tag := etag(track.Version)
+	w.Header().Set("ETag", tag)
+	if notModified(r, tag) { // If-None-Match が現在の ETag と一致する場合は本文を返さない
+		w.WriteHeader(304)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(track)
+}
+
+// POST /albums/{id}/tracks のハンドラー
+// POSTリクエストを処理してアルバムに曲を登録し、201 Created と Location ヘッダー付きのJSON形式でレスポンスを返す
+// number を省略した場合はアルバムの最後の曲の次になり、ほかの曲と同じ number を指定した場合は 409 を返す
+// ボディの album_id は省略するか、URLパラメータの id と同じ値にする必要がある
+func (c *trackController) PostTrackHandler(w http.ResponseWriter, r *http.Request) {
+	albumID, err := strconv.Atoi(mux.Vars(r)["id"]) // URLパラメータからアルバムIDを取得
+	if err != nil {
+		err = fmt.Errorf("invalid path param: %w", err)
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	var track *model.Track
+	if err := json.NewDecoder(r.Body).Decode(&track); err != nil { // リクエストボディから曲データを取得
+		err = fmt.Errorf("invalid body param: %w", err) // リクエストボディが不正な場合はエラーを返す
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
+		return
+	}
+	if track != nil {
+		if track.AlbumID != 0 && track.AlbumID != model.AlbumID(albumID) {
+			errorHandler(w, r, 400, codeIDMismatch, "album_id in body does not match path")
+			return
+		}
+		track.AlbumID = model.AlbumID(albumID)
+	}
+
+	if err := c.service.PostTrackService(r.Context(), track); err != nil { // service/track.go ファイルの PostTrackService メソッドを呼び出す
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/albums/%d/tracks/%d", track.AlbumID, track.ID)) // 作成されたリソースの URL
+	w.Header().Set("ETag", etag(track.Version))
+	w.WriteHeader(201)
+	json.NewEncoder(w).Encode(track)
+}
+
+// PUT /albums/{id}/tracks/{track_id} のハンドラー
+// PUTリクエストを処理して曲を置き換え、JSON形式でレスポンスを返す
+// If-Match ヘッダーがある場合はバージョンが一致するときだけ更新し、一致しない場合は 412 を返す
+// ボディの id と album_id は省略するか、URLパラメータと同じ値にする必要がある
+func (c *trackController) PutTrackHandler(w http.ResponseWriter, r *http.Request) {
+	albumID, trackID, err := parseTrackPath(r) // URLパラメータからアルバムIDと曲IDを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	var track model.Track
+	if err := json.NewDecoder(r.Body).Decode(&track); err != nil { // リクエストボディから曲データを取得
+		err = fmt.Errorf("invalid body param: %w", err) // リクエストボディが不正な場合はエラーを返す
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
+		return
+	}
+	if track.ID != 0 && track.ID != trackID {
+		errorHandler(w, r, 400, codeIDMismatch, "id in body does not match path")
+		return
+	}
+	if track.AlbumID != 0 && track.AlbumID != albumID {
+		errorHandler(w, r, 400, codeIDMismatch, "album_id in body does not match path")
+		return
+	}
+	track.ID = trackID
+	track.AlbumID = albumID
+
+	track.Version, err = parseIfMatch(r) // If-Match ヘッダーから期待するバージョンを取得（ボディの version は使わない）
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidHeader, err.Error())
+		return
+	}
+
+	if err := c.service.PutTrackService(r.Context(), &track); err != nil { // service/track.go ファイルの PutTrackService メソッドを呼び出す
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(track.Version))
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(&track)
+}
+
+// PATCH /albums/{id}/tracks/{track_id} のハンドラー
+// PATCHリクエストを処理して曲を JSON Merge Patch（RFC 7396）で部分的に更新し、JSON形式でレスポンスを返す
+// If-Match ヘッダーがある場合はバージョンが一致するときだけ更新し、一致しない場合は 412 を返す
+func (c *trackController) PatchTrackHandler(w http.ResponseWriter, r *http.Request) {
+	albumID, trackID, err := parseTrackPath(r) // URLパラメータからアルバムIDと曲IDを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	version, err := parseIfMatch(r) // If-Match ヘッダーから期待するバージョンを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidHeader, err.Error())
+		return
+	}
+
+	patch, err := readMergePatch(r) // リクエストボディからパッチを取得
+	if err != nil {
+		err = fmt.Errorf("invalid body param: %w", err) // リクエストボディが不正な場合はエラーを返す
+		errorHandler(w, r, 400, codeInvalidBodyParam, err.Error())
+		return
+	}
+
+	// service/track.go ファイルの PatchTrackService メソッドを呼び出す
+	track, err := c.service.PatchTrackService(r.Context(), albumID, trackID, version, func(t *model.Track) error {
+		return applyMergePatch(t, patch)
+	})
+	if err != nil {
+		serviceErrorHandler(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(track.Version))
+	w.WriteHeader(200)
+	json.NewEncoder(w).Encode(track)
+}
+
+// DELETE /albums/{id}/tracks/{track_id} のハンドラー
+// DELETEリクエストを処理して曲を削除する（If-Match ヘッダーがある場合はバージョンが一致するときだけ削除する）
+// 曲が存在しない場合は 404 を返す。?idempotent=true を指定した場合は 204 を返す
+func (c *trackController) DeleteTrackHandler(w http.ResponseWriter, r *http.Request) {
+	albumID, trackID, err := parseTrackPath(r) // URLパラメータからアルバムIDと曲IDを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidPathParam, err.Error())
+		return
+	}
+
+	version, err := parseIfMatch(r) // If-Match ヘッダーから期待するバージョンを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidHeader, err.Error())
+		return
+	}
+
+	idempotent, err := parseDeleteQuery(r) // クエリパラメータから存在しない場合の扱いを取得
+	if err != nil {
+		errorHandler(w, r, 400, codeInvalidQueryParam, err.Error())
+		return
+	}
+
+	// service/track.go ファイルの DeleteTrackService メソッドを呼び出す
+	if err := c.service.DeleteTrackService(r.Context(), albumID, trackID, version); err != nil {
+		if idempotent && errors.Is(err, apperror.ErrNotFound) { // すでに存在しない場合も削除できたものとして扱う
+			w.WriteHeader(204)
+			return
+		}
+		serviceErrorHandler(w, r, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// parseTrackPath は URLパラメータからアルバムIDと曲IDを取得する
+func parseTrackPath(r *http.Request) (model.AlbumID, model.TrackID, error) {
+	vars := mux.Vars(r)
+	albumID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid path param: %w", err)
+	}
+	trackID, err := strconv.Atoi(vars["track_id"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid path param: %w", err)
+	}
+	return model.AlbumID(albumID), model.TrackID(trackID), nil
+}
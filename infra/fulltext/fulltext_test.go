@@ -0,0 +1,138 @@
+package fulltext_test
+
+import (
+	"fmt"
+	"testing"
+
+	"server-recruit-challenge-sample/infra/fulltext"
+)
+
+func TestFold(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"Alice", "alice"},
+		{"ＡＬＩＣＥ　１２３", "alice 123"},
+		{"ｱﾘｽ", "ありす"},
+		{"ｶﾞｯｺｳ", "がっこう"},
+		{"ﾊﾟﾝ", "ぱん"},
+		{"ヴォーカル", "ゔぉーかる"},
+	} {
+		if got := fulltext.Fold(tc.in); got != tc.want {
+			t.Errorf("Fold(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{"Alice's 1st Album", []string{"alice", "s", "1st", "album"}},
+		{"東京ラブストーリー", []string{"東京", "京ら", "らぶ", "ぶす", "すと", "とー", "ーり", "りー"}},
+		{"Bella 歌", []string{"bella", "歌"}},
+		{"  ", nil},
+	} {
+		var got []string
+		for _, tok := range fulltext.Tokenize(tc.in) {
+			got = append(got, tok.Term)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	ix := fulltext.NewIndex()
+	ix.Add(1, "Alice")
+	ix.Add(2, "Alice's 1st Album")
+	ix.Add(3, "Alicia Keys")
+	ix.Add(4, "東京ラブストーリー")
+	ix.Add(5, "ｱﾘｽ")
+
+	ids := func(matches []fulltext.Match) []int {
+		var ids []int
+		for _, m := range matches {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+
+	for _, tc := range []struct {
+		q    string
+		want []int
+	}{
+		{"alice", []int{1, 2}},    // 完全に一致する文書が上位
+		{"ALI", []int{1, 2, 3}},   // 前方一致。一致した語が短いほど上位
+		{"alice album", []int{2}}, // すべての語に一致する文書だけ
+		{"ストーリー", []int{4}},       // 日本語は 2 文字の組で検索する
+		{"ストリー", nil},             // 組が含まれていない
+		{"東", []int{4}},           // 1 文字の日本語は前方一致
+		{"アリス", []int{5}},         // 半角カタカナも同じ文字として検索できる
+		{"ありす", []int{5}},         // ひらがなとカタカナは同じ文字として検索できる
+		{"ＡＬＩＣＥ", []int{1, 2}},    // 全角英字も同じ文字として検索できる
+		{"bob", nil},
+		{"!!", nil},
+	} {
+		if got := ids(ix.Search(tc.q)); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("Search(%q) = %v, want %v", tc.q, got, tc.want)
+		}
+	}
+
+	// 置き換えた文書と削除した文書は古い内容で検索できない
+	ix.Add(1, "Bob")
+	ix.Remove(3)
+	if got := ids(ix.Search("ali")); fmt.Sprint(got) != fmt.Sprint([]int{2}) {
+		t.Errorf("Search after Add/Remove = %v", got)
+	}
+	if got := ids(ix.Search("bob")); fmt.Sprint(got) != fmt.Sprint([]int{1}) {
+		t.Errorf("Search(replaced) = %v", got)
+	}
+	if ix.Len() != 4 {
+		t.Errorf("Len = %d, want 4", ix.Len())
+	}
+}
+
+func TestIndexSearchAliases(t *testing.T) {
+	ix := fulltext.NewIndex()
+	ix.Add(1, "宇多田ヒカル", "うただひかる", "Utada Hikaru")
+	ix.Add(2, "Hikaru Genji")
+
+	matches := ix.Search("うただ")
+	if len(matches) != 1 || matches[0].ID != 1 || len(matches[0].Spans) != 0 {
+		t.Fatalf("Search by reading = %+v, want doc 1 without spans", matches)
+	}
+	matches = ix.Search("hikaru")
+	if len(matches) != 2 || matches[0].ID != 2 {
+		t.Fatalf("Search by romaji = %+v, want [2 1]", matches)
+	}
+
+	// 別名を変更した文書は古い別名で検索できない
+	ix.Add(1, "宇多田ヒカル")
+	if got := ix.Search("utada"); len(got) != 0 {
+		t.Errorf("Search by removed alias = %+v", got)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	ix := fulltext.NewIndex()
+	ix.Add(1, "Alice's <1st> Album")
+	ix.Add(2, "東京ラブストーリー")
+	ix.Add(3, "ｶﾞｯｺｳ")
+
+	for _, tc := range []struct {
+		text, q, want string
+	}{
+		{"Alice's <1st> Album", "ali alb", "<em>Ali</em>ce&#39;s &lt;1st&gt; <em>Alb</em>um"},
+		{"東京ラブストーリー", "ストーリー", "東京ラブ<em>ストーリー</em>"},
+		{"ｶﾞｯｺｳ", "ガッ", "<em>ｶﾞｯ</em>ｺｳ"},
+	} {
+		matches := ix.Search(tc.q)
+		if len(matches) != 1 {
+			t.Fatalf("Search(%q) = %+v", tc.q, matches)
+		}
+		if got := fulltext.Highlight(tc.text, matches[0].Spans, "<em>", "</em>"); got != tc.want {
+			t.Errorf("Highlight(%q, %q) = %q, want %q", tc.text, tc.q, got, tc.want)
+		}
+	}
+}
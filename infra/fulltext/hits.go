@@ -0,0 +1,64 @@
+// 検索結果をリポジトリの検索結果（model.SearchHit）に変換するためのファイル
+
+package fulltext
+
+import (
+	"sort"
+
+	"server-recruit-challenge-sample/model"
+)
+
+// 強調表示する部分を囲むタグ
+const (
+	highlightPre  = "<em>"
+	highlightPost = "</em>"
+)
+
+// typeOrder は同じスコアの検索結果を並べる順番（歌手、アルバムの順）
+var typeOrder = map[model.SearchType]int{model.SearchTypeSinger: 0, model.SearchTypeAlbum: 1}
+
+// Hits は一致した文書を検索結果に変換する。text は文書IDに対応する元の文字列を返す
+func Hits(typ model.SearchType, matches []Match, text func(id int) string) []*model.SearchHit {
+	hits := make([]*model.SearchHit, 0, len(matches))
+	for _, m := range matches {
+		t := text(m.ID)
+		hits = append(hits, &model.SearchHit{
+			Type:      typ,
+			ID:        m.ID,
+			Text:      t,
+			Highlight: Highlight(t, m.Spans, highlightPre, highlightPost),
+			Score:     m.Score,
+		})
+	}
+	return hits
+}
+
+// SortHits は種類の異なる検索結果をスコアの大きい順（同じ場合は歌手、アルバムの順、その中では ID 順）に並べ、最大 limit 件にする（0 の場合は無制限）
+func SortHits(hits []*model.SearchHit, limit int) []*model.SearchHit {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Type != hits[j].Type {
+			return typeOrder[hits[i].Type] < typeOrder[hits[j].Type]
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// Includes は検索する種類の指定に typ が含まれるかを返す（指定が空の場合はすべて含む）
+func Includes(types []model.SearchType, typ model.SearchType) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,284 @@
+// 全文検索のための転置インデックス（語からその語を含む文書を引く索引）を実装するためのファイル
+
+package fulltext
+
+import (
+	"html"
+	"sort"
+	"strings"
+)
+
+// Span は元の文字列の中で検索語に一致した範囲（文字単位）。End は含まない
+type Span struct {
+	Start int
+	End   int
+}
+
+// Match は検索語に一致した文書
+type Match struct {
+	ID    int     // 文書のID
+	Score float64 // 一致の度合い（大きいほど上位）
+	Spans []Span  // 強調表示する範囲（Start の昇順で重ならない）
+}
+
+// document はインデックスに登録した 1 件の文書
+type document struct {
+	text    folded   // 正規化した文字列
+	tokens  []Token  // text を分割した語
+	aliases []string // 正規化した別名（歌手の読みなど）
+	terms   []string // 別名を分割した語（削除するときに postings から取り除くため）
+}
+
+// Index は文書IDと文字列を登録し、語の前方一致で検索する転置インデックス
+// 並行して使う場合は呼び出し側でロックを取得しておくこと（memorydb ではリポジトリのロックで保護する）
+type Index struct {
+	docs     map[int]*document
+	postings map[string]map[int]int // 語 → 文書ID → 文書の中での出現回数
+	terms    []string               // postings のキーを昇順に並べたスライス（前方一致の検索に使う）
+}
+
+// NewIndex は空のインデックスを生成する
+func NewIndex() *Index {
+	return &Index{docs: make(map[int]*document), postings: make(map[string]map[int]int)}
+}
+
+// Len は登録されている文書の件数を返す
+func (ix *Index) Len() int {
+	return len(ix.docs)
+}
+
+// Add は文書を登録する。同じIDの文書がすでにある場合は置き換える
+// aliases は検索に使うが強調表示はしない別名（歌手の名前の読みやローマ字表記など）。空文字は無視する
+func (ix *Index) Add(id int, text string, aliases ...string) {
+	ix.Remove(id)
+	f := fold(text)
+	doc := &document{text: f, tokens: tokenize(f.runes)}
+	for _, alias := range aliases {
+		if alias == "" {
+			continue
+		}
+		a := fold(alias)
+		doc.aliases = append(doc.aliases, string(a.runes))
+		for _, t := range tokenize(a.runes) {
+			doc.terms = append(doc.terms, t.Term)
+		}
+	}
+	ix.docs[id] = doc
+	for _, t := range doc.tokens {
+		ix.addPosting(t.Term, id)
+	}
+	for _, term := range doc.terms {
+		ix.addPosting(term, id)
+	}
+}
+
+// addPosting は語を含む文書として id を登録する
+func (ix *Index) addPosting(term string, id int) {
+	docs, ok := ix.postings[term]
+	if !ok {
+		docs = make(map[int]int)
+		ix.postings[term] = docs
+		i := sort.SearchStrings(ix.terms, term)
+		ix.terms = append(ix.terms, "")
+		copy(ix.terms[i+1:], ix.terms[i:])
+		ix.terms[i] = term
+	}
+	docs[id]++
+}
+
+// Remove は文書を削除する。登録されていない場合は何もしない
+func (ix *Index) Remove(id int) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	delete(ix.docs, id)
+	for _, t := range doc.tokens {
+		ix.removePosting(t.Term, id)
+	}
+	for _, term := range doc.terms {
+		ix.removePosting(term, id)
+	}
+}
+
+// removePosting は語を含む文書から id を取り除き、どの文書にも含まれなくなった語を削除する
+func (ix *Index) removePosting(term string, id int) {
+	docs := ix.postings[term]
+	if docs == nil {
+		return
+	}
+	delete(docs, id)
+	if len(docs) == 0 {
+		delete(ix.postings, term)
+		if i := sort.SearchStrings(ix.terms, term); i < len(ix.terms) && ix.terms[i] == term {
+			ix.terms = append(ix.terms[:i], ix.terms[i+1:]...)
+		}
+	}
+}
+
+// queryTerm は検索語を分割した 1 つの語。prefix が true の場合はその語で始まる語にも一致する
+type queryTerm struct {
+	term   string
+	prefix bool
+}
+
+// parseQuery は検索語を正規化して分割する
+// 英数字の単語と 1 文字だけの日本語は前方一致、2 文字の組に分けた日本語は完全一致で検索する（組がすべて含まれていれば一致する）
+func parseQuery(q string) []queryTerm {
+	tokens := Tokenize(q)
+	terms := make([]queryTerm, 0, len(tokens))
+	seen := make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		if seen[t.Term] {
+			continue
+		}
+		seen[t.Term] = true
+		r := []rune(t.Term)
+		terms = append(terms, queryTerm{term: t.Term, prefix: !isCJK(r[0]) || len(r) == 1})
+	}
+	return terms
+}
+
+// Search は検索語のすべての語に一致する文書を、一致の度合いが大きい順に返す（同じ場合は ID の昇順）
+// 語ごとに、完全に一致した語は 1、前方一致した語は検索語の長さの割合を加算する。さらに文書全体が検索語と一致する場合や、検索語で始まる場合は加点する
+func (ix *Index) Search(q string) []Match {
+	terms := parseQuery(q)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	type hit struct {
+		score   float64
+		matched int            // 一致した検索語の数
+		prefix  map[string]int // 一致した文書の語 → 強調表示する長さ（文字数）
+	}
+	hits := make(map[int]*hit)
+	for n, qt := range terms {
+		for _, term := range ix.matchingTerms(qt) {
+			weight := float64(len([]rune(qt.term))) / float64(len([]rune(term)))
+			for id, count := range ix.postings[term] {
+				h := hits[id]
+				if h == nil {
+					if n > 0 { // 最初の検索語に一致しなかった文書は結果に含めない
+						continue
+					}
+					h = &hit{prefix: make(map[string]int)}
+					hits[id] = h
+				}
+				if h.matched == n { // 同じ検索語に一致した語が複数あっても、数えるのは 1 回だけ
+					h.matched++
+				}
+				h.score += weight * float64(count)
+				if l := len([]rune(qt.term)); l > h.prefix[term] {
+					h.prefix[term] = l
+				}
+			}
+		}
+	}
+
+	whole := Fold(strings.TrimSpace(q))
+	matches := make([]Match, 0, len(hits))
+	for id, h := range hits {
+		if h.matched < len(terms) {
+			continue
+		}
+		doc := ix.docs[id]
+		h.score += doc.bonus(whole)
+		matches = append(matches, Match{ID: id, Score: h.score, Spans: doc.spans(h.prefix)})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	return matches
+}
+
+// bonus は文書（または別名）全体が検索語と一致する場合は 2、検索語で始まる場合は 1 を返す
+func (d *document) bonus(whole string) float64 {
+	bonus := 0.0
+	for _, text := range append([]string{string(d.text.runes)}, d.aliases...) {
+		if text == whole {
+			return 2
+		} else if strings.HasPrefix(text, whole) {
+			bonus = 1
+		}
+	}
+	return bonus
+}
+
+// matchingTerms は検索語の 1 つの語に一致するインデックスの語を返す
+func (ix *Index) matchingTerms(qt queryTerm) []string {
+	if !qt.prefix {
+		if _, ok := ix.postings[qt.term]; ok {
+			return []string{qt.term}
+		}
+		return nil
+	}
+	var terms []string
+	for i := sort.SearchStrings(ix.terms, qt.term); i < len(ix.terms) && strings.HasPrefix(ix.terms[i], qt.term); i++ {
+		terms = append(terms, ix.terms[i])
+	}
+	return terms
+}
+
+// spans は一致した語の位置を元の文字列の範囲に変換し、重なる範囲をまとめて返す
+// prefix には一致した語ごとに、語の先頭から強調表示する長さ（文字数）が入っている
+func (d *document) spans(prefix map[string]int) []Span {
+	var spans []Span
+	for _, t := range d.tokens {
+		l, ok := prefix[t.Term]
+		if !ok {
+			continue
+		}
+		end := t.Start + l
+		if end > t.End {
+			end = t.End
+		}
+		spans = append(spans, d.text.original(t.Start, end))
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+
+	merged := spans[:0]
+	for _, s := range spans {
+		if n := len(merged); n > 0 && s.Start <= merged[n-1].End {
+			if s.End > merged[n-1].End {
+				merged[n-1].End = s.End
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// original は正規化した文字列の範囲を元の文字列の範囲に変換する
+// 元の 1 文字が複数の文字に正規化された場合（㍻ → 平成 など）は、その元の文字全体を範囲に含める
+func (f folded) original(start, end int) Span {
+	s := Span{Start: f.offsets[start], End: f.offsets[end]}
+	if s.End <= f.offsets[end-1] {
+		s.End = f.offsets[end-1] + 1
+	}
+	return s
+}
+
+// Highlight は文字列の spans の範囲を pre と post で囲んだ文字列を返す
+// HTML に埋め込めるように、囲む部分以外の文字列はエスケープする
+func Highlight(text string, spans []Span, pre, post string) string {
+	runes := []rune(text)
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		if s.Start < last || s.End > len(runes) {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[last:s.Start])))
+		b.WriteString(pre)
+		b.WriteString(html.EscapeString(string(runes[s.Start:s.End])))
+		b.WriteString(post)
+		last = s.End
+	}
+	b.WriteString(html.EscapeString(string(runes[last:])))
+	return b.String()
+}
@@ -0,0 +1,102 @@
+// 全文検索のために文字列を正規化して語（トークン）に分割するためのパッケージ
+
+package fulltext
+
+import (
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"server-recruit-challenge-sample/model"
+)
+
+// Token は正規化した文字列の中の 1 つの語
+// Start と End は正規化した文字列の中での位置（文字単位）で、End は含まない
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// folded は正規化した文字列と、正規化した各文字が元の文字列の何文字目から来たかの対応
+// offsets は len(runes)+1 個の要素を持ち、最後の要素は元の文字列の文字数
+type folded struct {
+	runes   []rune
+	offsets []int
+}
+
+// fold は文字列を検索用に正規化する
+// 1 文字ずつ NFKC で正規化して全角英数字・半角カタカナなどの幅をそろえ、小文字にし、カタカナをひらがなにそろえる（model.NormalizeText と同じ規則）
+// 半角カタカナの濁点・半濁点は直前の文字と合成する（ｶﾞ → ガ）
+func fold(s string) folded {
+	var f folded
+	i := 0
+	for _, r := range s {
+		for _, c := range norm.NFKC.String(string(r)) {
+			c = model.FoldKana(unicode.ToLower(c))
+			if n := len(f.runes); n > 0 && (c == '゙' || c == '゚') { // 結合用の濁点・半濁点
+				if composed := []rune(norm.NFC.String(string([]rune{f.runes[n-1], c}))); len(composed) == 1 {
+					f.runes[n-1] = composed[0]
+					continue
+				}
+			}
+			f.runes = append(f.runes, c)
+			f.offsets = append(f.offsets, i)
+		}
+		i++
+	}
+	f.offsets = append(f.offsets, i)
+	return f
+}
+
+// Fold は文字列を検索用に正規化した結果を返す（大文字・小文字、全角・半角、ひらがな・カタカナの違いを無視して比較するために使う）
+func Fold(s string) string {
+	return string(fold(s).runes)
+}
+
+// isCJK は日本語の文字（漢字・ひらがな・カタカナ・長音記号）かを返す
+// 日本語は単語の区切りがないので、2 文字ずつの組（bi-gram）に分割する
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) || r == 'ー' || r == '々'
+}
+
+// isWord は英数字などの単語を構成する文字かを返す
+func isWord(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)) && !isCJK(r)
+}
+
+// tokenize は正規化した文字列を語に分割する
+// 英数字は空白や記号で区切った単語ごとに、日本語は連続する部分を 2 文字ずつ重ねた組（1 文字だけの場合はその文字）にする
+func tokenize(runes []rune) []Token {
+	var tokens []Token
+	for i := 0; i < len(runes); {
+		switch {
+		case isCJK(runes[i]):
+			start := i
+			for i < len(runes) && isCJK(runes[i]) {
+				i++
+			}
+			if i-start == 1 {
+				tokens = append(tokens, Token{Term: string(runes[start:i]), Start: start, End: i})
+				continue
+			}
+			for j := start; j+1 < i; j++ {
+				tokens = append(tokens, Token{Term: string(runes[j : j+2]), Start: j, End: j + 2})
+			}
+		case isWord(runes[i]):
+			start := i
+			for i < len(runes) && isWord(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Term: string(runes[start:i]), Start: start, End: i})
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+// Tokenize は文字列を正規化して語に分割する。Token の位置は正規化した文字列の中での位置
+func Tokenize(s string) []Token {
+	return tokenize(fold(s).runes)
+}
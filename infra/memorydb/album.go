@@ -4,9 +4,13 @@ package memorydb
 
 import (
 	"context"
-	"errors"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/infra/fulltext"
 	"server-recruit-challenge-sample/model"
 	"server-recruit-challenge-sample/repository"
 )
@@ -16,6 +20,12 @@ import (
 type albumRepository struct {
 	sync.RWMutex
 	albumMap map[model.AlbumID]*model.Album // キーが AlbumID、値が model.Album のマップ
+	ids      []model.AlbumID                // albumMap のキーを昇順に並べたスライス（一覧取得の順序とページングに使う）
+	trash    map[model.AlbumID]*model.Album // ゴミ箱に移動した（DeletedAt が設定された）アルバム。albumMap と ids と credits と index には含めない
+	credits  creditIndex                    // 歌手IDごとのクレジットされたアルバムIDの集合（ListBySinger 用の結合テーブル）
+	index    *fulltext.Index                // タイトルの全文検索用の転置インデックス（文書IDは AlbumID）
+	nextID   model.AlbumID                  // 次に採番するアルバムID（単調増加し、削除されたIDを再利用しない）
+	journal  *journal                       // 変更を書き込むログ（OpenAlbumRepository で開いた場合だけ。nil の場合は永続化しない）
 }
 
 // インターフェースが正しく実装されていることを確認するためのコード
@@ -24,52 +34,306 @@ var _ repository.AlbumRepository = (*albumRepository)(nil)
 // 初期化済みのアルバムデータを持つ albumRepository インスタンスを返す
 func NewAlbumRepository() *albumRepository {
 	var initMap = map[model.AlbumID]*model.Album{
-		1: {ID: 1, Title: "Alice's 1st Album", SingerID: 1},
-		2: {ID: 2, Title: "Alice's 2nd Album", SingerID: 1},
-		3: {ID: 3, Title: "Bella's 1st Album", SingerID: 2},
+		1: {ID: 1, Title: "Alice's 1st Album", SingerID: 1, Version: 1},
+		2: {ID: 2, Title: "Alice's 2nd Album", SingerID: 1, Version: 1},
+		3: {ID: 3, Title: "Bella's 1st Album", SingerID: 2, Version: 1},
 	}
 
-	return &albumRepository{
-		albumMap: initMap,
+	r := &albumRepository{
+		albumMap: make(map[model.AlbumID]*model.Album, len(initMap)),
+		trash:    make(map[model.AlbumID]*model.Album),
+		credits:  make(creditIndex),
+		index:    fulltext.NewIndex(),
+		nextID:   4,
 	}
+	for _, album := range initMap {
+		r.put(album)
+	}
+	return r
 }
 
-// GetAll はアルバムデータを全件取得する。読み取り用のロックを取得し、アルバムデータをスライスにコピーして返す。
+// GetAll はアルバムデータを全件取得する。読み取り用のロックを取得し、アルバムデータをID順にスライスにコピーして返す。
 func (r *albumRepository) GetAll(ctx context.Context) ([]*model.Album, error) {
-	r.RLock()
-	defer r.RUnlock()
+	defer lockForRead(ctx, r)()
 
-	albums := make([]*model.Album, 0, len(r.albumMap))
-	for _, s := range r.albumMap {
-		albums = append(albums, s)
+	albums := make([]*model.Album, 0, len(r.ids))
+	for _, id := range r.ids {
+		albums = append(albums, cloneAlbum(r.albumMap[id]))
 	}
 	return albums, nil
 }
 
+// List は条件に合うアルバムデータを指定された順にページ単位で取得する。読み取り用のロックを取得する。
+// 絞り込みがなく ID の昇順で取得する場合は、カーソルの位置から指定された件数だけを読む。
+// 歌手IDで絞り込む場合は credits を使い、その歌手がクレジットされたアルバムだけを調べる。
+// query.IncludeDeleted が true の場合はゴミ箱のアルバムも含める。
+func (r *albumRepository) List(ctx context.Context, query repository.AlbumQuery) (*repository.Page[*model.Album], error) {
+	defer lockForRead(ctx, r)()
+
+	includeTrash := query.IncludeDeleted && len(r.trash) > 0
+	if query.SingerID == 0 && query.TitleContains == "" && query.Sort.String() == repository.SortFieldID && !includeTrash {
+		return paginate(r.ids, query.Page, func(id model.AlbumID) *model.Album { return cloneAlbum(r.albumMap[id]) })
+	}
+
+	candidates := r.ids
+	if query.SingerID != 0 {
+		candidates = r.credits.albums(query.SingerID)
+	}
+
+	// タイトルの正規化は並び替えにも使うので、1 件につき 1 回だけ行う
+	substr := model.NormalizeText(query.TitleContains)
+	keys := make(map[model.AlbumID]string)
+	albums := make([]*model.Album, 0)
+	match := func(album *model.Album) {
+		if key := album.SortKey(); strings.Contains(key, substr) {
+			keys[album.ID] = key
+			albums = append(albums, album)
+		}
+	}
+	for _, id := range candidates {
+		match(r.albumMap[id])
+	}
+	if includeTrash {
+		for _, album := range r.trash {
+			if query.SingerID == 0 || album.HasCredit(query.SingerID) {
+				match(album)
+			}
+		}
+	}
+
+	keyOf := func(*model.Album) string { return "" }
+	if query.Sort.Field == repository.SortFieldTitle {
+		keyOf = func(a *model.Album) string { return keys[a.ID] }
+	}
+	page, err := paginateSorted(albums, func(a *model.Album) model.AlbumID { return a.ID }, keyOf, query.Sort, query.Page)
+	if err != nil {
+		return nil, err
+	}
+	page.Items = cloneAll(page.Items, cloneAlbum)
+	return page, nil
+}
+
 // Get はアルバムIDに対応するアルバムデータを取得する。読み取り用のロックを取得し、指定されたIDのアルバムが存在しない場合はエラーを返す。
 func (r *albumRepository) Get(ctx context.Context, id model.AlbumID) (*model.Album, error) {
-	r.RLock()
-	defer r.RUnlock()
+	defer lockForRead(ctx, r)()
 
 	album, ok := r.albumMap[id]
 	if !ok {
-		return nil, errors.New("not found")
+		return nil, apperror.NotFound(apperror.CodeAlbumNotFound, "album %d not found", id)
+	}
+	return cloneAlbum(album), nil
+}
+
+// ListBySinger は指定された歌手がクレジットされたアルバムをID順に取得する。読み取り用のロックを取得し、credits から対象のアルバムだけを取り出す。
+func (r *albumRepository) ListBySinger(ctx context.Context, singerID model.SingerID) ([]*model.Album, error) {
+	defer lockForRead(ctx, r)()
+
+	ids := r.credits.albums(singerID)
+	albums := make([]*model.Album, 0, len(ids))
+	for _, id := range ids {
+		albums = append(albums, cloneAlbum(r.albumMap[id]))
 	}
-	return album, nil
+	sort.Slice(albums, func(i, j int) bool { return albums[i].ID < albums[j].ID })
+	return albums, nil
 }
 
-// Add は新しいアルバムを追加する。書き込み用のロックを取得し、歌手を albumMap に追加する。
+// Add は新しいアルバムを追加する。書き込み用のロックを取得し、アルバムを albumMap に追加する。
+// ID が 0 の場合は nextID から採番し、指定された ID がすでに存在する場合はエラーを返す。
 func (r *albumRepository) Add(ctx context.Context, album *model.Album) error {
-	r.Lock()
-	r.albumMap[album.ID] = album
-	r.Unlock()
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	if album.ID == 0 {
+		album.ID = r.nextID
+	} else if r.exists(album.ID) {
+		return apperror.AlreadyExists(apperror.CodeAlbumAlreadyExists, "album %d already exists", album.ID)
+	}
+	album.Version = 1
+	album.DeletedAt = nil                       // 削除日時は Delete と Restore だけが変更する
+	if err := r.logPut(tx, album); err != nil { // メモリ上のデータを変更する前にログに書き込む
+		return err
+	}
+	r.put(cloneAlbum(album)) // 呼び出し側が後から album を書き換えても影響を受けないようにコピーを保存する
+	id := album.ID
+	tx.addUndo(func() { r.remove(id) })
+	r.compact(tx)
 	return nil
 }
 
-// Delete は指定されたアルバムIDに対応するアルバムを削除する。書き込み用のロックを取得し、albumMap から指定されたIDのアルバムを削除する
-func (r *albumRepository) Delete(ctx context.Context, id model.AlbumID) error {
-	r.Lock()
-	delete(r.albumMap, id)
-	r.Unlock()
+// Update はアルバムデータを置き換える。書き込み用のロックを取得し、指定されたIDのアルバムが存在しない場合やバージョンが一致しない場合はエラーを返す。
+// 歌手IDやクレジットが変わった場合は credits も付け替える。
+func (r *albumRepository) Update(ctx context.Context, album *model.Album) error {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	current, ok := r.albumMap[album.ID]
+	if !ok {
+		return apperror.NotFound(apperror.CodeAlbumNotFound, "album %d not found", album.ID)
+	}
+	if album.Version != 0 && album.Version != current.Version {
+		return apperror.Precondition(apperror.CodeVersionMismatch, "album %d has version %d, not %d", album.ID, current.Version, album.Version)
+	}
+	album.Version = current.Version + 1
+	album.DeletedAt = nil
+	if err := r.logPut(tx, album); err != nil {
+		album.Version = current.Version
+		return err
+	}
+	r.put(cloneAlbum(album))
+	tx.addUndo(func() { r.put(current) })
+	r.compact(tx)
 	return nil
 }
+
+// Delete は指定されたアルバムIDに対応するアルバムをゴミ箱に移動する。書き込み用のロックを取得し、DeletedAt を設定してバージョンを上げる
+// 指定されたIDのアルバムが存在しない（すでにゴミ箱に入っている）場合や、version が 0 以外で現在のバージョンと一致しない場合は削除せずにエラーを返す
+func (r *albumRepository) Delete(ctx context.Context, id model.AlbumID, version model.Version) error {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	current, ok := r.albumMap[id]
+	if !ok {
+		return apperror.NotFound(apperror.CodeAlbumNotFound, "album %d not found", id)
+	}
+	if version != 0 && version != current.Version {
+		return apperror.Precondition(apperror.CodeVersionMismatch, "album %d has version %d, not %d", id, current.Version, version)
+	}
+
+	deleted := cloneAlbum(current)
+	now := time.Now().UTC()
+	deleted.DeletedAt = &now
+	deleted.Version++
+	if err := r.logPut(tx, deleted); err != nil {
+		return err
+	}
+	r.put(deleted)
+	tx.addUndo(func() { r.put(current) })
+	r.compact(tx)
+	return nil
+}
+
+// Restore はゴミ箱のアルバムを元に戻す。書き込み用のロックを取得し、DeletedAt を消してバージョンを上げる
+func (r *albumRepository) Restore(ctx context.Context, id model.AlbumID) (*model.Album, error) {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	current, ok := r.trash[id]
+	if !ok {
+		return nil, apperror.NotFound(apperror.CodeAlbumNotFound, "album %d is not in the trash", id)
+	}
+
+	restored := cloneAlbum(current)
+	restored.DeletedAt = nil
+	restored.Version++
+	if err := r.logPut(tx, restored); err != nil {
+		return nil, err
+	}
+	r.put(restored)
+	tx.addUndo(func() { r.put(current) })
+	r.compact(tx)
+	return cloneAlbum(restored), nil
+}
+
+// Purge は deletedBefore より前にゴミ箱に移動したアルバムを完全に削除する。書き込み用のロックを取得する
+func (r *albumRepository) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	var ids []model.AlbumID
+	for id, album := range r.trash {
+		if album.DeletedAt.Before(deletedBefore) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for n, id := range ids {
+		if err := r.logDelete(tx, id); err != nil {
+			return n, err
+		}
+		current := r.trash[id]
+		r.remove(id)
+		tx.addUndo(func() { r.put(current) })
+	}
+	r.compact(tx)
+	return len(ids), nil
+}
+
+// UnlinkSinger は指定された歌手がクレジットされたアルバム（ゴミ箱のアルバムも含む）から歌手を外してバージョンを上げる。書き込み用のロックを取得する
+// SingerID が一致する場合は 0 にし、Credits からはその歌手のクレジットを削除する（credits の結びつきも put で付け替える）
+// 歌手を完全に削除する前に呼び出し、完全に削除された歌手をアルバムが参照したまま残らないようにする（sqldb の ON DELETE SET NULL / CASCADE に相当する）
+func (r *albumRepository) UnlinkSinger(ctx context.Context, singerID model.SingerID) (int, error) {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	var targets []*model.Album
+	for _, id := range r.credits.albums(singerID) {
+		targets = append(targets, r.albumMap[id])
+	}
+	for _, album := range r.trash {
+		if album.HasCredit(singerID) {
+			targets = append(targets, album)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].ID < targets[j].ID })
+
+	for n := range targets {
+		current := targets[n]
+		unlinked := cloneAlbum(current)
+		if unlinked.SingerID == singerID {
+			unlinked.SingerID = 0
+		}
+		var credits []model.Credit
+		for _, c := range unlinked.Credits {
+			if c.SingerID != singerID {
+				credits = append(credits, c)
+			}
+		}
+		unlinked.Credits = credits
+		unlinked.Version++
+		if err := r.logPut(tx, unlinked); err != nil {
+			return n, err
+		}
+		r.put(unlinked)
+		tx.addUndo(func() { r.put(current) })
+	}
+	r.compact(tx)
+	return len(targets), nil
+}
+
+// exists はアルバムIDがゴミ箱も含めて使われているかを返す。呼び出し側でロックを取得しておくこと。
+func (r *albumRepository) exists(id model.AlbumID) bool {
+	_, live := r.albumMap[id]
+	_, trashed := r.trash[id]
+	return live || trashed
+}
+
+// put はアルバムを登録し、nextID を進める。DeletedAt が設定されている場合はゴミ箱に、そうでない場合は albumMap と ids と credits と index に登録する。
+// 呼び出し側で書き込み用のロックを取得しておくこと。
+func (r *albumRepository) put(album *model.Album) {
+	if album.ID >= r.nextID {
+		r.nextID = album.ID + 1
+	}
+	r.remove(album.ID) // 同じIDのアルバムを上書きする場合、以前の歌手との結びつきを外す
+	if album.DeletedAt != nil {
+		r.trash[album.ID] = album
+		return
+	}
+	r.albumMap[album.ID] = album
+	r.ids = insertID(r.ids, album.ID)
+	r.credits.add(album)
+	r.index.Add(int(album.ID), album.Title)
+}
+
+// remove は albumMap と ids と credits と index とゴミ箱のすべてからアルバムを削除する。呼び出し側で書き込み用のロックを取得しておくこと。
+func (r *albumRepository) remove(id model.AlbumID) {
+	delete(r.trash, id)
+	album, ok := r.albumMap[id]
+	if !ok {
+		return
+	}
+	delete(r.albumMap, id)
+	r.ids = removeID(r.ids, id)
+	r.credits.remove(album)
+	r.index.Remove(int(id))
+}
@@ -0,0 +1,56 @@
+// リポジトリの中のデータを呼び出し側と共有しないようにコピーするための補助関数を定義するファイル
+
+package memorydb
+
+import (
+	"time"
+
+	"server-recruit-challenge-sample/model"
+)
+
+// リポジトリの中のデータを指すポインターを呼び出し側に渡すと、呼び出し側がロックを取得せずにデータを書き換えられてしまう
+// そのため保存するときは引数のコピーを保存し、返すときも保存しているデータのコピーを返す
+
+// cloneSinger は歌手データのコピーを返す。DeletedAt が指す値もコピーする
+func cloneSinger(singer *model.Singer) *model.Singer {
+	c := *singer
+	c.DeletedAt = cloneTime(singer.DeletedAt)
+	return &c
+}
+
+// cloneAlbum はアルバムデータのコピーを返す。Genres のスライスと DeletedAt が指す値もコピーする
+func cloneAlbum(album *model.Album) *model.Album {
+	c := *album
+	if album.Genres != nil {
+		c.Genres = append([]string(nil), album.Genres...)
+	}
+	if album.Credits != nil {
+		c.Credits = append([]model.Credit(nil), album.Credits...)
+	}
+	c.DeletedAt = cloneTime(album.DeletedAt)
+	return &c
+}
+
+// cloneTrack は曲データのコピーを返す
+func cloneTrack(track *model.Track) *model.Track {
+	c := *track
+	return &c
+}
+
+// cloneTime は時刻へのポインターのコピーを返す。nil の場合は nil を返す
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+// cloneAll はスライスの要素をすべてコピーした新しいスライスを返す
+func cloneAll[T any](items []T, clone func(T) T) []T {
+	cloned := make([]T, len(items))
+	for i, item := range items {
+		cloned[i] = clone(item)
+	}
+	return cloned
+}
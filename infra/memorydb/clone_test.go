@@ -0,0 +1,147 @@
+package memorydb_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"server-recruit-challenge-sample/infra/memorydb"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// 以下のテストは go test -race で実行すると、リポジトリがポインターを共有していた場合にデータ競合として検出される
+
+func TestSingerRepositoryDoesNotAliasCallerData(t *testing.T) {
+	ctx := context.Background()
+	repo := memorydb.NewSingerRepository()
+
+	// 追加した後に呼び出し側が構造体を書き換えても、保存されたデータは変わらない
+	frank := &model.Singer{Name: "Frank"}
+	if err := repo.Add(ctx, frank); err != nil {
+		t.Fatal(err)
+	}
+	frank.Name = "Changed after Add"
+	if got, _ := repo.Get(ctx, frank.ID); got.Name != "Frank" {
+		t.Fatalf("Add stored the caller's pointer: got %q", got.Name)
+	}
+
+	update := &model.Singer{ID: frank.ID, Name: "Frankie"}
+	if err := repo.Update(ctx, update); err != nil {
+		t.Fatal(err)
+	}
+	update.Name = "Changed after Update"
+	if got, _ := repo.Get(ctx, frank.ID); got.Name != "Frankie" {
+		t.Fatalf("Update stored the caller's pointer: got %q", got.Name)
+	}
+
+	// 取得したデータを書き換えても、保存されたデータは変わらない
+	got, _ := repo.Get(ctx, 1)
+	got.Name = "Changed via Get"
+	all, _ := repo.GetAll(ctx)
+	all[0].Name = "Changed via GetAll"
+	page, _ := repo.List(ctx, repository.SingerQuery{Sort: repository.Sort{Field: repository.SortFieldName}})
+	page.Items[0].Name = "Changed via List"
+	byIDs, _ := repo.GetByIDs(ctx, []model.SingerID{1})
+	byIDs[1].Name = "Changed via GetByIDs"
+	if got, _ := repo.Get(ctx, 1); got.Name != "Alice" {
+		t.Fatalf("returned singer aliases stored data: got %q", got.Name)
+	}
+}
+
+func TestAlbumRepositoryDoesNotAliasCallerData(t *testing.T) {
+	ctx := context.Background()
+	repo := memorydb.NewAlbumRepository()
+
+	album := &model.Album{Title: "New", SingerID: 1}
+	if err := repo.Add(ctx, album); err != nil {
+		t.Fatal(err)
+	}
+	album.SingerID = 2 // 保存されたデータを書き換えられると credits と食い違ってしまう
+	if got, _ := repo.ListBySinger(ctx, 1); len(got) != 3 || got[2].SingerID != 1 {
+		t.Fatalf("Add stored the caller's pointer: got %+v", got)
+	}
+
+	got, _ := repo.Get(ctx, 1)
+	got.Title = "Changed via Get"
+	bySinger, _ := repo.ListBySinger(ctx, 1)
+	bySinger[0].Title = "Changed via ListBySinger"
+	page, _ := repo.List(ctx, repository.AlbumQuery{TitleContains: "alice"})
+	page.Items[0].Title = "Changed via List"
+	if got, _ := repo.Get(ctx, 1); got.Title != "Alice's 1st Album" {
+		t.Fatalf("returned album aliases stored data: got %q", got.Title)
+	}
+}
+
+// TestSingerRepositoryConcurrentMutationOfDecodedStruct はハンドラーが追加した後の構造体を書き換えるのと同時に、
+// ほかのリクエストが同じ歌手を読み取る状況を再現する
+func TestSingerRepositoryConcurrentMutationOfDecodedStruct(t *testing.T) {
+	ctx := context.Background()
+	repo := memorydb.NewSingerRepository()
+
+	singer := &model.Singer{Name: "Frank"}
+	if err := repo.Add(ctx, singer); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			singer.Name = "Mutated" // ロックを取得せずに書き換える
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			got, err := repo.Get(ctx, singer.ID)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			got.Name += "!" // 取得したデータもロックを取得せずに書き換える
+			if _, err := repo.List(ctx, repository.SingerQuery{NamePrefix: "f"}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if got, _ := repo.Get(ctx, singer.ID); got.Name != "Frank" {
+		t.Fatalf("stored singer was modified without the lock: got %q", got.Name)
+	}
+}
+
+func TestAlbumRepositoryConcurrentMutationOfReturnedStruct(t *testing.T) {
+	ctx := context.Background()
+	repo := memorydb.NewAlbumRepository()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				albums, err := repo.GetAll(ctx)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				for _, a := range albums {
+					a.Title += "!"
+				}
+				if _, err := repo.List(ctx, repository.AlbumQuery{Sort: repository.Sort{Field: repository.SortFieldTitle}}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, _ := repo.Get(ctx, 3); got.Title != "Bella's 1st Album" {
+		t.Fatalf("stored album was modified without the lock: got %q", got.Title)
+	}
+}
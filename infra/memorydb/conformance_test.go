@@ -0,0 +1,74 @@
+package memorydb_test
+
+import (
+	"testing"
+
+	"server-recruit-challenge-sample/infra/memorydb"
+	"server-recruit-challenge-sample/repository"
+	"server-recruit-challenge-sample/repository/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository) {
+		return memorydb.NewSingerRepository(), memorydb.NewAlbumRepository()
+	})
+}
+
+func TestDurableConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository) {
+		dir := t.TempDir()
+		singers, err := memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{SnapshotEvery: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { singers.Close() })
+		albums, err := memorydb.OpenAlbumRepository(dir, memorydb.DurableOptions{SnapshotEvery: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { albums.Close() })
+		return singers, albums
+	})
+}
+
+func TestTrackConformance(t *testing.T) {
+	repotest.RunTracks(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository, repository.TrackRepository) {
+		return memorydb.NewSingerRepository(), memorydb.NewAlbumRepository(), memorydb.NewTrackRepository()
+	})
+}
+
+func TestDurableTrackConformance(t *testing.T) {
+	repotest.RunTracks(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository, repository.TrackRepository) {
+		dir := t.TempDir()
+		tracks, err := memorydb.OpenTrackRepository(dir, memorydb.DurableOptions{SnapshotEvery: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { tracks.Close() })
+		return memorydb.NewSingerRepository(), memorydb.NewAlbumRepository(), tracks
+	})
+}
+
+func TestSearchConformance(t *testing.T) {
+	repotest.RunSearch(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository, repository.SearchRepository) {
+		singers, albums := memorydb.NewSingerRepository(), memorydb.NewAlbumRepository()
+		return singers, albums, memorydb.NewSearchRepository(singers, albums)
+	})
+}
+
+func TestDurableSearchConformance(t *testing.T) {
+	repotest.RunSearch(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository, repository.SearchRepository) {
+		dir := t.TempDir()
+		singers, err := memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{SnapshotEvery: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { singers.Close() })
+		albums, err := memorydb.OpenAlbumRepository(dir, memorydb.DurableOptions{SnapshotEvery: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { albums.Close() })
+		return singers, albums, memorydb.NewSearchRepository(singers, albums)
+	})
+}
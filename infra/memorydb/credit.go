@@ -0,0 +1,42 @@
+// アルバムと歌手の多対多の関係（クレジット）をメモリ内で保持するための結合テーブルを実装するためのファイル
+
+package memorydb
+
+import "server-recruit-challenge-sample/model"
+
+// creditIndex は歌手IDから、その歌手がクレジットされた（SingerID またはクレジットに含まれる）アルバムIDの集合を引くための結合テーブル
+// albumRepository のロックで保護されるので、呼び出し側でロックを取得しておくこと。
+type creditIndex map[model.SingerID]map[model.AlbumID]struct{}
+
+// add はアルバムにクレジットされたすべての歌手とアルバムを結びつける
+func (idx creditIndex) add(album *model.Album) {
+	for _, singerID := range album.CreditedSingerIDs() {
+		ids, ok := idx[singerID]
+		if !ok {
+			ids = make(map[model.AlbumID]struct{})
+			idx[singerID] = ids
+		}
+		ids[album.ID] = struct{}{}
+	}
+}
+
+// remove はアルバムにクレジットされたすべての歌手とアルバムの結びつきを削除する
+func (idx creditIndex) remove(album *model.Album) {
+	for _, singerID := range album.CreditedSingerIDs() {
+		if ids := idx[singerID]; ids != nil {
+			delete(ids, album.ID)
+			if len(ids) == 0 {
+				delete(idx, singerID)
+			}
+		}
+	}
+}
+
+// albums は歌手がクレジットされたアルバムIDを返す（順序は不定）
+func (idx creditIndex) albums(singerID model.SingerID) []model.AlbumID {
+	ids := make([]model.AlbumID, 0, len(idx[singerID]))
+	for id := range idx[singerID] {
+		ids = append(ids, id)
+	}
+	return ids
+}
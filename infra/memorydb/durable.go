@@ -0,0 +1,390 @@
+// メモリ内のリポジトリをログとスナップショットから復元し、変更をファイルに書き込むためのファイル
+
+package memorydb
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"server-recruit-challenge-sample/infra/fulltext"
+	"server-recruit-challenge-sample/model"
+)
+
+// OpenSingerRepository は dir の中のスナップショットとログ（singers.snapshot / singers.wal）から歌手のリポジトリを復元する
+// 以降の Add / Update / Delete はメモリ上のデータを変更する前にログに追記され、fsync されてから成功を返す
+// ファイルがない場合（初回起動）は NewSingerRepository と同じ初期データから始める
+func OpenSingerRepository(dir string, opts DurableOptions) (*singerRepository, error) {
+	j, snapshot, records, err := openJournal(dir, "singers", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewSingerRepository()
+	if snapshot != nil || len(records) > 0 {
+		r = &singerRepository{
+			singerMap: make(map[model.SingerID]*model.Singer),
+			trash:     make(map[model.SingerID]*model.Singer),
+			index:     fulltext.NewIndex(),
+			nextID:    1,
+		}
+	}
+	if err := r.restore(snapshot, records); err != nil {
+		j.close()
+		return nil, fmt.Errorf("restore singers from %s: %w", dir, err)
+	}
+
+	r.journal = j
+	if snapshot == nil && len(records) == 0 { // 初期データをスナップショットとして書いておく
+		if err := j.writeSnapshot(int(r.nextID), r.snapshotItems()); err != nil {
+			j.close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Close はログファイルを閉じる。OpenSingerRepository で開いていない場合は何もしない
+func (r *singerRepository) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.journal == nil {
+		return nil
+	}
+	err := r.journal.close()
+	r.journal = nil
+	return err
+}
+
+// restore はスナップショットを読み込んでから、ログのレコードを順番に適用する
+func (r *singerRepository) restore(snapshot *snapshotData, records []walRecord) error {
+	if snapshot != nil {
+		var singers []*model.Singer
+		if err := json.Unmarshal(snapshot.Items, &singers); err != nil {
+			return err
+		}
+		for _, singer := range singers {
+			r.put(singer)
+		}
+		if id := model.SingerID(snapshot.NextID); id > r.nextID {
+			r.nextID = id
+		}
+	}
+
+	for _, rec := range records {
+		switch rec.Op {
+		case opPut:
+			var singer model.Singer
+			if err := json.Unmarshal(rec.Data, &singer); err != nil {
+				return err
+			}
+			r.put(&singer)
+		case opDelete:
+			r.remove(model.SingerID(rec.ID))
+		default:
+			return fmt.Errorf("unknown log op %q", rec.Op)
+		}
+	}
+	return nil
+}
+
+// snapshotItems はスナップショットに書き込む歌手データを、ゴミ箱の歌手も含めて ID 順に返す
+func (r *singerRepository) snapshotItems() []*model.Singer {
+	singers := make([]*model.Singer, 0, len(r.ids)+len(r.trash))
+	for _, id := range r.ids {
+		singers = append(singers, r.singerMap[id])
+	}
+	for _, singer := range r.trash {
+		singers = append(singers, singer)
+	}
+	sort.Slice(singers, func(i, j int) bool { return singers[i].ID < singers[j].ID })
+	return singers
+}
+
+// logPut は歌手の追加・更新をログに追記する（永続化しない場合は何もしない）
+func (r *singerRepository) logPut(tx *memTx, singer *model.Singer) error {
+	if r.journal == nil {
+		return nil
+	}
+	rec, err := putRecord(int(singer.ID), singer)
+	if err != nil {
+		return err
+	}
+	return r.journal.write(tx, rec)
+}
+
+// logDelete は歌手の削除をログに追記する（永続化しない場合は何もしない）
+func (r *singerRepository) logDelete(tx *memTx, id model.SingerID) error {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.write(tx, deleteRecord(int(id)))
+}
+
+// compact はログに溜まったレコード数が設定に達していればスナップショットを書く。トランザクションの中ではコミットした後に実行する
+// 失敗しても変更はログに残っているので、エラーはログに出力するだけにする
+func (r *singerRepository) compact(tx *memTx) {
+	if r.journal == nil {
+		return
+	}
+	if tx != nil {
+		tx.addAfterCommit(func() { r.compact(nil) })
+		return
+	}
+	if !r.journal.needsSnapshot() {
+		return
+	}
+	if err := r.journal.writeSnapshot(int(r.nextID), r.snapshotItems()); err != nil {
+		slog.Error("memorydb write snapshot failed", "repository", "singers", "error", err.Error())
+	}
+}
+
+// OpenAlbumRepository は dir の中のスナップショットとログ（albums.snapshot / albums.wal）からアルバムのリポジトリを復元する
+// 以降の Add / Update / Delete はメモリ上のデータを変更する前にログに追記され、fsync されてから成功を返す
+// ファイルがない場合（初回起動）は NewAlbumRepository と同じ初期データから始める
+func OpenAlbumRepository(dir string, opts DurableOptions) (*albumRepository, error) {
+	j, snapshot, records, err := openJournal(dir, "albums", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewAlbumRepository()
+	if snapshot != nil || len(records) > 0 {
+		r = &albumRepository{
+			albumMap: make(map[model.AlbumID]*model.Album),
+			trash:    make(map[model.AlbumID]*model.Album),
+			credits:  make(creditIndex),
+			index:    fulltext.NewIndex(),
+			nextID:   1,
+		}
+	}
+	if err := r.restore(snapshot, records); err != nil {
+		j.close()
+		return nil, fmt.Errorf("restore albums from %s: %w", dir, err)
+	}
+
+	r.journal = j
+	if snapshot == nil && len(records) == 0 { // 初期データをスナップショットとして書いておく
+		if err := j.writeSnapshot(int(r.nextID), r.snapshotItems()); err != nil {
+			j.close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Close はログファイルを閉じる。OpenAlbumRepository で開いていない場合は何もしない
+func (r *albumRepository) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.journal == nil {
+		return nil
+	}
+	err := r.journal.close()
+	r.journal = nil
+	return err
+}
+
+// restore はスナップショットを読み込んでから、ログのレコードを順番に適用する
+func (r *albumRepository) restore(snapshot *snapshotData, records []walRecord) error {
+	if snapshot != nil {
+		var albums []*model.Album
+		if err := json.Unmarshal(snapshot.Items, &albums); err != nil {
+			return err
+		}
+		for _, album := range albums {
+			r.put(album)
+		}
+		if id := model.AlbumID(snapshot.NextID); id > r.nextID {
+			r.nextID = id
+		}
+	}
+
+	for _, rec := range records {
+		switch rec.Op {
+		case opPut:
+			var album model.Album
+			if err := json.Unmarshal(rec.Data, &album); err != nil {
+				return err
+			}
+			r.put(&album)
+		case opDelete:
+			r.remove(model.AlbumID(rec.ID))
+		default:
+			return fmt.Errorf("unknown log op %q", rec.Op)
+		}
+	}
+	return nil
+}
+
+// snapshotItems はスナップショットに書き込むアルバムデータを、ゴミ箱のアルバムも含めて ID 順に返す
+func (r *albumRepository) snapshotItems() []*model.Album {
+	albums := make([]*model.Album, 0, len(r.ids)+len(r.trash))
+	for _, id := range r.ids {
+		albums = append(albums, r.albumMap[id])
+	}
+	for _, album := range r.trash {
+		albums = append(albums, album)
+	}
+	sort.Slice(albums, func(i, j int) bool { return albums[i].ID < albums[j].ID })
+	return albums
+}
+
+// logPut はアルバムの追加・更新をログに追記する（永続化しない場合は何もしない）
+func (r *albumRepository) logPut(tx *memTx, album *model.Album) error {
+	if r.journal == nil {
+		return nil
+	}
+	rec, err := putRecord(int(album.ID), album)
+	if err != nil {
+		return err
+	}
+	return r.journal.write(tx, rec)
+}
+
+// logDelete はアルバムの削除をログに追記する（永続化しない場合は何もしない）
+func (r *albumRepository) logDelete(tx *memTx, id model.AlbumID) error {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.write(tx, deleteRecord(int(id)))
+}
+
+// compact はログに溜まったレコード数が設定に達していればスナップショットを書く。トランザクションの中ではコミットした後に実行する
+// 失敗しても変更はログに残っているので、エラーはログに出力するだけにする
+func (r *albumRepository) compact(tx *memTx) {
+	if r.journal == nil {
+		return
+	}
+	if tx != nil {
+		tx.addAfterCommit(func() { r.compact(nil) })
+		return
+	}
+	if !r.journal.needsSnapshot() {
+		return
+	}
+	if err := r.journal.writeSnapshot(int(r.nextID), r.snapshotItems()); err != nil {
+		slog.Error("memorydb write snapshot failed", "repository", "albums", "error", err.Error())
+	}
+}
+
+// OpenTrackRepository は dir の中のスナップショットとログ（tracks.snapshot / tracks.wal）から曲のリポジトリを復元する
+// 以降の Add / Update / Delete はメモリ上のデータを変更する前にログに追記され、fsync されてから成功を返す
+// ファイルがない場合（初回起動）は NewTrackRepository と同じく曲のない状態から始める
+func OpenTrackRepository(dir string, opts DurableOptions) (*trackRepository, error) {
+	j, snapshot, records, err := openJournal(dir, "tracks", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewTrackRepository()
+	if err := r.restore(snapshot, records); err != nil {
+		j.close()
+		return nil, fmt.Errorf("restore tracks from %s: %w", dir, err)
+	}
+
+	r.journal = j
+	if snapshot == nil && len(records) == 0 {
+		if err := j.writeSnapshot(int(r.nextID), r.snapshotItems()); err != nil {
+			j.close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Close はログファイルを閉じる。OpenTrackRepository で開いていない場合は何もしない
+func (r *trackRepository) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.journal == nil {
+		return nil
+	}
+	err := r.journal.close()
+	r.journal = nil
+	return err
+}
+
+// restore はスナップショットを読み込んでから、ログのレコードを順番に適用する
+func (r *trackRepository) restore(snapshot *snapshotData, records []walRecord) error {
+	if snapshot != nil {
+		var tracks []*model.Track
+		if err := json.Unmarshal(snapshot.Items, &tracks); err != nil {
+			return err
+		}
+		for _, track := range tracks {
+			r.put(track)
+		}
+		if id := model.TrackID(snapshot.NextID); id > r.nextID {
+			r.nextID = id
+		}
+	}
+
+	for _, rec := range records {
+		switch rec.Op {
+		case opPut:
+			var track model.Track
+			if err := json.Unmarshal(rec.Data, &track); err != nil {
+				return err
+			}
+			r.put(&track)
+		case opDelete:
+			r.remove(model.TrackID(rec.ID))
+		default:
+			return fmt.Errorf("unknown log op %q", rec.Op)
+		}
+	}
+	return nil
+}
+
+// snapshotItems はスナップショットに書き込む曲データを ID 順に返す
+func (r *trackRepository) snapshotItems() []*model.Track {
+	tracks := make([]*model.Track, 0, len(r.trackMap))
+	for _, track := range r.trackMap {
+		tracks = append(tracks, track)
+	}
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i].ID < tracks[j].ID })
+	return tracks
+}
+
+// logPut は曲の追加・更新をログに追記する（永続化しない場合は何もしない）
+func (r *trackRepository) logPut(tx *memTx, track *model.Track) error {
+	if r.journal == nil {
+		return nil
+	}
+	rec, err := putRecord(int(track.ID), track)
+	if err != nil {
+		return err
+	}
+	return r.journal.write(tx, rec)
+}
+
+// logDelete は曲の削除をログに追記する（永続化しない場合は何もしない）
+func (r *trackRepository) logDelete(tx *memTx, id model.TrackID) error {
+	if r.journal == nil {
+		return nil
+	}
+	return r.journal.write(tx, deleteRecord(int(id)))
+}
+
+// compact はログに溜まったレコード数が設定に達していればスナップショットを書く。トランザクションの中ではコミットした後に実行する
+// 失敗しても変更はログに残っているので、エラーはログに出力するだけにする
+func (r *trackRepository) compact(tx *memTx) {
+	if r.journal == nil {
+		return
+	}
+	if tx != nil {
+		tx.addAfterCommit(func() { r.compact(nil) })
+		return
+	}
+	if !r.journal.needsSnapshot() {
+		return
+	}
+	if err := r.journal.writeSnapshot(int(r.nextID), r.snapshotItems()); err != nil {
+		slog.Error("memorydb write snapshot failed", "repository", "tracks", "error", err.Error())
+	}
+}
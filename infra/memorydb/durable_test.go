@@ -0,0 +1,294 @@
+package memorydb_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/infra/memorydb"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+func TestDurableSingerRepositoryRestoresAfterReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	repo, err := memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, 1); err != nil {
+		t.Fatalf("first boot should start from seed data: %v", err)
+	}
+	if err := repo.Add(ctx, &model.Singer{Name: "Frank"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(ctx, &model.Singer{ID: 2, Name: "Bella B."}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, 3, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err = memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	if s, err := repo.Get(ctx, 6); err != nil || s.Name != "Frank" {
+		t.Fatalf("added singer: got %+v, %v", s, err)
+	}
+	if s, err := repo.Get(ctx, 2); err != nil || s.Name != "Bella B." || s.Version != 2 {
+		t.Fatalf("updated singer: got %+v, %v", s, err)
+	}
+	if _, err := repo.Get(ctx, 3); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("deleted singer: got %v, want ErrNotFound", err)
+	}
+	if s, err := repo.Restore(ctx, 3); err != nil || s.Name != "Chris" || s.Version != 3 {
+		t.Fatalf("deleted singer must stay in the trash after reopen: got %+v, %v", s, err)
+	}
+	george := &model.Singer{Name: "George"}
+	if err := repo.Add(ctx, george); err != nil {
+		t.Fatal(err)
+	}
+	if george.ID != 7 {
+		t.Fatalf("Add after reopen assigned id=%d, want 7", george.ID)
+	}
+}
+
+// コミットしたレコードは成功を返す前に fsync されているので、Close せずに終了（os.Exit やクラッシュ）しても失われない
+func TestDurableRepositoriesKeepCommitsWithoutClose(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	singers, err := memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	albums, err := memorydb.OpenAlbumRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := singers.Add(ctx, &model.Singer{Name: "Frank"}); err != nil {
+		t.Fatal(err)
+	}
+	err = memorydb.NewTransactor(singers, albums).RunInTx(ctx, func(ctx context.Context) error {
+		if err := singers.Update(ctx, &model.Singer{ID: 2, Name: "Bella B."}); err != nil {
+			return err
+		}
+		return albums.Add(ctx, &model.Album{Title: "Frank's 1st Album", SingerID: 6})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Close を呼ばずに、同じディレクトリから別のリポジトリとして開き直す
+
+	reopenedSingers, err := memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopenedSingers.Close()
+	reopenedAlbums, err := memorydb.OpenAlbumRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopenedAlbums.Close()
+	if s, err := reopenedSingers.Get(ctx, 6); err != nil || s.Name != "Frank" {
+		t.Fatalf("added singer: got %+v, %v", s, err)
+	}
+	if s, err := reopenedSingers.Get(ctx, 2); err != nil || s.Name != "Bella B." {
+		t.Fatalf("singer updated in a transaction: got %+v, %v", s, err)
+	}
+	page, err := reopenedAlbums.List(ctx, repository.AlbumQuery{SingerID: 6})
+	if err != nil || len(page.Items) != 1 || page.Items[0].Title != "Frank's 1st Album" {
+		t.Fatalf("album added in a transaction: got %+v, %v", page, err)
+	}
+	singers.Close() // 最初に開いたファイルディスクリプタを解放する
+	albums.Close()
+}
+
+func TestDurableAlbumRepositoryCompactsIntoSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	opts := memorydb.DurableOptions{SnapshotEvery: 3}
+
+	repo, err := memorydb.OpenAlbumRepository(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		if err := repo.Add(ctx, &model.Album{Title: "Album", SingerID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Delete(ctx, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 8 件の変更のうち 6 件はスナップショットに取り込まれ、ログには 2 件だけが残る
+	if n := len(readRecordsForTest(t, filepath.Join(dir, "albums.wal"))); n != 2 {
+		t.Fatalf("log has %d records after compaction, want 2", n)
+	}
+
+	repo, err = memorydb.OpenAlbumRepository(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	albums, err := repo.GetAll(ctx)
+	if err != nil || len(albums) != 9 || albums[0].ID != 2 || albums[8].ID != 10 {
+		t.Fatalf("GetAll after reopen: got %d albums, %v", len(albums), err)
+	}
+	bySinger, err := repo.ListBySinger(ctx, 1)
+	if err != nil || len(bySinger) != 8 {
+		t.Fatalf("ListBySinger after reopen: got %d albums, %v", len(bySinger), err)
+	}
+}
+
+// TestDurableSingerRepositoryRecoversFromTornWrite は最後のレコードの書き込み中にクラッシュした状態を、
+// ログをレコードの途中のあらゆる位置で切り詰めることで再現する
+func TestDurableSingerRepositoryRecoversFromTornWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "singers.wal")
+
+	repo, err := memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(ctx, &model.Singer{Name: "Frank"}); err != nil {
+		t.Fatal(err)
+	}
+	complete := fileSize(t, walPath)
+	if err := repo.Add(ctx, &model.Singer{Name: "George"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+	full := fileSize(t, walPath)
+
+	for cut := complete; cut < full; cut++ {
+		crashed := copyDir(t, dir)
+		if err := os.Truncate(filepath.Join(crashed, "singers.wal"), cut); err != nil {
+			t.Fatal(err)
+		}
+
+		repo, err := memorydb.OpenSingerRepository(crashed, memorydb.DurableOptions{})
+		if err != nil {
+			t.Fatalf("cut at %d: reopen: %v", cut, err)
+		}
+		if _, err := repo.Get(ctx, 6); err != nil {
+			t.Fatalf("cut at %d: record before the torn one was lost: %v", cut, err)
+		}
+		if _, err := repo.Get(ctx, 7); !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("cut at %d: torn record was applied: %v", cut, err)
+		}
+
+		// 途切れたレコードは取り除かれているので、続けて追記したレコードも次の起動で読める
+		henry := &model.Singer{Name: "Henry"}
+		if err := repo.Add(ctx, henry); err != nil {
+			t.Fatalf("cut at %d: Add after recovery: %v", cut, err)
+		}
+		repo.Close()
+		repo, err = memorydb.OpenSingerRepository(crashed, memorydb.DurableOptions{})
+		if err != nil {
+			t.Fatalf("cut at %d: second reopen: %v", cut, err)
+		}
+		if s, err := repo.Get(ctx, henry.ID); err != nil || s.Name != "Henry" {
+			t.Fatalf("cut at %d: record appended after recovery: got %+v, %v", cut, s, err)
+		}
+		repo.Close()
+	}
+}
+
+func TestDurableSingerRepositoryDropsRecordWithBadChecksum(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	walPath := filepath.Join(dir, "singers.wal")
+
+	repo, err := memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(ctx, &model.Singer{Name: "Frank"}); err != nil {
+		t.Fatal(err)
+	}
+	repo.Close()
+
+	b, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-2] ^= 0xff // ヘッダーの長さは正しいまま本体の 1 バイトを壊す
+	if err := os.WriteFile(walPath, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err = memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	if _, err := repo.Get(ctx, 6); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("record with bad checksum was applied: %v", err)
+	}
+	if fileSize(t, walPath) != 0 {
+		t.Fatal("record with bad checksum was not truncated")
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi.Size()
+}
+
+// copyDir は dir の中のファイルを新しい一時ディレクトリにコピーする
+func copyDir(t *testing.T, dir string) string {
+	t.Helper()
+	dst := t.TempDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dst, e.Name()), b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dst
+}
+
+// readRecordsForTest はログのレコードの長さだけをたどってレコードを数える
+func readRecordsForTest(t *testing.T, path string) [][]byte {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records [][]byte
+	for len(b) >= 8 {
+		size := int(b[0]) | int(b[1])<<8 | int(b[2])<<16 | int(b[3])<<24
+		records = append(records, b[8:8+size])
+		b = b[8+size:]
+	}
+	return records
+}
@@ -0,0 +1,14 @@
+package memorydb
+
+import "os"
+
+// BreakLogForTest はアルバムのログファイルを読み取り専用で開き直して、以降のログへの追記を失敗させる（テスト用）
+func BreakLogForTest(r *albumRepository) error {
+	f, err := os.Open(r.journal.walPath)
+	if err != nil {
+		return err
+	}
+	r.journal.wal.Close()
+	r.journal.wal = f
+	return nil
+}
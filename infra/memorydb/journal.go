@@ -0,0 +1,294 @@
+// memorydb の変更を追記専用のログ（WAL）とスナップショットでファイルに永続化するためのファイル
+
+package memorydb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// DurableOptions は OpenSingerRepository / OpenAlbumRepository で永続化するときの設定
+type DurableOptions struct {
+	SnapshotEvery int // ログにこの件数のレコードが溜まるたびにスナップショットを書き、ログを空にする（0 の場合は defaultSnapshotEvery）
+}
+
+const (
+	defaultSnapshotEvery = 1000
+	maxRecordSize        = 16 << 20 // これより大きいレコード長は壊れたヘッダーとみなす
+	recordHeaderSize     = 8        // レコード長（4 バイト）と CRC-32C（4 バイト）
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// walRecord はログの 1 レコード。Op が "put" の場合は Data に要素全体を、"delete" の場合は ID だけを持つ
+// put は要素全体で上書きし delete は存在しなくても成功するので、同じレコードを何度適用しても結果は変わらない
+type walRecord struct {
+	Op   string          `json:"op"`
+	ID   int             `json:"id"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// snapshotData はスナップショットファイルの中身。Items は要素のスライスを JSON にしたもの
+type snapshotData struct {
+	NextID int             `json:"next_id"`
+	Items  json.RawMessage `json:"items"`
+}
+
+// journal は 1 つのリポジトリの WAL ファイル（<name>.wal）とスナップショットファイル（<name>.snapshot）を扱う
+// メソッドはリポジトリの書き込み用のロックを取得した状態で呼び出すこと
+type journal struct {
+	walPath       string
+	snapshotPath  string
+	wal           *os.File
+	records       int // 最後のスナップショット以降にログに追記したレコード数
+	snapshotEvery int
+}
+
+// openJournal は dir の中のスナップショットとログを読み込んで journal を開く
+// ログの末尾が書き込みの途中で途切れている（またはチェックサムが一致しない）場合は、最後の完全なレコードまでで切り詰める
+// スナップショットもログもない場合（初回起動）は snapshot に nil を返す
+func openJournal(dir, name string, opts DurableOptions) (j *journal, snapshot *snapshotData, records []walRecord, err error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, nil, err
+	}
+	j = &journal{
+		walPath:       filepath.Join(dir, name+".wal"),
+		snapshotPath:  filepath.Join(dir, name+".snapshot"),
+		snapshotEvery: opts.SnapshotEvery,
+	}
+	if j.snapshotEvery <= 0 {
+		j.snapshotEvery = defaultSnapshotEvery
+	}
+
+	if b, err := os.ReadFile(j.snapshotPath); err == nil {
+		snapshot = &snapshotData{}
+		if err := json.Unmarshal(b, snapshot); err != nil {
+			return nil, nil, nil, fmt.Errorf("read snapshot %s: %w", j.snapshotPath, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil, err
+	}
+
+	j.wal, err = os.OpenFile(j.walPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	records, valid, err := readRecords(j.wal)
+	if err != nil {
+		j.wal.Close()
+		return nil, nil, nil, fmt.Errorf("read log %s: %w", j.walPath, err)
+	}
+	// 途切れたレコードを取り除き、その位置から追記する
+	if err := j.wal.Truncate(valid); err != nil {
+		j.wal.Close()
+		return nil, nil, nil, err
+	}
+	if _, err := j.wal.Seek(valid, io.SeekStart); err != nil {
+		j.wal.Close()
+		return nil, nil, nil, err
+	}
+	j.records = len(records)
+	return j, snapshot, records, nil
+}
+
+// readRecords はログを先頭から読み、完全なレコードと、最後の完全なレコードの終わりの位置を返す
+func readRecords(f *os.File) ([]walRecord, int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	r := bufio.NewReader(f)
+	var records []walRecord
+	var valid int64
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return records, valid, nil // EOF またはヘッダーの途中で途切れている
+		}
+		size := binary.LittleEndian.Uint32(header[0:4])
+		if size > maxRecordSize {
+			return records, valid, nil
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return records, valid, nil // 本体の途中で途切れている
+		}
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+			return records, valid, nil // 書き込みの途中でクラッシュしたレコード
+		}
+		var rec walRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return nil, 0, err // チェックサムが一致するのに読めない場合はログそのものが壊れている
+		}
+		records = append(records, rec)
+		valid += int64(recordHeaderSize) + int64(size)
+	}
+}
+
+// journalMark はログの末尾の位置と、その時点のレコード数
+type journalMark struct {
+	offset  int64
+	records int
+}
+
+// mark は現在のログの末尾を返す（rewind で書き込みを取り消すため）
+func (j *journal) mark() (journalMark, error) {
+	offset, err := j.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return journalMark{}, err
+	}
+	return journalMark{offset: offset, records: j.records}, nil
+}
+
+// rewind はログを m の位置まで切り詰め、それ以降に追記したレコード（途中まで書き込んだレコードを含む）を取り除く
+func (j *journal) rewind(m journalMark) error {
+	if err := j.wal.Truncate(m.offset); err != nil {
+		return err
+	}
+	if _, err := j.wal.Seek(m.offset, io.SeekStart); err != nil {
+		return err
+	}
+	if err := j.wal.Sync(); err != nil {
+		return err
+	}
+	j.records = m.records
+	return nil
+}
+
+// append はレコードをログに追記し、fsync でディスクに書き込まれるまで待つ
+// 失敗した場合は追記する前の位置まで切り詰めるので、途中まで書き込んだレコードの後ろに次のレコードが追記されることはない
+func (j *journal) append(rec walRecord) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[recordHeaderSize:], payload)
+
+	m, err := j.mark()
+	if err != nil {
+		return err
+	}
+	if _, err := j.wal.Write(buf); err != nil {
+		j.rewind(m)
+		return err
+	}
+	if err := j.wal.Sync(); err != nil {
+		j.rewind(m)
+		return err
+	}
+	j.records++
+	return nil
+}
+
+// putRecord は要素全体を持つ put レコードを作る。トランザクションの中で後から要素が変更されても影響を受けないように、この時点で JSON にする
+func putRecord(id int, v any) (walRecord, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return walRecord{}, err
+	}
+	return walRecord{Op: opPut, ID: id, Data: data}, nil
+}
+
+// deleteRecord は delete レコードを作る
+func deleteRecord(id int) walRecord {
+	return walRecord{Op: opDelete, ID: id}
+}
+
+// write はレコードをログに追記する。トランザクションの中ではコミットするときまで追記を遅らせる
+func (j *journal) write(tx *memTx, rec walRecord) error {
+	if tx == nil {
+		return j.append(rec)
+	}
+	tx.addJournal(j)
+	tx.addCommit(func() error { return j.append(rec) })
+	return nil
+}
+
+// needsSnapshot はログに溜まったレコード数がスナップショットを書く件数に達しているかを返す
+func (j *journal) needsSnapshot() bool {
+	return j.records >= j.snapshotEvery
+}
+
+// writeSnapshot は現在の状態をスナップショットファイルに書き、ログを空にする
+// 一時ファイルに書いてから rename するので、途中でクラッシュしても古いスナップショットとログが残る
+// rename の後、ログを空にする前にクラッシュした場合も、ログのレコードを再適用するだけなので結果は変わらない
+func (j *journal) writeSnapshot(nextID int, items any) error {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(snapshotData{NextID: nextID, Items: data})
+	if err != nil {
+		return err
+	}
+
+	tmp := j.snapshotPath + ".tmp"
+	if err := writeFileSync(tmp, b); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.snapshotPath); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(j.snapshotPath)); err != nil {
+		return err
+	}
+
+	if err := j.wal.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.wal.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := j.wal.Sync(); err != nil {
+		return err
+	}
+	j.records = 0
+	return nil
+}
+
+// close はログファイルを閉じる
+// コミットしたレコードは append で fsync 済みなので、close せずに終了しても失われない（閉じるのはファイルディスクリプタを解放するため）
+func (j *journal) close() error {
+	return j.wal.Close()
+}
+
+// writeFileSync はファイルを作成して b を書き込み、fsync してから閉じる
+func writeFileSync(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir はディレクトリを fsync して、rename したファイルの名前をディスクに書き込む
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
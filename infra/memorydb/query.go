@@ -0,0 +1,76 @@
+// 一覧取得の絞り込み・並び替え・ページングを行うための補助関数を定義するファイル
+
+package memorydb
+
+import (
+	"sort"
+
+	"server-recruit-challenge-sample/repository"
+)
+
+// paginate は昇順に並んだ ids から req で指定された 1 ページ分を取り出し、get で要素に変換して返す
+// 絞り込みがなく ID の昇順で取得する場合に使い、マップ全体をコピーせずカーソルの位置から limit 件だけを読む
+func paginate[ID ~int, T any](ids []ID, req repository.PageRequest, get func(ID) T) (*repository.Page[T], error) {
+	order := repository.Sort{Field: repository.SortFieldID}
+	start := 0
+	if req.Cursor != "" {
+		cursor, err := repository.DecodeCursor(req.Cursor, order)
+		if err != nil {
+			return nil, err
+		}
+		start = indexAfter(ids, ID(cursor.ID))
+	}
+	end := len(ids)
+	if req.Limit > 0 && start+req.Limit < end {
+		end = start + req.Limit
+	}
+
+	page := &repository.Page[T]{Items: make([]T, 0, end-start)}
+	for _, id := range ids[start:end] {
+		page.Items = append(page.Items, get(id))
+	}
+	if end < len(ids) { // まだ続きがある場合だけ次のページのカーソルを返す
+		page.NextCursor = repository.EncodeCursor(repository.Cursor{Sort: order.String(), ID: int(ids[end-1])})
+	}
+	return page, nil
+}
+
+// paginateSorted は絞り込み済みの items を (並び替えに使う値, ID) の順に並べ、req で指定された 1 ページ分を返す
+// keyOf は並び替えに使う値を返す（ID で並べる場合は空文字を返せばよい）
+func paginateSorted[ID ~int, T any](items []T, idOf func(T) ID, keyOf func(T) string, order repository.Sort, req repository.PageRequest) (*repository.Page[T], error) {
+	// before は a が b より前に並ぶかを返す
+	before := func(aKey string, aID ID, bKey string, bID ID) bool {
+		if aKey != bKey {
+			return (aKey < bKey) != order.Desc
+		}
+		if aID == bID {
+			return false
+		}
+		return (aID < bID) != order.Desc
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return before(keyOf(items[i]), idOf(items[i]), keyOf(items[j]), idOf(items[j]))
+	})
+
+	start := 0
+	if req.Cursor != "" {
+		cursor, err := repository.DecodeCursor(req.Cursor, order)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(items), func(i int) bool {
+			return before(cursor.Key, ID(cursor.ID), keyOf(items[i]), idOf(items[i]))
+		})
+	}
+	end := len(items)
+	if req.Limit > 0 && start+req.Limit < end {
+		end = start + req.Limit
+	}
+
+	page := &repository.Page[T]{Items: items[start:end]}
+	if end < len(items) { // まだ続きがある場合だけ次のページのカーソルを返す
+		last := items[end-1]
+		page.NextCursor = repository.EncodeCursor(repository.Cursor{Sort: order.String(), Key: keyOf(last), ID: int(idOf(last))})
+	}
+	return page, nil
+}
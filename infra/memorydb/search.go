@@ -0,0 +1,55 @@
+// メモリ内の歌手とアルバムの転置インデックスを使って全文検索するリポジトリを実装するためのファイル
+
+package memorydb
+
+import (
+	"context"
+
+	"server-recruit-challenge-sample/infra/fulltext"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// searchRepository 構造体は歌手とアルバムのリポジトリを持ち、それぞれが Add / Update / Delete のたびに更新している転置インデックスで検索する
+type searchRepository struct {
+	singers *singerRepository
+	albums  *albumRepository
+}
+
+// インターフェースが正しく実装されていることを確認するためのコード
+var _ repository.SearchRepository = (*searchRepository)(nil)
+
+// NewSearchRepository は歌手とアルバムのリポジトリの転置インデックスを使う検索用のリポジトリを生成する
+func NewSearchRepository(singers *singerRepository, albums *albumRepository) *searchRepository {
+	return &searchRepository{singers: singers, albums: albums}
+}
+
+// Search は歌手の名前とアルバムのタイトルを検索する。リポジトリごとに読み取り用のロックを取得する
+func (r *searchRepository) Search(ctx context.Context, query repository.SearchQuery) ([]*model.SearchHit, error) {
+	var hits []*model.SearchHit
+	if fulltext.Includes(query.Types, model.SearchTypeSinger) {
+		hits = append(hits, r.singers.search(ctx, query.Text)...)
+	}
+	if fulltext.Includes(query.Types, model.SearchTypeAlbum) {
+		hits = append(hits, r.albums.search(ctx, query.Text)...)
+	}
+	return fulltext.SortHits(hits, query.Limit), nil
+}
+
+// search は歌手の名前を転置インデックスで検索する。読み取り用のロックを取得する
+func (r *singerRepository) search(ctx context.Context, text string) []*model.SearchHit {
+	defer lockForRead(ctx, r)()
+
+	return fulltext.Hits(model.SearchTypeSinger, r.index.Search(text), func(id int) string {
+		return r.singerMap[model.SingerID(id)].Name
+	})
+}
+
+// search はアルバムのタイトルを転置インデックスで検索する。読み取り用のロックを取得する
+func (r *albumRepository) search(ctx context.Context, text string) []*model.SearchHit {
+	defer lockForRead(ctx, r)()
+
+	return fulltext.Hits(model.SearchTypeAlbum, r.index.Search(text), func(id int) string {
+		return r.albumMap[model.AlbumID(id)].Title
+	})
+}
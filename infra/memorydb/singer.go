@@ -4,9 +4,12 @@ package memorydb // このファイルが memorydb パッケージであるこ
 
 import (
 	"context"
-	"errors"
+	"sort"
 	"sync"
+	"time"
 
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/infra/fulltext"
 	"server-recruit-challenge-sample/model"
 	"server-recruit-challenge-sample/repository"
 )
@@ -16,6 +19,11 @@ import (
 type singerRepository struct {
 	sync.RWMutex
 	singerMap map[model.SingerID]*model.Singer // キーが SingerID、値が model.Singer のマップ
+	ids       []model.SingerID                 // singerMap のキーを昇順に並べたスライス（一覧取得の順序とページングに使う）
+	trash     map[model.SingerID]*model.Singer // ゴミ箱に移動した（DeletedAt が設定された）歌手。singerMap と ids と index には含めない
+	index     *fulltext.Index                  // 名前の全文検索用の転置インデックス（文書IDは SingerID）
+	nextID    model.SingerID                   // 次に採番する歌手ID（単調増加し、削除されたIDを再利用しない）
+	journal   *journal                         // 変更を書き込むログ（OpenSingerRepository で開いた場合だけ。nil の場合は永続化しない）
 }
 
 // インターフェースが正しく実装されていることを確認するためのコード
@@ -24,54 +32,259 @@ var _ repository.SingerRepository = (*singerRepository)(nil)
 // 歌手データを保持するための簡単なデータベース（インメモリデータベース）を初期化する
 func NewSingerRepository() *singerRepository {
 	var initMap = map[model.SingerID]*model.Singer{
-		1: {ID: 1, Name: "Alice"},
-		2: {ID: 2, Name: "Bella"},
-		3: {ID: 3, Name: "Chris"},
-		4: {ID: 4, Name: "Daisy"},
-		5: {ID: 5, Name: "Ellen"},
+		1: {ID: 1, Name: "Alice", Version: 1},
+		2: {ID: 2, Name: "Bella", Version: 1},
+		3: {ID: 3, Name: "Chris", Version: 1},
+		4: {ID: 4, Name: "Daisy", Version: 1},
+		5: {ID: 5, Name: "Ellen", Version: 1},
 	}
 
-	return &singerRepository{
-		singerMap: initMap,
+	r := &singerRepository{
+		singerMap: make(map[model.SingerID]*model.Singer, len(initMap)),
+		trash:     make(map[model.SingerID]*model.Singer),
+		index:     fulltext.NewIndex(),
+		nextID:    6,
 	}
+	for _, singer := range initMap {
+		r.put(singer)
+	}
+	return r
 }
 
-// GetAll は歌手データを全件取得する。読み取り用のロックを取得し、歌手データをスライスにコピーして返す。
+// GetAll は歌手データを全件取得する。読み取り用のロックを取得し、歌手データをID順にスライスにコピーして返す。
 func (r *singerRepository) GetAll(ctx context.Context) ([]*model.Singer, error) {
-	r.RLock()
-	defer r.RUnlock()
+	defer lockForRead(ctx, r)()
 
-	singers := make([]*model.Singer, 0, len(r.singerMap))
-	for _, s := range r.singerMap {
-		singers = append(singers, s)
+	singers := make([]*model.Singer, 0, len(r.ids))
+	for _, id := range r.ids {
+		singers = append(singers, cloneSinger(r.singerMap[id]))
 	}
 	return singers, nil
 }
 
+// List は条件に合う歌手データを指定された順にページ単位で取得する。読み取り用のロックを取得する。
+// 絞り込みがなく ID の昇順で取得する場合は、カーソルの位置から指定された件数だけを読む。
+// query.IncludeDeleted が true の場合はゴミ箱の歌手も含める。
+func (r *singerRepository) List(ctx context.Context, query repository.SingerQuery) (*repository.Page[*model.Singer], error) {
+	defer lockForRead(ctx, r)()
+
+	includeTrash := query.IncludeDeleted && len(r.trash) > 0
+	if query.NamePrefix == "" && query.NameEquals == "" && query.Sort.String() == repository.SortFieldID && !includeTrash {
+		return paginate(r.ids, query.Page, func(id model.SingerID) *model.Singer { return cloneSinger(r.singerMap[id]) })
+	}
+
+	prefix := model.NormalizeText(query.NamePrefix)
+	name := model.NormalizeText(query.NameEquals)
+	singers := make([]*model.Singer, 0)
+	match := func(singer *model.Singer) {
+		if (prefix == "" || singer.HasNamePrefix(prefix)) && (name == "" || singer.NameKey() == name) {
+			singers = append(singers, singer)
+		}
+	}
+	for _, id := range r.ids {
+		match(r.singerMap[id])
+	}
+	if includeTrash {
+		for _, singer := range r.trash {
+			match(singer)
+		}
+	}
+
+	keyOf := func(*model.Singer) string { return "" }
+	if query.Sort.Field == repository.SortFieldName {
+		keys := make(map[model.SingerID]string, len(singers)) // 並び替えの比較のたびに正規化しないように先に求めておく
+		for _, singer := range singers {
+			keys[singer.ID] = singer.SortKey()
+		}
+		keyOf = func(s *model.Singer) string { return keys[s.ID] }
+	}
+	page, err := paginateSorted(singers, func(s *model.Singer) model.SingerID { return s.ID }, keyOf, query.Sort, query.Page)
+	if err != nil {
+		return nil, err
+	}
+	page.Items = cloneAll(page.Items, cloneSinger)
+	return page, nil
+}
+
 // Get は歌手IDに対応する歌手データを取得する。読み取り用のロックを取得し、指定されたIDの歌手が存在しない場合はエラーを返す。
 func (r *singerRepository) Get(ctx context.Context, id model.SingerID) (*model.Singer, error) {
-	r.RLock()
-	defer r.RUnlock()
+	defer lockForRead(ctx, r)()
 
 	singer, ok := r.singerMap[id]
 	if !ok {
-		return nil, errors.New("not found")
+		return nil, apperror.NotFound(apperror.CodeSingerNotFound, "singer %d not found", id)
 	}
-	return singer, nil
+	return cloneSinger(singer), nil
+}
+
+// GetByIDs は複数の歌手IDに対応する歌手データをまとめて取得する。読み取り用のロックを一度だけ取得し、存在しないIDは結果に含めない。
+func (r *singerRepository) GetByIDs(ctx context.Context, ids []model.SingerID) (map[model.SingerID]*model.Singer, error) {
+	defer lockForRead(ctx, r)()
+
+	singers := make(map[model.SingerID]*model.Singer, len(ids))
+	for _, id := range ids {
+		if singer, ok := r.singerMap[id]; ok {
+			singers[id] = cloneSinger(singer)
+		}
+	}
+	return singers, nil
+}
+
+// LockByIDs は GetByIDs と同じ。トランザクションはすべてのリポジトリの書き込み用のロックを持っているので、コミットするまでほかのトランザクションが歌手を変更することはない
+func (r *singerRepository) LockByIDs(ctx context.Context, ids []model.SingerID) (map[model.SingerID]*model.Singer, error) {
+	return r.GetByIDs(ctx, ids)
 }
 
 // Add は新しい歌手を追加する。書き込み用のロックを取得し、歌手を singerMap に追加する。
+// ID が 0 の場合は nextID から採番し、指定された ID がすでに存在する場合はエラーを返す。
 func (r *singerRepository) Add(ctx context.Context, singer *model.Singer) error {
-	r.Lock()
-	r.singerMap[singer.ID] = singer
-	r.Unlock()
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	if singer.ID == 0 {
+		singer.ID = r.nextID
+	} else if r.exists(singer.ID) {
+		return apperror.AlreadyExists(apperror.CodeSingerAlreadyExists, "singer %d already exists", singer.ID)
+	}
+	singer.Version = 1
+	singer.DeletedAt = nil                       // 削除日時は Delete と Restore だけが変更する
+	if err := r.logPut(tx, singer); err != nil { // メモリ上のデータを変更する前にログに書き込む
+		return err
+	}
+	r.put(cloneSinger(singer)) // 呼び出し側が後から singer を書き換えても影響を受けないようにコピーを保存する
+	id := singer.ID
+	tx.addUndo(func() { r.remove(id) })
+	r.compact(tx)
+	return nil
+}
+
+// Update は歌手データを置き換える。書き込み用のロックを取得し、指定されたIDの歌手が存在しない場合やバージョンが一致しない場合はエラーを返す。
+func (r *singerRepository) Update(ctx context.Context, singer *model.Singer) error {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	current, ok := r.singerMap[singer.ID]
+	if !ok {
+		return apperror.NotFound(apperror.CodeSingerNotFound, "singer %d not found", singer.ID)
+	}
+	if singer.Version != 0 && singer.Version != current.Version {
+		return apperror.Precondition(apperror.CodeVersionMismatch, "singer %d has version %d, not %d", singer.ID, current.Version, singer.Version)
+	}
+	singer.Version = current.Version + 1
+	singer.DeletedAt = nil
+	if err := r.logPut(tx, singer); err != nil {
+		singer.Version = current.Version
+		return err
+	}
+	r.put(cloneSinger(singer))
+	tx.addUndo(func() { r.put(current) })
+	r.compact(tx)
 	return nil
 }
 
-// Delete は指定された歌手IDに対応する歌手を削除する。書き込み用のロックを取得し、singerMap から指定されたIDの歌手を削除する
-func (r *singerRepository) Delete(ctx context.Context, id model.SingerID) error {
-	r.Lock()
-	delete(r.singerMap, id)
-	r.Unlock()
+// Delete は指定された歌手IDに対応する歌手をゴミ箱に移動する。書き込み用のロックを取得し、DeletedAt を設定してバージョンを上げる
+// 指定されたIDの歌手が存在しない（すでにゴミ箱に入っている）場合や、version が 0 以外で現在のバージョンと一致しない場合は削除せずにエラーを返す
+func (r *singerRepository) Delete(ctx context.Context, id model.SingerID, version model.Version) error {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	current, ok := r.singerMap[id]
+	if !ok {
+		return apperror.NotFound(apperror.CodeSingerNotFound, "singer %d not found", id)
+	}
+	if version != 0 && version != current.Version {
+		return apperror.Precondition(apperror.CodeVersionMismatch, "singer %d has version %d, not %d", id, current.Version, version)
+	}
+
+	deleted := cloneSinger(current)
+	now := time.Now().UTC()
+	deleted.DeletedAt = &now
+	deleted.Version++
+	if err := r.logPut(tx, deleted); err != nil {
+		return err
+	}
+	r.put(deleted)
+	tx.addUndo(func() { r.put(current) })
+	r.compact(tx)
 	return nil
 }
+
+// Restore はゴミ箱の歌手を元に戻す。書き込み用のロックを取得し、DeletedAt を消してバージョンを上げる
+func (r *singerRepository) Restore(ctx context.Context, id model.SingerID) (*model.Singer, error) {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	current, ok := r.trash[id]
+	if !ok {
+		return nil, apperror.NotFound(apperror.CodeSingerNotFound, "singer %d is not in the trash", id)
+	}
+
+	restored := cloneSinger(current)
+	restored.DeletedAt = nil
+	restored.Version++
+	if err := r.logPut(tx, restored); err != nil {
+		return nil, err
+	}
+	r.put(restored)
+	tx.addUndo(func() { r.put(current) })
+	r.compact(tx)
+	return cloneSinger(restored), nil
+}
+
+// Purge は deletedBefore より前にゴミ箱に移動した歌手を完全に削除する。書き込み用のロックを取得する
+func (r *singerRepository) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	var ids []model.SingerID
+	for id, singer := range r.trash {
+		if singer.DeletedAt.Before(deletedBefore) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for n, id := range ids {
+		if err := r.logDelete(tx, id); err != nil {
+			return n, err
+		}
+		current := r.trash[id]
+		r.remove(id)
+		tx.addUndo(func() { r.put(current) })
+	}
+	r.compact(tx)
+	return len(ids), nil
+}
+
+// exists は歌手IDがゴミ箱も含めて使われているかを返す。呼び出し側でロックを取得しておくこと。
+func (r *singerRepository) exists(id model.SingerID) bool {
+	_, live := r.singerMap[id]
+	_, trashed := r.trash[id]
+	return live || trashed
+}
+
+// put は歌手を登録し、nextID を進める。DeletedAt が設定されている場合はゴミ箱に、そうでない場合は singerMap と ids に登録する。
+// 呼び出し側で書き込み用のロックを取得しておくこと。
+func (r *singerRepository) put(singer *model.Singer) {
+	r.remove(singer.ID)
+	if singer.DeletedAt != nil {
+		r.trash[singer.ID] = singer
+	} else {
+		r.singerMap[singer.ID] = singer
+		r.ids = insertID(r.ids, singer.ID)
+		r.index.Add(int(singer.ID), singer.Name, singer.NameKana, singer.NameRomaji) // 読みとローマ字表記でも検索できるようにする
+	}
+	if singer.ID >= r.nextID {
+		r.nextID = singer.ID + 1
+	}
+}
+
+// remove は singerMap と ids と index とゴミ箱のすべてから歌手を削除する。呼び出し側で書き込み用のロックを取得しておくこと。
+func (r *singerRepository) remove(id model.SingerID) {
+	if _, ok := r.singerMap[id]; ok {
+		delete(r.singerMap, id)
+		r.ids = removeID(r.ids, id)
+		r.index.Remove(int(id))
+	}
+	delete(r.trash, id)
+}
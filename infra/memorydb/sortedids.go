@@ -0,0 +1,32 @@
+// ID の昇順に並んだスライスを扱うための補助関数を定義するファイル
+// 一覧取得を ID 順に安定させ、ページングのたびにマップ全体をコピー・ソートしなくて済むようにする
+
+package memorydb
+
+import "sort"
+
+// insertID は昇順に並んだ ids に id を挿入したスライスを返す（すでに含まれている場合はそのまま返す）
+func insertID[T ~int](ids []T, id T) []T {
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+	if i < len(ids) && ids[i] == id {
+		return ids
+	}
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	return ids
+}
+
+// removeID は昇順に並んだ ids から id を取り除いたスライスを返す
+func removeID[T ~int](ids []T, id T) []T {
+	i := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+	if i == len(ids) || ids[i] != id {
+		return ids
+	}
+	return append(ids[:i], ids[i+1:]...)
+}
+
+// indexAfter は昇順に並んだ ids の中で id より大きい最初の要素の位置を返す
+func indexAfter[T ~int](ids []T, id T) int {
+	return sort.Search(len(ids), func(i int) bool { return ids[i] > id })
+}
@@ -0,0 +1,213 @@
+// メモリ内で曲データを保持するためのデータベース（インメモリデータベース）を実装するためのファイル
+
+package memorydb
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// sync.RWMutex を埋め込み、trackMap フィールドで曲データを保持
+// TrackID をキーとし、model.Track を値とするマップ
+type trackRepository struct {
+	sync.RWMutex
+	trackMap   map[model.TrackID]*model.Track               // キーが TrackID、値が model.Track のマップ
+	albumIndex map[model.AlbumID]map[model.TrackID]struct{} // アルバムIDごとの曲IDの集合（ListByAlbum 用のインデックス）
+	nextID     model.TrackID                                // 次に採番する曲ID（単調増加し、削除されたIDを再利用しない）
+	journal    *journal                                     // 変更を書き込むログ（OpenTrackRepository で開いた場合だけ。nil の場合は永続化しない）
+}
+
+// インターフェースが正しく実装されていることを確認するためのコード
+var _ repository.TrackRepository = (*trackRepository)(nil)
+
+// 曲データを持たない trackRepository インスタンスを返す
+func NewTrackRepository() *trackRepository {
+	return &trackRepository{
+		trackMap:   make(map[model.TrackID]*model.Track),
+		albumIndex: make(map[model.AlbumID]map[model.TrackID]struct{}),
+		nextID:     1,
+	}
+}
+
+// ListByAlbum は指定されたアルバムIDに紐づく曲を曲順に取得する。読み取り用のロックを取得し、albumIndex から対象の曲だけを取り出す。
+func (r *trackRepository) ListByAlbum(ctx context.Context, albumID model.AlbumID) ([]*model.Track, error) {
+	defer lockForRead(ctx, r)()
+
+	ids := r.albumIndex[albumID]
+	tracks := make([]*model.Track, 0, len(ids))
+	for id := range ids {
+		tracks = append(tracks, cloneTrack(r.trackMap[id]))
+	}
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i].Number < tracks[j].Number })
+	return tracks, nil
+}
+
+// Get は曲IDに対応する曲データを取得する。読み取り用のロックを取得し、指定されたIDの曲が存在しない場合はエラーを返す。
+func (r *trackRepository) Get(ctx context.Context, id model.TrackID) (*model.Track, error) {
+	defer lockForRead(ctx, r)()
+
+	track, ok := r.trackMap[id]
+	if !ok {
+		return nil, apperror.NotFound(apperror.CodeTrackNotFound, "track %d not found", id)
+	}
+	return cloneTrack(track), nil
+}
+
+// Add は新しい曲を追加する。書き込み用のロックを取得し、曲を trackMap に追加する。
+// ID が 0 の場合は nextID から採番し、Number が 0 の場合はアルバムの最後の曲順の次にする。
+// 指定された ID がすでに存在する場合や、同じアルバムに同じ曲順の曲がある場合はエラーを返す。
+func (r *trackRepository) Add(ctx context.Context, track *model.Track) error {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	if track.ID == 0 {
+		track.ID = r.nextID
+	} else if _, ok := r.trackMap[track.ID]; ok {
+		return apperror.AlreadyExists(apperror.CodeTrackAlreadyExists, "track %d already exists", track.ID)
+	}
+	if track.Number == 0 {
+		track.Number = r.lastNumber(track.AlbumID) + 1
+	} else if err := r.checkNumber(track); err != nil {
+		return err
+	}
+	track.Version = 1
+	if err := r.logPut(tx, track); err != nil { // メモリ上のデータを変更する前にログに書き込む
+		return err
+	}
+	r.put(cloneTrack(track))
+	id := track.ID
+	tx.addUndo(func() { r.remove(id) })
+	r.compact(tx)
+	return nil
+}
+
+// Update は曲データを置き換える。書き込み用のロックを取得し、指定されたIDの曲が存在しない場合やバージョンが一致しない場合はエラーを返す。
+// Number が 0 の場合は現在の曲順のままにする。
+func (r *trackRepository) Update(ctx context.Context, track *model.Track) error {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	current, ok := r.trackMap[track.ID]
+	if !ok {
+		return apperror.NotFound(apperror.CodeTrackNotFound, "track %d not found", track.ID)
+	}
+	if track.Version != 0 && track.Version != current.Version {
+		return apperror.Precondition(apperror.CodeVersionMismatch, "track %d has version %d, not %d", track.ID, current.Version, track.Version)
+	}
+	if track.Number == 0 {
+		track.Number = current.Number
+	}
+	if err := r.checkNumber(track); err != nil {
+		return err
+	}
+	track.Version = current.Version + 1
+	if err := r.logPut(tx, track); err != nil {
+		track.Version = current.Version
+		return err
+	}
+	r.put(cloneTrack(track))
+	tx.addUndo(func() { r.put(current) })
+	r.compact(tx)
+	return nil
+}
+
+// Delete は指定された曲IDに対応する曲を削除する。書き込み用のロックを取得し、trackMap から指定されたIDの曲を削除する
+// 指定されたIDの曲が存在しない場合や、version が 0 以外で現在のバージョンと一致しない場合は削除せずにエラーを返す
+func (r *trackRepository) Delete(ctx context.Context, id model.TrackID, version model.Version) error {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	current, ok := r.trackMap[id]
+	if !ok {
+		return apperror.NotFound(apperror.CodeTrackNotFound, "track %d not found", id)
+	}
+	if version != 0 && version != current.Version {
+		return apperror.Precondition(apperror.CodeVersionMismatch, "track %d has version %d, not %d", id, current.Version, version)
+	}
+	if err := r.logDelete(tx, id); err != nil {
+		return err
+	}
+	r.remove(id)
+	tx.addUndo(func() { r.put(current) })
+	r.compact(tx)
+	return nil
+}
+
+// DeleteByAlbum は指定されたアルバムIDに紐づく曲をすべて削除し、削除した件数を返す。書き込み用のロックを取得する
+func (r *trackRepository) DeleteByAlbum(ctx context.Context, albumID model.AlbumID) (int, error) {
+	tx, unlock := lockForWrite(ctx, r)
+	defer unlock()
+
+	ids := make([]model.TrackID, 0, len(r.albumIndex[albumID]))
+	for id := range r.albumIndex[albumID] {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for n, id := range ids {
+		if err := r.logDelete(tx, id); err != nil {
+			return n, err
+		}
+		current := r.trackMap[id]
+		r.remove(id)
+		tx.addUndo(func() { r.put(current) })
+	}
+	r.compact(tx)
+	return len(ids), nil
+}
+
+// lastNumber はアルバムの中で最も大きい曲順を返す（曲がない場合は 0）。呼び出し側でロックを取得しておくこと。
+func (r *trackRepository) lastNumber(albumID model.AlbumID) int {
+	last := 0
+	for id := range r.albumIndex[albumID] {
+		if n := r.trackMap[id].Number; n > last {
+			last = n
+		}
+	}
+	return last
+}
+
+// checkNumber は同じアルバムにほかの曲と同じ曲順がないかを確認する。呼び出し側でロックを取得しておくこと。
+func (r *trackRepository) checkNumber(track *model.Track) error {
+	for id := range r.albumIndex[track.AlbumID] {
+		if id != track.ID && r.trackMap[id].Number == track.Number {
+			return apperror.Conflict(apperror.CodeTrackNumberTaken, "album %d already has track number %d", track.AlbumID, track.Number)
+		}
+	}
+	return nil
+}
+
+// put は trackMap と albumIndex の両方に曲を登録し、nextID を進める。呼び出し側で書き込み用のロックを取得しておくこと。
+func (r *trackRepository) put(track *model.Track) {
+	if track.ID >= r.nextID {
+		r.nextID = track.ID + 1
+	}
+	r.remove(track.ID) // 同じIDの曲を上書きする場合、以前のアルバムのインデックスから外す
+	r.trackMap[track.ID] = track
+	ids, ok := r.albumIndex[track.AlbumID]
+	if !ok {
+		ids = make(map[model.TrackID]struct{})
+		r.albumIndex[track.AlbumID] = ids
+	}
+	ids[track.ID] = struct{}{}
+}
+
+// remove は trackMap と albumIndex の両方から曲を削除する。呼び出し側で書き込み用のロックを取得しておくこと。
+func (r *trackRepository) remove(id model.TrackID) {
+	track, ok := r.trackMap[id]
+	if !ok {
+		return
+	}
+	delete(r.trackMap, id)
+	if ids := r.albumIndex[track.AlbumID]; ids != nil {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(r.albumIndex, track.AlbumID)
+		}
+	}
+}
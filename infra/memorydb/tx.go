@@ -0,0 +1,166 @@
+// memorydb のリポジトリにまたがるトランザクションを実装するためのファイル
+
+package memorydb
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"server-recruit-challenge-sample/repository"
+)
+
+// transactor は NewTransactor に渡されたリポジトリの書き込み用のロックをまとめて取得してトランザクションを実行する
+type transactor struct {
+	repos []sync.Locker
+}
+
+// インターフェースが正しく実装されていることを確認するためのコード
+var _ repository.Transactor = (*transactor)(nil)
+
+// NewTransactor は repos（NewSingerRepository / NewAlbumRepository などで生成したリポジトリ）にまたがるトランザクションを実行する Transactor を生成する
+// ロックは渡された順番で取得するので、デッドロックを避けるため常に同じ順番で渡すこと
+func NewTransactor(repos ...sync.Locker) *transactor {
+	return &transactor{repos: repos}
+}
+
+// RunInTx はすべてのリポジトリの書き込み用のロックを取得したまま fn を実行する
+// fn の中の変更はすぐにメモリ上のデータに反映され、fn がエラーを返した場合（またはパニックした場合）は逆の順番で元に戻す
+// ログ（WAL）への書き込みはコミットするときにまとめて行うので、取り消された変更はログに残らない
+func (t *transactor) RunInTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if txFromContext(ctx) != nil {
+		return fn(ctx) // すでにトランザクションの中にいる場合はそのトランザクションに参加する
+	}
+
+	tx := &memTx{held: make(map[sync.Locker]bool, len(t.repos))}
+	for _, r := range t.repos {
+		r.Lock()
+		tx.held[r] = true
+	}
+	defer func() {
+		for i := len(t.repos) - 1; i >= 0; i-- {
+			t.repos[i].Unlock()
+		}
+	}()
+	defer func() {
+		if p := recover(); p != nil {
+			tx.rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		tx.rollback()
+		return err
+	}
+	return tx.commit(ctx)
+}
+
+// txKey は context にトランザクションを保存するためのキー
+type txKey struct{}
+
+// memTx は実行中のトランザクション。ロックを取得しているリポジトリと、取り消し・コミットのときに実行する処理を持つ
+type memTx struct {
+	held        map[sync.Locker]bool
+	undo        []func()
+	onCommit    []func() error
+	afterCommit []func()
+	journals    []*journal // onCommit でレコードを追記するログ
+}
+
+// txFromContext は ctx に保存されているトランザクションを返す（トランザクションの外の場合は nil）
+func txFromContext(ctx context.Context) *memTx {
+	tx, _ := ctx.Value(txKey{}).(*memTx)
+	return tx
+}
+
+// addUndo は変更を元に戻す処理を登録する（トランザクションの外の場合は何もしない）
+func (tx *memTx) addUndo(f func()) {
+	if tx != nil {
+		tx.undo = append(tx.undo, f)
+	}
+}
+
+// addCommit はコミットするときに実行する処理（ログへの書き込み）を登録する
+func (tx *memTx) addCommit(f func() error) {
+	tx.onCommit = append(tx.onCommit, f)
+}
+
+// addJournal はコミットするときにレコードを追記するログを登録する（書き込みに失敗したときにコミット前の位置まで切り詰めるため）
+func (tx *memTx) addJournal(j *journal) {
+	if !slices.Contains(tx.journals, j) {
+		tx.journals = append(tx.journals, j)
+	}
+}
+
+// addAfterCommit はコミットが成功した後に実行する処理（スナップショットの書き込み）を登録する
+func (tx *memTx) addAfterCommit(f func()) {
+	tx.afterCommit = append(tx.afterCommit, f)
+}
+
+// rollback は登録された取り消し処理を逆の順番で実行する
+func (tx *memTx) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+}
+
+// commit はログへの書き込みを実行する。失敗した場合はメモリ上の変更を元に戻してエラーを返す
+// ログはリポジトリごとに別のファイルなので、途中で失敗した場合はすべてのログをコミット前の位置まで切り詰め、書き込み済みのレコードも取り除く
+// ただし複数のファイルへの書き込みの途中でプロセスがクラッシュした場合は、一部の変更だけが残ることがある
+func (tx *memTx) commit(ctx context.Context) error {
+	marks := make([]journalMark, len(tx.journals))
+	for i, j := range tx.journals {
+		m, err := j.mark()
+		if err != nil {
+			slog.ErrorContext(ctx, "memorydb commit failed", "error", err.Error())
+			tx.rollback()
+			return err
+		}
+		marks[i] = m
+	}
+	for _, f := range tx.onCommit {
+		if err := f(); err != nil {
+			slog.ErrorContext(ctx, "memorydb commit failed", "error", err.Error())
+			for i, j := range tx.journals {
+				if err := j.rewind(marks[i]); err != nil {
+					slog.ErrorContext(ctx, "memorydb rewind log failed", "path", j.walPath, "error", err.Error())
+				}
+			}
+			tx.rollback()
+			return err
+		}
+	}
+	for _, f := range tx.afterCommit {
+		f()
+	}
+	return nil
+}
+
+// lockForWrite は書き込み用のロックを取得して、ロックを解放する関数を返す
+// ctx のトランザクションがすでにロックを取得している場合はロックせず、そのトランザクションを返す
+func lockForWrite(ctx context.Context, r sync.Locker) (*memTx, func()) {
+	if tx := txFromContext(ctx); tx != nil && tx.held[r] {
+		return tx, func() {}
+	}
+	r.Lock()
+	return nil, r.Unlock
+}
+
+// rwLocker は読み取り用のロックも取得できる sync.Locker（sync.RWMutex を埋め込んだリポジトリ）
+type rwLocker interface {
+	sync.Locker
+	RLock()
+	RUnlock()
+}
+
+// lockForRead は読み取り用のロックを取得して、ロックを解放する関数を返す
+// ctx のトランザクションがすでに書き込み用のロックを取得している場合はロックしない
+func lockForRead(ctx context.Context, r rwLocker) func() {
+	if tx := txFromContext(ctx); tx != nil && tx.held[r] {
+		return func() {}
+	}
+	r.RLock()
+	return r.RUnlock
+}
@@ -0,0 +1,257 @@
+package memorydb_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/infra/memorydb"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+func TestRunInTxRollsBackBothRepositories(t *testing.T) {
+	ctx := context.Background()
+	singers, albums := memorydb.NewSingerRepository(), memorydb.NewAlbumRepository()
+	tx := memorydb.NewTransactor(singers, albums)
+
+	errAbort := errors.New("abort")
+	err := tx.RunInTx(ctx, func(ctx context.Context) error {
+		if err := albums.Delete(ctx, 1, 0); err != nil {
+			return err
+		}
+		if err := albums.Update(ctx, &model.Album{ID: 2, Title: "Changed", SingerID: 2}); err != nil {
+			return err
+		}
+		if err := singers.Add(ctx, &model.Singer{Name: "Frank"}); err != nil {
+			return err
+		}
+		// トランザクションの中では自分の変更が見える
+		if _, err := albums.Get(ctx, 1); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("Get inside tx after Delete: got %v, want ErrNotFound", err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("RunInTx: got %v, want the error returned by fn", err)
+	}
+
+	if _, err := albums.Get(ctx, 1); err != nil {
+		t.Fatalf("deleted album was not restored: %v", err)
+	}
+	if a, _ := albums.Get(ctx, 2); a.Title != "Alice's 2nd Album" || a.Version != 1 {
+		t.Fatalf("updated album was not restored: %+v", a)
+	}
+	if got, _ := albums.ListBySinger(ctx, 1); len(got) != 2 {
+		t.Fatalf("singer index was not restored: got %d albums", len(got))
+	}
+	if all, _ := singers.GetAll(ctx); len(all) != 5 {
+		t.Fatalf("added singer was not removed: got %d singers", len(all))
+	}
+}
+
+func TestRunInTxHidesIntermediateState(t *testing.T) {
+	ctx := context.Background()
+	singers, albums := memorydb.NewSingerRepository(), memorydb.NewAlbumRepository()
+	tx := memorydb.NewTransactor(singers, albums)
+
+	deleted := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- tx.RunInTx(ctx, func(ctx context.Context) error {
+			if err := albums.Delete(ctx, 3, 0); err != nil {
+				return err
+			}
+			close(deleted)
+			<-release
+			return singers.Delete(ctx, 2, 0)
+		})
+	}()
+
+	<-deleted
+	var wg sync.WaitGroup
+	var album *model.Album
+	var albumErr, singerErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// トランザクションが終わるまで待たされ、アルバムと歌手の両方が削除された状態だけが見える
+		album, albumErr = albums.Get(ctx, 3)
+		_, singerErr = singers.Get(ctx, 2)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if !errors.Is(albumErr, apperror.ErrNotFound) || !errors.Is(singerErr, apperror.ErrNotFound) {
+		t.Fatalf("reader saw intermediate state: album=%+v albumErr=%v singerErr=%v", album, albumErr, singerErr)
+	}
+}
+
+func TestRunInTxJoinsOuterTransaction(t *testing.T) {
+	ctx := context.Background()
+	singers, albums := memorydb.NewSingerRepository(), memorydb.NewAlbumRepository()
+	tx := memorydb.NewTransactor(singers, albums)
+
+	errAbort := errors.New("abort")
+	err := tx.RunInTx(ctx, func(ctx context.Context) error {
+		if err := tx.RunInTx(ctx, func(ctx context.Context) error {
+			return singers.Delete(ctx, 5, 0)
+		}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("RunInTx: got %v", err)
+	}
+	if _, err := singers.Get(ctx, 5); err != nil {
+		t.Fatalf("change made in the inner RunInTx was not rolled back: %v", err)
+	}
+}
+
+func TestRunInTxWritesLogOnlyOnCommit(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	singers, err := memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	albums, err := memorydb.OpenAlbumRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := memorydb.NewTransactor(singers, albums)
+
+	tx.RunInTx(ctx, func(ctx context.Context) error {
+		singers.Add(ctx, &model.Singer{Name: "Rolled back"})
+		return errors.New("abort")
+	})
+	if err := tx.RunInTx(ctx, func(ctx context.Context) error {
+		if err := albums.Delete(ctx, 3, 0); err != nil {
+			return err
+		}
+		return singers.Delete(ctx, 2, 0)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	singers.Close()
+	albums.Close()
+
+	singers, err = memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer singers.Close()
+	albums, err = memorydb.OpenAlbumRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer albums.Close()
+
+	if all, _ := singers.GetAll(ctx); len(all) != 4 {
+		t.Fatalf("after reopen: got %d singers, want 4 (rolled back Add must not be in the log)", len(all))
+	}
+	if _, err := albums.Get(ctx, 3); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("committed Delete was not persisted: %v", err)
+	}
+}
+
+func TestRunInTxRewindsLogsWhenCommitFails(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	singers, err := memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	albums, err := memorydb.OpenAlbumRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := memorydb.NewTransactor(singers, albums)
+
+	// 歌手のログへの追記は成功し、アルバムのログへの追記で失敗する
+	if err := memorydb.BreakLogForTest(albums); err != nil {
+		t.Fatal(err)
+	}
+	err = tx.RunInTx(ctx, func(ctx context.Context) error {
+		if err := singers.Add(ctx, &model.Singer{ID: 10, Name: "Partially committed"}); err != nil {
+			return err
+		}
+		return albums.Add(ctx, &model.Album{ID: 10, Title: "Partially committed", SingerID: 10})
+	})
+	if err == nil {
+		t.Fatal("RunInTx: got nil, want the error from the album log")
+	}
+	if _, err := singers.Get(ctx, 10); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("failed commit was not rolled back in memory: %v", err)
+	}
+	singers.Close()
+
+	singers, err = memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer singers.Close()
+	albums, err = memorydb.OpenAlbumRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer albums.Close()
+
+	if _, err := singers.Get(ctx, 10); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("record of the failed commit was restored from the singer log: %v", err)
+	}
+	if _, err := albums.Get(ctx, 10); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("record of the failed commit was restored from the album log: %v", err)
+	}
+	if all, _ := singers.GetAll(ctx); len(all) != 5 {
+		t.Fatalf("after reopen: got %d singers, want 5", len(all))
+	}
+
+	// 切り詰めた後のログに追記したレコードは復元できる
+	if err := singers.Add(ctx, &model.Singer{ID: 11, Name: "After rewind"}); err != nil {
+		t.Fatal(err)
+	}
+	singers.Close()
+	singers, err = memorydb.OpenSingerRepository(dir, memorydb.DurableOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := singers.Get(ctx, 11); err != nil {
+		t.Fatalf("record appended after the rewind was not persisted: %v", err)
+	}
+}
+
+func TestRunInTxRollsBackSearchIndex(t *testing.T) {
+	ctx := context.Background()
+	singers, albums := memorydb.NewSingerRepository(), memorydb.NewAlbumRepository()
+	tx := memorydb.NewTransactor(singers, albums)
+	search := memorydb.NewSearchRepository(singers, albums)
+
+	errAbort := errors.New("abort")
+	err := tx.RunInTx(ctx, func(ctx context.Context) error {
+		if err := albums.Update(ctx, &model.Album{ID: 2, Title: "Changed", SingerID: 1}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("RunInTx: got %v, want the error returned by fn", err)
+	}
+
+	if hits, _ := search.Search(ctx, repository.SearchQuery{Text: "changed"}); len(hits) != 0 {
+		t.Fatalf("rolled back title is still indexed: %+v", hits)
+	}
+	hits, _ := search.Search(ctx, repository.SearchQuery{Text: "2nd"})
+	if len(hits) != 1 || hits[0].ID != 2 || hits[0].Text != "Alice's 2nd Album" {
+		t.Fatalf("original title was not re-indexed: %+v", hits)
+	}
+}
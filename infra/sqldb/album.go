@@ -0,0 +1,340 @@
+// RDB の albums テーブルでアルバムデータを保持するリポジトリを実装するためのファイル
+
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// albumRepository 構造体は DB を持ち、albums テーブルに対してアルバムデータを読み書きする
+type albumRepository struct {
+	db *DB
+}
+
+// インターフェースが正しく実装されていることを確認するためのコード
+var _ repository.AlbumRepository = (*albumRepository)(nil)
+
+// NewAlbumRepository は albums テーブルを使うアルバムのリポジトリを生成する
+func NewAlbumRepository(db *DB) *albumRepository {
+	return &albumRepository{db: db}
+}
+
+// albumColumns は SELECT する列（scanAlbum の引数と同じ順番）
+const albumColumns = `id, title, singer_id, release_date, genres, version, deleted_at`
+
+// scanAlbum は 1 行分のアルバムデータを読み込む。歌手が削除されて singer_id が NULL の場合は SingerID を 0 にする
+func scanAlbum(row scanner) (*model.Album, error) {
+	var album model.Album
+	var singerID, deleted sql.NullInt64
+	var genres string
+	if err := row.Scan(&album.ID, &album.Title, &singerID, &album.ReleaseDate, &genres, &album.Version, &deleted); err != nil {
+		return nil, err
+	}
+	album.SingerID = model.SingerID(singerID.Int64)
+	album.DeletedAt = deletedAt(deleted)
+	if err := json.Unmarshal([]byte(genres), &album.Genres); err != nil {
+		return nil, fmt.Errorf("decode genres of album %d: %w", album.ID, err)
+	}
+	if len(album.Genres) == 0 {
+		album.Genres = nil // memorydb と同じく、ジャンルがない場合は nil にする
+	}
+	return &album, nil
+}
+
+// encodeGenres はジャンルの一覧を genres 列に保存する JSON の配列にする
+func encodeGenres(genres []string) string {
+	if len(genres) == 0 {
+		return "[]"
+	}
+	b, _ := json.Marshal(genres) // 文字列のスライスの変換は失敗しない
+	return string(b)
+}
+
+// queryAlbums は SELECT を実行してアルバムデータのスライスを返す。クレジットも読み込む
+func queryAlbums(ctx context.Context, q queryer, query string, args ...any) ([]*model.Album, error) {
+	albums, err := scanAlbums(ctx, q, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadCredits(ctx, q, albums); err != nil {
+		return nil, err
+	}
+	return albums, nil
+}
+
+// scanAlbums は SELECT を実行してアルバムデータのスライスを返す（クレジットは読み込まない）
+func scanAlbums(ctx context.Context, q queryer, query string, args ...any) ([]*model.Album, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	albums := make([]*model.Album, 0)
+	for rows.Next() {
+		album, err := scanAlbum(rows)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+	return albums, rows.Err()
+}
+
+// queryAlbum は 1 件のアルバムデータを SELECT してクレジットも読み込む。見つからない場合は sql.ErrNoRows を返す
+func queryAlbum(ctx context.Context, q queryer, query string, args ...any) (*model.Album, error) {
+	album, err := scanAlbum(q.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		return nil, err
+	}
+	if err := loadCredits(ctx, q, []*model.Album{album}); err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+// loadCredits は album_credits テーブルからアルバムのクレジットを 1 回のクエリでまとめて読み込む
+// クレジットがないアルバムの Credits は memorydb と同じく nil にする
+func loadCredits(ctx context.Context, q queryer, albums []*model.Album) error {
+	if len(albums) == 0 {
+		return nil
+	}
+	byID := make(map[model.AlbumID]*model.Album, len(albums))
+	values := make([]any, len(albums))
+	for i, album := range albums {
+		byID[album.ID] = album
+		values[i] = album.ID
+	}
+
+	var b queryBuilder
+	rows, err := q.QueryContext(ctx, `SELECT album_id, singer_id, role FROM album_credits WHERE album_id IN (`+b.placeholders(values)+`) ORDER BY album_id, position`, b.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var albumID model.AlbumID
+		var credit model.Credit
+		if err := rows.Scan(&albumID, &credit.SingerID, &credit.Role); err != nil {
+			return err
+		}
+		album := byID[albumID]
+		album.Credits = append(album.Credits, credit)
+	}
+	return rows.Err()
+}
+
+// saveCredits はアルバムのクレジットを album_credits テーブルに保存する（以前のクレジットは削除する）
+// 存在しない歌手をクレジットしたアルバムは外部キー制約によりエラーになる
+func saveCredits(ctx context.Context, tx *sql.Tx, albumID model.AlbumID, credits []model.Credit) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM album_credits WHERE album_id = $1`, albumID); err != nil {
+		return err
+	}
+	for i, credit := range credits {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO album_credits (album_id, singer_id, role, position) VALUES ($1, $2, $3, $4)`,
+			albumID, credit.SingerID, credit.Role, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAll はゴミ箱に入っていないアルバムデータを全件ID順に取得する
+func (r *albumRepository) GetAll(ctx context.Context) ([]*model.Album, error) {
+	return queryAlbums(ctx, r.db.queryer(ctx), `SELECT `+albumColumns+` FROM albums WHERE deleted_at IS NULL ORDER BY id`)
+}
+
+// List は条件に合うアルバムデータを指定された順にページ単位で取得する。カーソルの位置から LIMIT 件だけを読む
+// query.IncludeDeleted が true の場合はゴミ箱のアルバムも含める
+func (r *albumRepository) List(ctx context.Context, query repository.AlbumQuery) (*repository.Page[*model.Album], error) {
+	var b queryBuilder
+	if !query.IncludeDeleted {
+		b.and(`deleted_at IS NULL`)
+	}
+	if query.SingerID != 0 { // SingerID の歌手だけでなく、クレジットされた歌手でも絞り込む
+		b.and(`(singer_id = ` + b.arg(query.SingerID) + ` OR id IN (SELECT album_id FROM album_credits WHERE singer_id = ` + b.arg(query.SingerID) + `))`)
+	}
+	if substr := model.NormalizeText(query.TitleContains); substr != "" {
+		b.and(`title_key LIKE ` + b.arg("%"+likeEscaper.Replace(substr)+"%") + ` ESCAPE '\'`)
+	}
+
+	keyColumn, keyOf := "", func(*model.Album) string { return "" }
+	if query.Sort.Field == repository.SortFieldTitle {
+		keyColumn, keyOf = "title_key", func(a *model.Album) string { return a.SortKey() }
+	}
+	orderAndLimit, err := r.db.orderAndLimit(&b, keyColumn, query.Sort, query.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	albums, err := queryAlbums(ctx, r.db.queryer(ctx), `SELECT `+albumColumns+` FROM albums`+b.whereClause()+orderAndLimit, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	return newPage(albums, query.Sort, query.Page, func(a *model.Album) repository.Cursor {
+		return repository.Cursor{Key: keyOf(a), ID: int(a.ID)}
+	}), nil
+}
+
+// Get はアルバムIDに対応するアルバムデータを取得する。指定されたIDのアルバムが存在しない（ゴミ箱に入っている）場合はエラーを返す
+func (r *albumRepository) Get(ctx context.Context, id model.AlbumID) (*model.Album, error) {
+	album, err := queryAlbum(ctx, r.db.queryer(ctx), `SELECT `+albumColumns+` FROM albums WHERE id = $1 AND deleted_at IS NULL`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperror.NotFound(apperror.CodeAlbumNotFound, "album %d not found", id)
+	}
+	return album, err
+}
+
+// ListBySinger は指定された歌手がクレジットされたアルバムをID順に取得する（albums_singer_id_idx と album_credits_singer_id_idx インデックスを使う）
+func (r *albumRepository) ListBySinger(ctx context.Context, singerID model.SingerID) ([]*model.Album, error) {
+	return queryAlbums(ctx, r.db.queryer(ctx), `SELECT `+albumColumns+` FROM albums
+		WHERE (singer_id = $1 OR id IN (SELECT album_id FROM album_credits WHERE singer_id = $2)) AND deleted_at IS NULL ORDER BY id`, singerID, singerID)
+}
+
+// Add は新しいアルバムを追加する。ID が 0 の場合は採番し、指定された ID がすでに存在する場合はエラーを返す
+// 存在しない歌手を参照するアルバムは外部キー制約によりエラーになる
+func (r *albumRepository) Add(ctx context.Context, album *model.Album) error {
+	return r.db.withTx(ctx, func(tx *sql.Tx) error {
+		id, err := allocateID(ctx, tx, "albums", int(album.ID))
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO albums (id, title, title_key, singer_id, release_date, genres, version) VALUES ($1, $2, $3, $4, $5, $6, 1) ON CONFLICT (id) DO NOTHING`,
+			id, album.Title, album.SortKey(), album.SingerID, album.ReleaseDate, encodeGenres(album.Genres))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return apperror.AlreadyExists(apperror.CodeAlbumAlreadyExists, "album %d already exists", id)
+		}
+		if err := saveCredits(ctx, tx, model.AlbumID(id), album.Credits); err != nil {
+			return err
+		}
+
+		album.ID = model.AlbumID(id)
+		album.Version = 1
+		album.DeletedAt = nil
+		return nil
+	})
+}
+
+// Update はアルバムデータを置き換える。指定されたIDのアルバムが存在しない場合やバージョンが一致しない場合はエラーを返す
+func (r *albumRepository) Update(ctx context.Context, album *model.Album) error {
+	return r.db.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := r.lockVersion(ctx, tx, album.ID, album.Version)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE albums SET title = $1, title_key = $2, singer_id = $3, release_date = $4, genres = $5, version = $6 WHERE id = $7`,
+			album.Title, album.SortKey(), album.SingerID, album.ReleaseDate, encodeGenres(album.Genres), current+1, album.ID); err != nil {
+			return err
+		}
+		if err := saveCredits(ctx, tx, album.ID, album.Credits); err != nil {
+			return err
+		}
+		album.Version = current + 1
+		album.DeletedAt = nil
+		return nil
+	})
+}
+
+// Delete は指定されたアルバムIDに対応するアルバムをゴミ箱に移動する（deleted_at を設定してバージョンを上げる）
+// 指定されたIDのアルバムが存在しない（すでにゴミ箱に入っている）場合や、version が 0 以外で現在のバージョンと一致しない場合はエラーを返す
+func (r *albumRepository) Delete(ctx context.Context, id model.AlbumID, version model.Version) error {
+	return r.db.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := r.lockVersion(ctx, tx, id, version)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE albums SET deleted_at = $1, version = $2 WHERE id = $3`,
+			time.Now().UnixNano(), current+1, id)
+		return err
+	})
+}
+
+// Restore はゴミ箱のアルバムを元に戻す（deleted_at を NULL にしてバージョンを上げる）。ゴミ箱に入っていない場合はエラーを返す
+func (r *albumRepository) Restore(ctx context.Context, id model.AlbumID) (*model.Album, error) {
+	var album *model.Album
+	err := r.db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE albums SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return apperror.NotFound(apperror.CodeAlbumNotFound, "album %d is not in the trash", id)
+		}
+		album, err = queryAlbum(ctx, tx, `SELECT `+albumColumns+` FROM albums WHERE id = $1`, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+// Purge は deletedBefore より前にゴミ箱に移動したアルバムを完全に削除する
+func (r *albumRepository) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	var purged int64
+	err := r.db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM albums WHERE deleted_at IS NOT NULL AND deleted_at < $1`, deletedBefore.UnixNano())
+		if err != nil {
+			return err
+		}
+		purged, err = res.RowsAffected()
+		return err
+	})
+	return int(purged), err
+}
+
+// UnlinkSinger は指定された歌手がクレジットされたアルバム（ゴミ箱のアルバムも含む）から歌手を外してバージョンを上げる
+// singer_id が一致する場合は NULL にし、album_credits からはその歌手の行を削除する
+// 歌手を完全に削除した場合は外部キー制約（ON DELETE SET NULL / CASCADE）でも外れるが、その場合はバージョンが上がらない
+func (r *albumRepository) UnlinkSinger(ctx context.Context, singerID model.SingerID) (int, error) {
+	var unlinked int64
+	err := r.db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `UPDATE albums SET singer_id = CASE WHEN singer_id = $1 THEN NULL ELSE singer_id END, version = version + 1
+			WHERE singer_id = $1 OR id IN (SELECT album_id FROM album_credits WHERE singer_id = $1)`, singerID)
+		if err != nil {
+			return err
+		}
+		if unlinked, err = res.RowsAffected(); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM album_credits WHERE singer_id = $1`, singerID)
+		return err
+	})
+	return int(unlinked), err
+}
+
+// lockVersion はゴミ箱に入っていないアルバムの行をロックして現在のバージョンを返す。expected が 0 以外で現在のバージョンと一致しない場合はエラーを返す
+func (r *albumRepository) lockVersion(ctx context.Context, tx *sql.Tx, id model.AlbumID, expected model.Version) (model.Version, error) {
+	var current model.Version
+	err := tx.QueryRowContext(ctx, `SELECT version FROM albums WHERE id = $1 AND deleted_at IS NULL`+r.db.dialect.forUpdate, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, apperror.NotFound(apperror.CodeAlbumNotFound, "album %d not found", id)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if expected != 0 && expected != current {
+		return 0, apperror.Precondition(apperror.CodeVersionMismatch, "album %d has version %d, not %d", id, current, expected)
+	}
+	return current, nil
+}
@@ -0,0 +1,30 @@
+package sqldb_test
+
+import (
+	"testing"
+
+	"server-recruit-challenge-sample/infra/sqldb"
+	"server-recruit-challenge-sample/repository"
+	"server-recruit-challenge-sample/repository/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository) {
+		db := openTestDB(t)
+		return sqldb.NewSingerRepository(db), sqldb.NewAlbumRepository(db)
+	})
+}
+
+func TestTrackConformance(t *testing.T) {
+	repotest.RunTracks(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository, repository.TrackRepository) {
+		db := openTestDB(t)
+		return sqldb.NewSingerRepository(db), sqldb.NewAlbumRepository(db), sqldb.NewTrackRepository(db)
+	})
+}
+
+func TestSearchConformance(t *testing.T) {
+	repotest.RunSearch(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository, repository.SearchRepository) {
+		db := openTestDB(t)
+		return sqldb.NewSingerRepository(db), sqldb.NewAlbumRepository(db), sqldb.NewSearchRepository(db)
+	})
+}
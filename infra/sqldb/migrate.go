@@ -0,0 +1,165 @@
+// スキーマのマイグレーションを定義するためのファイル
+
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"server-recruit-challenge-sample/model"
+)
+
+// migrations はスキーマの変更を順番に並べたもの。適用済みのマイグレーションは変更せず、末尾に追加していくこと
+var migrations = [][]string{
+	// 1: 歌手とアルバムのテーブル、ID の採番用テーブルを作成する
+	{
+		`CREATE TABLE singers (
+			id      BIGINT PRIMARY KEY,
+			name    TEXT NOT NULL,
+			version BIGINT NOT NULL
+		)`,
+		// 歌手を削除したときにアルバムを残す（orphan）場合に備え、singer_id は NULL にできるようにする
+		`CREATE TABLE albums (
+			id        BIGINT PRIMARY KEY,
+			title     TEXT NOT NULL,
+			singer_id BIGINT REFERENCES singers (id) ON DELETE SET NULL,
+			version   BIGINT NOT NULL
+		)`,
+		`CREATE INDEX albums_singer_id_idx ON albums (singer_id)`,
+		`CREATE TABLE id_sequences (
+			name    TEXT PRIMARY KEY,
+			next_id BIGINT NOT NULL
+		)`,
+		`INSERT INTO id_sequences (name, next_id) VALUES ('singers', 1), ('albums', 1)`,
+	},
+	// 2: ゴミ箱に移動した日時（Unix 時間のナノ秒）を保存する列を追加する。NULL はゴミ箱に入っていないことを表す
+	{
+		`ALTER TABLE singers ADD COLUMN deleted_at BIGINT`,
+		`ALTER TABLE albums ADD COLUMN deleted_at BIGINT`,
+	},
+	// 3: アルバムの発売日とジャンル（文字列の配列を JSON にしたもの）の列と、曲のテーブルを追加する
+	{
+		`ALTER TABLE albums ADD COLUMN release_date TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE albums ADD COLUMN genres TEXT NOT NULL DEFAULT '[]'`,
+		// アルバムを完全に削除したときは曲も削除する
+		`CREATE TABLE tracks (
+			id       BIGINT PRIMARY KEY,
+			album_id BIGINT NOT NULL REFERENCES albums (id) ON DELETE CASCADE,
+			number   INTEGER NOT NULL,
+			title    TEXT NOT NULL,
+			duration INTEGER NOT NULL,
+			version  BIGINT NOT NULL,
+			UNIQUE (album_id, number)
+		)`,
+		`INSERT INTO id_sequences (name, next_id) VALUES ('tracks', 1)`,
+	},
+	// 4: アルバムにクレジットされた歌手（多対多の関係）のテーブルを追加する。position はクレジットの順番
+	{
+		// アルバムや歌手を完全に削除したときはクレジットも削除する
+		`CREATE TABLE album_credits (
+			album_id  BIGINT NOT NULL REFERENCES albums (id) ON DELETE CASCADE,
+			singer_id BIGINT NOT NULL REFERENCES singers (id) ON DELETE CASCADE,
+			role      TEXT NOT NULL,
+			position  INTEGER NOT NULL,
+			PRIMARY KEY (album_id, singer_id, role)
+		)`,
+		`CREATE INDEX album_credits_singer_id_idx ON album_credits (singer_id)`,
+	},
+	// 5: 歌手の名前の読みとローマ字表記の列と、並び替え・絞り込みに使う正規化した値（model.NormalizeText）の列を追加する
+	// 正規化は SQL では行えないので、既存の行の値は backfills で設定する
+	{
+		`ALTER TABLE singers ADD COLUMN name_kana TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE singers ADD COLUMN name_romaji TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE singers ADD COLUMN name_key TEXT NOT NULL DEFAULT ''`,   // 正規化した名前（同じ名前の確認に使う）
+		`ALTER TABLE singers ADD COLUMN sort_key TEXT NOT NULL DEFAULT ''`,   // 正規化した読み（読みがない場合は name_key と同じ）
+		`ALTER TABLE singers ADD COLUMN romaji_key TEXT NOT NULL DEFAULT ''`, // 正規化したローマ字表記
+		`ALTER TABLE albums ADD COLUMN title_key TEXT NOT NULL DEFAULT ''`,   // 正規化したタイトル
+		`CREATE INDEX singers_name_key_idx ON singers (name_key)`,
+	},
+	// 6: ゴミ箱に入っていない歌手の正規化した名前を一意にする（サービスの確認だけでは、同時に追加した場合に重複する）
+	// name_key は 5 の backfills で設定済み。同じ名前の歌手がすでにいる場合は失敗するので、先に名前を変えるかゴミ箱に移動しておくこと
+	{
+		`DROP INDEX singers_name_key_idx`,
+		`CREATE UNIQUE INDEX singers_name_key_idx ON singers (name_key) WHERE deleted_at IS NULL`,
+	},
+}
+
+// backfills はマイグレーションの SQL を実行した後に、同じトランザクションで Go のコードで行う処理（キーはマイグレーションの番号）
+var backfills = map[int]func(ctx context.Context, tx *sql.Tx) error{
+	5: backfillNormalizedKeys,
+}
+
+// backfillNormalizedKeys は既存の歌手とアルバムの正規化した値の列を設定する
+// 後のマイグレーションで列が増えても動くように、この時点で存在する列だけを読む（既存の歌手には読みとローマ字表記がない）
+func backfillNormalizedKeys(ctx context.Context, tx *sql.Tx) error {
+	for _, table := range []struct{ query, update string }{
+		{`SELECT id, name FROM singers`, `UPDATE singers SET name_key = $1, sort_key = $1 WHERE id = $2`},
+		{`SELECT id, title FROM albums`, `UPDATE albums SET title_key = $1 WHERE id = $2`},
+	} {
+		keys, err := normalizeColumn(ctx, tx, table.query)
+		if err != nil {
+			return err
+		}
+		for id, key := range keys {
+			if _, err := tx.ExecContext(ctx, table.update, key, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeColumn は (id, 文字列) を SELECT して、ID ごとに文字列を model.NormalizeText で正規化した値を返す
+func normalizeColumn(ctx context.Context, tx *sql.Tx, query string) (map[int64]string, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var s string
+		if err := rows.Scan(&id, &s); err != nil {
+			return nil, err
+		}
+		keys[id] = model.NormalizeText(s)
+	}
+	return keys, rows.Err()
+}
+
+// Migrate は未適用のマイグレーションを順番に適用する。マイグレーションごとにトランザクションを使う
+func (db *DB) Migrate(ctx context.Context) error {
+	if _, err := db.conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		err := db.withTx(ctx, func(tx *sql.Tx) error {
+			for _, stmt := range migrations[i] {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+			if backfill := backfills[version]; backfill != nil {
+				if err := backfill(ctx, tx); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("apply migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// RDB の歌手とアルバムを全文検索するリポジトリを実装するためのファイル
+
+package sqldb
+
+import (
+	"context"
+
+	"server-recruit-challenge-sample/infra/fulltext"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// searchRepository 構造体は DB を持ち、singers テーブルの名前と albums テーブルのタイトルを検索する
+// RDB には転置インデックスを保存しないので、検索のたびにゴミ箱に入っていない行を読んでメモリ上でインデックスを作る（件数が少ないカタログ向け）
+type searchRepository struct {
+	db *DB
+}
+
+// インターフェースが正しく実装されていることを確認するためのコード
+var _ repository.SearchRepository = (*searchRepository)(nil)
+
+// NewSearchRepository は singers テーブルと albums テーブルを検索するリポジトリを生成する
+func NewSearchRepository(db *DB) *searchRepository {
+	return &searchRepository{db: db}
+}
+
+// Search は歌手の名前とアルバムのタイトルを検索する。memorydb と同じ正規化と順位付けを使う
+func (r *searchRepository) Search(ctx context.Context, query repository.SearchQuery) ([]*model.SearchHit, error) {
+	var hits []*model.SearchHit
+	if fulltext.Includes(query.Types, model.SearchTypeSinger) {
+		found, err := r.search(ctx, model.SearchTypeSinger, `SELECT id, name, name_kana, name_romaji FROM singers WHERE deleted_at IS NULL`, query.Text)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, found...)
+	}
+	if fulltext.Includes(query.Types, model.SearchTypeAlbum) {
+		found, err := r.search(ctx, model.SearchTypeAlbum, `SELECT id, title, '', '' FROM albums WHERE deleted_at IS NULL`, query.Text)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, found...)
+	}
+	return fulltext.SortHits(hits, query.Limit), nil
+}
+
+// search は SELECT した（ID, 文字列, 読み, ローマ字表記）の行からインデックスを作って検索する。読みとローマ字表記は強調表示しない別名として登録する
+func (r *searchRepository) search(ctx context.Context, typ model.SearchType, query, text string) ([]*model.SearchHit, error) {
+	rows, err := r.db.queryer(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := fulltext.NewIndex()
+	texts := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var s, kana, romaji string
+		if err := rows.Scan(&id, &s, &kana, &romaji); err != nil {
+			return nil, err
+		}
+		index.Add(id, s, kana, romaji)
+		texts[id] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return fulltext.Hits(typ, index.Search(text), func(id int) string { return texts[id] }), nil
+}
@@ -0,0 +1,49 @@
+// 初期データを投入するためのファイル
+
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+
+	"server-recruit-challenge-sample/model"
+)
+
+// Seed はまだ一度も歌手とアルバムが追加されていない（ID が採番されていない）場合に限り、初期データを 1 つのトランザクションで投入する
+// 初期データを投入した場合は true を返す。すべて削除された後に再起動しても初期データが復活することはない
+func (db *DB) Seed(ctx context.Context, singers []*model.Singer, albums []*model.Album) (bool, error) {
+	seeded := false
+	err := db.withTx(ctx, func(tx *sql.Tx) error {
+		var used int
+		if err := tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM id_sequences WHERE next_id > 1`).Scan(&used); err != nil {
+			return err
+		}
+		if used > 0 {
+			return nil
+		}
+
+		for _, singer := range singers {
+			if _, err := allocateID(ctx, tx, "singers", int(singer.ID)); err != nil {
+				return err
+			}
+			nameKey, sortKey, romajiKey := singerKeys(singer)
+			if _, err := tx.ExecContext(ctx, `INSERT INTO singers (id, name, name_kana, name_romaji, name_key, sort_key, romaji_key, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				singer.ID, singer.Name, singer.NameKana, singer.NameRomaji, nameKey, sortKey, romajiKey, singer.Version); err != nil {
+				return err
+			}
+		}
+		for _, album := range albums {
+			if _, err := allocateID(ctx, tx, "albums", int(album.ID)); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO albums (id, title, title_key, singer_id, release_date, genres, version) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				album.ID, album.Title, album.SortKey(), album.SingerID, album.ReleaseDate, encodeGenres(album.Genres), album.Version); err != nil {
+				return err
+			}
+		}
+		seeded = true
+		return nil
+	})
+	return seeded, err
+}
@@ -0,0 +1,274 @@
+// RDB の singers テーブルで歌手データを保持するリポジトリを実装するためのファイル
+
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// singerRepository 構造体は DB を持ち、singers テーブルに対して歌手データを読み書きする
+type singerRepository struct {
+	db *DB
+}
+
+// インターフェースが正しく実装されていることを確認するためのコード
+var _ repository.SingerRepository = (*singerRepository)(nil)
+
+// NewSingerRepository は singers テーブルを使う歌手のリポジトリを生成する
+func NewSingerRepository(db *DB) *singerRepository {
+	return &singerRepository{db: db}
+}
+
+// singerColumns は SELECT する列（scanSinger の引数と同じ順番）
+const singerColumns = `id, name, name_kana, name_romaji, version, deleted_at`
+
+// scanSinger は 1 行分の歌手データを読み込む
+func scanSinger(row scanner) (*model.Singer, error) {
+	var singer model.Singer
+	var deleted sql.NullInt64
+	if err := row.Scan(&singer.ID, &singer.Name, &singer.NameKana, &singer.NameRomaji, &singer.Version, &deleted); err != nil {
+		return nil, err
+	}
+	singer.DeletedAt = deletedAt(deleted)
+	return &singer, nil
+}
+
+// singerKeys は name_key, sort_key, romaji_key 列に保存する正規化した値を返す
+func singerKeys(singer *model.Singer) (nameKey, sortKey, romajiKey string) {
+	return singer.NameKey(), singer.SortKey(), model.NormalizeText(singer.NameRomaji)
+}
+
+// querySingers は SELECT を実行して歌手データのスライスを返す
+func querySingers(ctx context.Context, q queryer, query string, args ...any) ([]*model.Singer, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	singers := make([]*model.Singer, 0)
+	for rows.Next() {
+		singer, err := scanSinger(rows)
+		if err != nil {
+			return nil, err
+		}
+		singers = append(singers, singer)
+	}
+	return singers, rows.Err()
+}
+
+// GetAll はゴミ箱に入っていない歌手データを全件ID順に取得する
+func (r *singerRepository) GetAll(ctx context.Context) ([]*model.Singer, error) {
+	return querySingers(ctx, r.db.queryer(ctx), `SELECT `+singerColumns+` FROM singers WHERE deleted_at IS NULL ORDER BY id`)
+}
+
+// List は条件に合う歌手データを指定された順にページ単位で取得する。カーソルの位置から LIMIT 件だけを読む
+// query.IncludeDeleted が true の場合はゴミ箱の歌手も含める
+func (r *singerRepository) List(ctx context.Context, query repository.SingerQuery) (*repository.Page[*model.Singer], error) {
+	var b queryBuilder
+	if !query.IncludeDeleted {
+		b.and(`deleted_at IS NULL`)
+	}
+	if prefix := model.NormalizeText(query.NamePrefix); prefix != "" { // 名前・読み・ローマ字表記のいずれかで始まる
+		pattern := b.arg(likeEscaper.Replace(prefix) + "%")
+		b.and(`(name_key LIKE ` + pattern + ` ESCAPE '\' OR sort_key LIKE ` + pattern + ` ESCAPE '\' OR romaji_key LIKE ` + pattern + ` ESCAPE '\')`)
+	}
+	if name := model.NormalizeText(query.NameEquals); name != "" {
+		b.and(`name_key = ` + b.arg(name)) // singers_name_key_idx インデックスを使う
+	}
+
+	keyColumn, keyOf := "", func(*model.Singer) string { return "" }
+	if query.Sort.Field == repository.SortFieldName {
+		keyColumn, keyOf = "sort_key", func(s *model.Singer) string { return s.SortKey() }
+	}
+	orderAndLimit, err := r.db.orderAndLimit(&b, keyColumn, query.Sort, query.Page)
+	if err != nil {
+		return nil, err
+	}
+
+	singers, err := querySingers(ctx, r.db.queryer(ctx), `SELECT `+singerColumns+` FROM singers`+b.whereClause()+orderAndLimit, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	return newPage(singers, query.Sort, query.Page, func(s *model.Singer) repository.Cursor {
+		return repository.Cursor{Key: keyOf(s), ID: int(s.ID)}
+	}), nil
+}
+
+// Get は歌手IDに対応する歌手データを取得する。指定されたIDの歌手が存在しない（ゴミ箱に入っている）場合はエラーを返す
+func (r *singerRepository) Get(ctx context.Context, id model.SingerID) (*model.Singer, error) {
+	singer, err := scanSinger(r.db.queryer(ctx).QueryRowContext(ctx, `SELECT `+singerColumns+` FROM singers WHERE id = $1 AND deleted_at IS NULL`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperror.NotFound(apperror.CodeSingerNotFound, "singer %d not found", id)
+	}
+	return singer, err
+}
+
+// GetByIDs は複数の歌手IDに対応する歌手データを 1 回のクエリでまとめて取得する。存在しないIDは結果に含めない
+func (r *singerRepository) GetByIDs(ctx context.Context, ids []model.SingerID) (map[model.SingerID]*model.Singer, error) {
+	return r.getByIDs(ctx, ids, "")
+}
+
+// LockByIDs は GetByIDs と同じ歌手データを、行を共有ロック（SELECT ... FOR SHARE）して取得する
+// トランザクションの中で呼び出すと、コミットするまでほかのトランザクションはこれらの歌手を変更したりゴミ箱に移動したりできない
+// ほかのトランザクションがゴミ箱に移動している途中の歌手は、そのトランザクションが終わるまで待ってから、ゴミ箱に移動した場合は結果に含めない
+func (r *singerRepository) LockByIDs(ctx context.Context, ids []model.SingerID) (map[model.SingerID]*model.Singer, error) {
+	return r.getByIDs(ctx, ids, r.db.dialect.forShare)
+}
+
+// getByIDs は GetByIDs と LockByIDs の共通の処理。lock は SELECT の末尾に付ける行ロックの句
+func (r *singerRepository) getByIDs(ctx context.Context, ids []model.SingerID, lock string) (map[model.SingerID]*model.Singer, error) {
+	result := make(map[model.SingerID]*model.Singer, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	var b queryBuilder
+	values := make([]any, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	// ロックを取る順番を揃えてデッドロックを避けるため、ID 順に取得する
+	singers, err := querySingers(ctx, r.db.queryer(ctx), `SELECT `+singerColumns+` FROM singers WHERE id IN (`+b.placeholders(values)+`) AND deleted_at IS NULL ORDER BY id`+lock, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, singer := range singers {
+		result[singer.ID] = singer
+	}
+	return result, nil
+}
+
+// Add は新しい歌手を追加する。ID が 0 の場合は採番し、指定された ID がすでに存在する場合はエラーを返す
+// 正規化した名前が同じ歌手がゴミ箱の外にいる場合は、一意インデックス（singers_name_key_idx）の違反を apperror.ErrConflict にして返す
+func (r *singerRepository) Add(ctx context.Context, singer *model.Singer) error {
+	return r.db.withTx(ctx, func(tx *sql.Tx) error {
+		id, err := allocateID(ctx, tx, "singers", int(singer.ID))
+		if err != nil {
+			return err
+		}
+
+		nameKey, sortKey, romajiKey := singerKeys(singer)
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO singers (id, name, name_kana, name_romaji, name_key, sort_key, romaji_key, version) VALUES ($1, $2, $3, $4, $5, $6, $7, 1) ON CONFLICT (id) DO NOTHING`,
+			id, singer.Name, singer.NameKana, singer.NameRomaji, nameKey, sortKey, romajiKey)
+		if err != nil {
+			return r.nameTaken(err, "another singer already has the name %q", singer.Name)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return apperror.AlreadyExists(apperror.CodeSingerAlreadyExists, "singer %d already exists", id)
+		}
+
+		singer.ID = model.SingerID(id)
+		singer.Version = 1
+		singer.DeletedAt = nil
+		return nil
+	})
+}
+
+// Update は歌手データを置き換える。指定されたIDの歌手が存在しない場合やバージョンが一致しない場合はエラーを返す
+// 正規化した名前がほかの歌手と同じになる場合は apperror.ErrConflict を返す
+func (r *singerRepository) Update(ctx context.Context, singer *model.Singer) error {
+	return r.db.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := r.lockVersion(ctx, tx, singer.ID, singer.Version)
+		if err != nil {
+			return err
+		}
+
+		nameKey, sortKey, romajiKey := singerKeys(singer)
+		if _, err := tx.ExecContext(ctx, `UPDATE singers SET name = $1, name_kana = $2, name_romaji = $3, name_key = $4, sort_key = $5, romaji_key = $6, version = $7 WHERE id = $8`,
+			singer.Name, singer.NameKana, singer.NameRomaji, nameKey, sortKey, romajiKey, current+1, singer.ID); err != nil {
+			return r.nameTaken(err, "another singer already has the name %q", singer.Name)
+		}
+		singer.Version = current + 1
+		singer.DeletedAt = nil
+		return nil
+	})
+}
+
+// Delete は指定された歌手IDに対応する歌手をゴミ箱に移動する（deleted_at を設定してバージョンを上げる）
+// 指定されたIDの歌手が存在しない（すでにゴミ箱に入っている）場合や、version が 0 以外で現在のバージョンと一致しない場合はエラーを返す
+func (r *singerRepository) Delete(ctx context.Context, id model.SingerID, version model.Version) error {
+	return r.db.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := r.lockVersion(ctx, tx, id, version)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE singers SET deleted_at = $1, version = $2 WHERE id = $3`,
+			time.Now().UnixNano(), current+1, id)
+		return err
+	})
+}
+
+// Restore はゴミ箱の歌手を元に戻す（deleted_at を NULL にしてバージョンを上げる）。ゴミ箱に入っていない場合はエラーを返す
+// ゴミ箱に入っている間に正規化した名前が同じ歌手が追加された場合は apperror.ErrConflict を返す
+func (r *singerRepository) Restore(ctx context.Context, id model.SingerID) (*model.Singer, error) {
+	var singer *model.Singer
+	err := r.db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE singers SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+		if err != nil {
+			return r.nameTaken(err, "singer %d cannot be restored because another singer has the same name", id)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return apperror.NotFound(apperror.CodeSingerNotFound, "singer %d is not in the trash", id)
+		}
+		singer, err = scanSinger(tx.QueryRowContext(ctx, `SELECT `+singerColumns+` FROM singers WHERE id = $1`, id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return singer, nil
+}
+
+// Purge は deletedBefore より前にゴミ箱に移動した歌手を完全に削除する
+// 残っているアルバムは外部キー制約（ON DELETE SET NULL）により歌手IDが NULL になる
+func (r *singerRepository) Purge(ctx context.Context, deletedBefore time.Time) (int, error) {
+	var purged int64
+	err := r.db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM singers WHERE deleted_at IS NOT NULL AND deleted_at < $1`, deletedBefore.UnixNano())
+		if err != nil {
+			return err
+		}
+		purged, err = res.RowsAffected()
+		return err
+	})
+	return int(purged), err
+}
+
+// nameTaken は err が正規化した名前の一意インデックスの違反の場合は apperror.Conflict に変換し、それ以外の場合はそのまま返す
+// サービスでも事前に確認しているが、同時に書き込んだ場合に重複を防ぐのはこのインデックス
+func (r *singerRepository) nameTaken(err error, format string, args ...any) error {
+	if r.db.dialect.uniqueViolation(err) {
+		return apperror.Conflict(apperror.CodeSingerNameTaken, format, args...)
+	}
+	return err
+}
+
+// lockVersion はゴミ箱に入っていない歌手の行をロックして現在のバージョンを返す。expected が 0 以外で現在のバージョンと一致しない場合はエラーを返す
+func (r *singerRepository) lockVersion(ctx context.Context, tx *sql.Tx, id model.SingerID, expected model.Version) (model.Version, error) {
+	var current model.Version
+	err := tx.QueryRowContext(ctx, `SELECT version FROM singers WHERE id = $1 AND deleted_at IS NULL`+r.db.dialect.forUpdate, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, apperror.NotFound(apperror.CodeSingerNotFound, "singer %d not found", id)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if expected != 0 && expected != current {
+		return 0, apperror.Precondition(apperror.CodeVersionMismatch, "singer %d has version %d, not %d", id, current, expected)
+	}
+	return current, nil
+}
@@ -0,0 +1,254 @@
+// database/sql を使って歌手とアルバムのデータを RDB（PostgreSQL 互換）に永続化するためのパッケージ
+// SQL は PostgreSQL と SQLite の両方で動く書き方に揃え、違いは Dialect にまとめている
+
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"server-recruit-challenge-sample/repository"
+)
+
+// インターフェースが正しく実装されていることを確認するためのコード
+var _ repository.Transactor = (*DB)(nil)
+
+// Dialect は RDB ごとの SQL の違いを表す
+type Dialect struct {
+	Name          string // 方言の名前（ログやエラーメッセージ用）
+	binaryCollate string // 文字列をバイト順で比較するための COLLATE 句（memorydb と同じ並び順にするため）
+	forUpdate     string // SELECT で行ロックを取るための句（行ロックがない RDB では空文字）
+	forShare      string // SELECT で共有の行ロック（ほかのトランザクションの変更と削除だけを防ぐ）を取るための句（行ロックがない RDB では空文字）
+
+	uniqueViolation func(err error) bool // err が一意制約（UNIQUE インデックス）の違反かを返す
+}
+
+var (
+	// Postgres は PostgreSQL 用の方言（ドライバーは github.com/jackc/pgx/v5/stdlib を想定）
+	Postgres = Dialect{Name: "postgres", binaryCollate: `COLLATE "C"`, forUpdate: " FOR UPDATE", forShare: " FOR SHARE", uniqueViolation: isPostgresUniqueViolation}
+	// SQLite は SQLite 用の方言（外部キー制約を有効にするため、接続ごとに PRAGMA foreign_keys = ON が必要）
+	// 書き込みはデータベース全体をロックするので、行ロックの句は使わない
+	SQLite = Dialect{Name: "sqlite", binaryCollate: "COLLATE BINARY", uniqueViolation: isSQLiteUniqueViolation}
+)
+
+// isPostgresUniqueViolation は PostgreSQL の unique_violation（SQLSTATE 23505）かを返す
+// ドライバーのパッケージに依存しないように、エラーのメソッドで判定する（pgconn.PgError が実装している）
+func isPostgresUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	return errors.As(err, &pgErr) && pgErr.SQLState() == "23505"
+}
+
+// isSQLiteUniqueViolation は SQLite の SQLITE_CONSTRAINT_UNIQUE（拡張リザルトコード 2067）かを返す
+// ドライバーのパッケージに依存しないように、エラーのメソッドで判定する（modernc.org/sqlite の Error が実装している）
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr interface{ Code() int }
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == 2067
+}
+
+// DB は database/sql の接続と方言をまとめたもの
+type DB struct {
+	conn    *sql.DB
+	dialect Dialect
+}
+
+// New は接続済みの *sql.DB から DB を生成する。スキーマを作成するには Migrate を呼び出す
+func New(conn *sql.DB, dialect Dialect) *DB {
+	return &DB{conn: conn, dialect: dialect}
+}
+
+// Open はドライバー名と接続文字列で RDB に接続し、スキーマを最新の状態にしてから DB を返す
+func Open(ctx context.Context, driverName, dsn string, dialect Dialect) (*DB, error) {
+	conn, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect to %s: %w", dialect.Name, err)
+	}
+
+	db := New(conn, dialect)
+	if err := db.Migrate(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close は RDB との接続を閉じる
+func (db *DB) Close() error {
+	return db.conn.Close()
+}
+
+// queryer は *sql.DB と *sql.Tx のどちらでも SELECT を実行できるようにするためのインターフェース
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// txKey は context にトランザクションを保存するためのキー
+type txKey struct{}
+
+// txFromContext は ctx に保存されているトランザクションを返す（トランザクションの外の場合は nil）
+func txFromContext(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(txKey{}).(*sql.Tx)
+	return tx
+}
+
+// queryer は ctx がトランザクションの中の場合はそのトランザクションを、そうでない場合は接続を返す
+func (db *DB) queryer(ctx context.Context) queryer {
+	if tx := txFromContext(ctx); tx != nil {
+		return tx
+	}
+	return db.conn
+}
+
+// RunInTx は fn を 1 つのトランザクションの中で実行し、fn がエラーを返した場合はロールバックする
+// fn に渡された ctx を使うリポジトリのメソッドは、すべて同じトランザクションの中で実行される
+func (db *DB) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if txFromContext(ctx) != nil {
+		return fn(ctx) // すでにトランザクションの中にいる場合はそのトランザクションに参加する
+	}
+	return db.withTx(ctx, func(tx *sql.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// scanner は *sql.Row と *sql.Rows のどちらからでも 1 行を読み込めるようにするためのインターフェース
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// deletedAt は deleted_at 列の値（Unix 時間のナノ秒）を時刻に変換する。NULL の場合は nil を返す
+func deletedAt(n sql.NullInt64) *time.Time {
+	if !n.Valid {
+		return nil
+	}
+	t := time.Unix(0, n.Int64).UTC()
+	return &t
+}
+
+// withTx は fn をトランザクションの中で実行し、fn がエラーを返した場合はロールバックする
+// ctx がすでに RunInTx のトランザクションの中の場合は、そのトランザクションで fn を実行する（コミットやロールバックは RunInTx が行う）
+func (db *DB) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if tx := txFromContext(ctx); tx != nil {
+		return fn(tx)
+	}
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// allocateID は ID を採番する。requested が 0 の場合は次の ID を返し、0 以外の場合は次に採番する ID が requested より大きくなるようにする
+// 採番した ID は削除されても再利用しない（memorydb と同じく単調増加）
+func allocateID(ctx context.Context, tx *sql.Tx, sequence string, requested int) (int, error) {
+	if requested != 0 {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE id_sequences SET next_id = CASE WHEN next_id > $2 THEN next_id ELSE $2 + 1 END WHERE name = $1`,
+			sequence, requested)
+		return requested, err
+	}
+
+	var id int
+	err := tx.QueryRowContext(ctx,
+		`UPDATE id_sequences SET next_id = next_id + 1 WHERE name = $1 RETURNING next_id - 1`,
+		sequence).Scan(&id)
+	return id, err
+}
+
+// queryBuilder は WHERE 句とプレースホルダー（$1, $2, ...）の引数を組み立てる
+type queryBuilder struct {
+	where []string
+	args  []any
+}
+
+// arg は引数を追加し、そのプレースホルダーを返す
+func (b *queryBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// and は WHERE 句に条件を追加する
+func (b *queryBuilder) and(cond string) {
+	b.where = append(b.where, cond)
+}
+
+// whereClause は組み立てた WHERE 句を返す（条件がない場合は空文字）
+func (b *queryBuilder) whereClause() string {
+	if len(b.where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.where, " AND ")
+}
+
+// likeEscaper は LIKE のパターンで特別な意味を持つ文字をエスケープする（ESCAPE '\' と組み合わせて使う）
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// placeholders は n 個のプレースホルダーを "$1, $2, ..." の形式で返し、引数を追加する
+func (b *queryBuilder) placeholders(values []any) string {
+	ph := make([]string, len(values))
+	for i, v := range values {
+		ph[i] = b.arg(v)
+	}
+	return strings.Join(ph, ", ")
+}
+
+// orderAndLimit はカーソルより後ろの要素だけを取得する条件を b に追加し、ORDER BY 句と LIMIT 句を返す
+// keyColumn は並び替えに使う列（ID で並べる場合は空文字）で、同じ値の行どうしは id で並べる
+// 次のページがあるかを判定するため、LIMIT は page.Limit より 1 件多くする
+func (db *DB) orderAndLimit(b *queryBuilder, keyColumn string, order repository.Sort, page repository.PageRequest) (string, error) {
+	op, dir := ">", "ASC"
+	if order.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	if page.Cursor != "" {
+		cursor, err := repository.DecodeCursor(page.Cursor, order)
+		if err != nil {
+			return "", err
+		}
+		if keyColumn == "" {
+			b.and(fmt.Sprintf("id %s %s", op, b.arg(cursor.ID)))
+		} else {
+			key := b.arg(cursor.Key)
+			b.and(fmt.Sprintf("(%s %s %s %s OR (%s = %s AND id %s %s))",
+				keyColumn, db.dialect.binaryCollate, op, key, keyColumn, key, op, b.arg(cursor.ID)))
+		}
+	}
+
+	clause := " ORDER BY id " + dir
+	if keyColumn != "" {
+		clause = fmt.Sprintf(" ORDER BY %s %s %s, id %s", keyColumn, db.dialect.binaryCollate, dir, dir)
+	}
+	if page.Limit > 0 {
+		clause += " LIMIT " + b.arg(page.Limit+1)
+	}
+	return clause, nil
+}
+
+// newPage は orderAndLimit で 1 件多く取得した結果から 1 ページ分を切り出し、続きがある場合は次のページのカーソルを設定する
+func newPage[T any](items []T, order repository.Sort, page repository.PageRequest, cursorOf func(T) repository.Cursor) *repository.Page[T] {
+	if page.Limit <= 0 || len(items) <= page.Limit {
+		return &repository.Page[T]{Items: items}
+	}
+	items = items[:page.Limit]
+	cursor := cursorOf(items[len(items)-1])
+	cursor.Sort = order.String()
+	return &repository.Page[T]{Items: items, NextCursor: repository.EncodeCursor(cursor)}
+}
@@ -0,0 +1,350 @@
+package sqldb_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/infra/sqldb"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// openTestDB はテスト用の DB を開く
+// 環境変数 SQLDB_TEST_POSTGRES_DSN が設定されている場合はその PostgreSQL を（テーブルを作り直して）使い、
+// 設定されていない場合は代わりにインメモリの SQLite を使う
+func openTestDB(t *testing.T) *sqldb.DB {
+	t.Helper()
+	ctx := context.Background()
+
+	var db *sqldb.DB
+	if dsn := os.Getenv("SQLDB_TEST_POSTGRES_DSN"); dsn != "" {
+		conn, err := sql.Open("pgx", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.ExecContext(ctx, `DROP TABLE IF EXISTS album_credits, tracks, albums, singers, id_sequences, schema_migrations`); err != nil {
+			t.Fatal(err)
+		}
+		db = sqldb.New(conn, sqldb.Postgres)
+	} else {
+		conn, err := sql.Open("sqlite", "file::memory:?_pragma=foreign_keys(1)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetMaxOpenConns(1) // インメモリの SQLite は接続ごとに別のデータベースになるため、接続を 1 つに限定する
+		db = sqldb.New(conn, sqldb.SQLite)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+}
+
+func TestSingerRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := sqldb.NewSingerRepository(openTestDB(t))
+
+	alice := &model.Singer{Name: "Alice"}
+	if err := repo.Add(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	if alice.ID != 1 || alice.Version != 1 {
+		t.Fatalf("Add assigned id=%d version=%d, want id=1 version=1", alice.ID, alice.Version)
+	}
+	if err := repo.Add(ctx, &model.Singer{ID: 10, Name: "Bella"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(ctx, &model.Singer{ID: 10, Name: "Dup"}); !errors.Is(err, apperror.ErrAlreadyExists) {
+		t.Fatalf("Add duplicate id: got %v, want ErrAlreadyExists", err)
+	}
+	chris := &model.Singer{Name: "Chris"}
+	if err := repo.Add(ctx, chris); err != nil {
+		t.Fatal(err)
+	}
+	if chris.ID != 11 {
+		t.Fatalf("Add after explicit id 10 assigned id=%d, want 11", chris.ID)
+	}
+
+	got, err := repo.Get(ctx, alice.ID)
+	if err != nil || got.Name != "Alice" {
+		t.Fatalf("Get: got %+v, %v", got, err)
+	}
+	if _, err := repo.Get(ctx, 999); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("Get missing: got %v, want ErrNotFound", err)
+	}
+
+	byIDs, err := repo.GetByIDs(ctx, []model.SingerID{1, 11, 999})
+	if err != nil || len(byIDs) != 2 || byIDs[11].Name != "Chris" {
+		t.Fatalf("GetByIDs: got %v, %v", byIDs, err)
+	}
+
+	if err := repo.Update(ctx, &model.Singer{ID: alice.ID, Name: "Alicia", Version: 5}); !errors.Is(err, apperror.ErrPrecondition) {
+		t.Fatalf("Update with stale version: got %v, want ErrPrecondition", err)
+	}
+	updated := &model.Singer{ID: alice.ID, Name: "Alicia", Version: 1}
+	if err := repo.Update(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version != 2 {
+		t.Fatalf("Update set version=%d, want 2", updated.Version)
+	}
+	if err := repo.Update(ctx, &model.Singer{ID: 999, Name: "Nobody"}); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("Update missing: got %v, want ErrNotFound", err)
+	}
+
+	if err := repo.Delete(ctx, alice.ID, 1); !errors.Is(err, apperror.ErrPrecondition) {
+		t.Fatalf("Delete with stale version: got %v, want ErrPrecondition", err)
+	}
+	if err := repo.Delete(ctx, alice.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, alice.ID); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+
+	// 削除した ID は再利用しない
+	dave := &model.Singer{Name: "Dave"}
+	if err := repo.Add(ctx, dave); err != nil {
+		t.Fatal(err)
+	}
+	if dave.ID != 12 {
+		t.Fatalf("Add after Delete assigned id=%d, want 12", dave.ID)
+	}
+}
+
+func TestSingerRepositoryList(t *testing.T) {
+	ctx := context.Background()
+	repo := sqldb.NewSingerRepository(openTestDB(t))
+	for _, name := range []string{"Daisy", "alice", "Ellen", "Bella", "Alan", "100%"} {
+		if err := repo.Add(ctx, &model.Singer{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 名前の降順で 2 件ずつ、カーソルをたどってすべて取得する
+	order := repository.Sort{Field: repository.SortFieldName, Desc: true}
+	var names []string
+	page := repository.PageRequest{Limit: 2}
+	for {
+		got, err := repo.List(ctx, repository.SingerQuery{Sort: order, Page: page})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range got.Items {
+			names = append(names, s.Name)
+		}
+		if got.NextCursor == "" {
+			break
+		}
+		page.Cursor = got.NextCursor
+	}
+	want := []string{"Ellen", "Daisy", "Bella", "alice", "Alan", "100%"} // 正規化した名前の順（大文字・小文字を区別しない）
+	if len(names) != len(want) {
+		t.Fatalf("List pages: got %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("List pages: got %v, want %v", names, want)
+		}
+	}
+
+	got, err := repo.List(ctx, repository.SingerQuery{NamePrefix: "AL"})
+	if err != nil || len(got.Items) != 2 || got.Items[0].Name != "alice" || got.Items[1].Name != "Alan" {
+		t.Fatalf("List name_prefix=AL: got %+v, %v", got, err)
+	}
+	got, err = repo.List(ctx, repository.SingerQuery{NamePrefix: "1%"})
+	if err != nil || len(got.Items) != 0 {
+		t.Fatalf("List name_prefix=1%% should treat %% literally: got %+v, %v", got, err)
+	}
+
+	if _, err := repo.List(ctx, repository.SingerQuery{Page: repository.PageRequest{Limit: 1, Cursor: page.Cursor}}); !errors.Is(err, apperror.ErrInvalidArgument) {
+		t.Fatalf("List with cursor from another sort: got %v, want ErrInvalidArgument", err)
+	}
+}
+
+// 正規化した名前はゴミ箱に入っていない歌手の間で一意（サービスの確認をすり抜けた同時の書き込みもインデックスで防ぐ）
+func TestSingerNameIsUnique(t *testing.T) {
+	ctx := context.Background()
+	repo := sqldb.NewSingerRepository(openTestDB(t))
+
+	alice := &model.Singer{Name: "Alice"}
+	bella := &model.Singer{Name: "Bella"}
+	for _, s := range []*model.Singer{alice, bella} {
+		if err := repo.Add(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Add(ctx, &model.Singer{Name: "ＡＬＩＣＥ"}); !errors.Is(err, apperror.ErrConflict) {
+		t.Fatalf("Add same normalized name: got %v, want ErrConflict", err)
+	}
+	if err := repo.Update(ctx, &model.Singer{ID: bella.ID, Name: "alice"}); !errors.Is(err, apperror.ErrConflict) {
+		t.Fatalf("Update to a taken name: got %v, want ErrConflict", err)
+	}
+
+	// ゴミ箱の歌手の名前は使えるが、同じ名前の歌手がいる間は元に戻せない
+	if err := repo.Delete(ctx, alice.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(ctx, &model.Singer{Name: "Alice"}); err != nil {
+		t.Fatalf("Add the name of a trashed singer: %v", err)
+	}
+	if _, err := repo.Restore(ctx, alice.ID); !errors.Is(err, apperror.ErrConflict) {
+		t.Fatalf("Restore with a taken name: got %v, want ErrConflict", err)
+	}
+
+	// 同じ名前を同時に追加した場合は 1 件だけ成功する
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repo.Add(ctx, &model.Singer{Name: "Chris"})
+		}(i)
+	}
+	wg.Wait()
+	added := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			added++
+		case !errors.Is(err, apperror.ErrConflict):
+			t.Fatalf("concurrent Add: got %v, want ErrConflict", err)
+		}
+	}
+	if added != 1 {
+		t.Fatalf("concurrent Add of the same name: %d succeeded, want 1", added)
+	}
+}
+
+func TestAlbumRepository(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	singers := sqldb.NewSingerRepository(db)
+	albums := sqldb.NewAlbumRepository(db)
+
+	alice := &model.Singer{Name: "Alice"}
+	bella := &model.Singer{Name: "Bella"}
+	for _, s := range []*model.Singer{alice, bella} {
+		if err := singers.Add(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := albums.Add(ctx, &model.Album{Title: "Ghost", SingerID: 999}); err == nil {
+		t.Fatal("Add album for missing singer: want foreign key error")
+	}
+	for _, a := range []*model.Album{
+		{Title: "Alice's 1st Album", SingerID: alice.ID},
+		{Title: "Alice's 2nd Album", SingerID: alice.ID},
+		{Title: "Bella's 1st Album", SingerID: bella.ID},
+	} {
+		if err := albums.Add(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := albums.ListBySinger(ctx, alice.ID)
+	if err != nil || len(got) != 2 || got[0].ID != 1 || got[1].ID != 2 {
+		t.Fatalf("ListBySinger: got %+v, %v", got, err)
+	}
+
+	page, err := albums.List(ctx, repository.AlbumQuery{
+		TitleContains: "1ST",
+		Sort:          repository.Sort{Field: repository.SortFieldTitle, Desc: true},
+	})
+	if err != nil || len(page.Items) != 2 || page.Items[0].Title != "Bella's 1st Album" {
+		t.Fatalf("List title_contains=1ST sort=-title: got %+v, %v", page, err)
+	}
+	page, err = albums.List(ctx, repository.AlbumQuery{SingerID: bella.ID})
+	if err != nil || len(page.Items) != 1 || page.Items[0].SingerID != bella.ID {
+		t.Fatalf("List singer_id: got %+v, %v", page, err)
+	}
+
+	moved := &model.Album{ID: 2, Title: "Moved", SingerID: bella.ID}
+	if err := albums.Update(ctx, moved); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := albums.ListBySinger(ctx, bella.ID); len(got) != 2 {
+		t.Fatalf("ListBySinger after Update: got %+v", got)
+	}
+
+	// 歌手をゴミ箱に移動してもアルバムは変わらない
+	if err := singers.Delete(ctx, alice.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := albums.Get(ctx, 1); err != nil || got.SingerID != alice.ID {
+		t.Fatalf("Get album after singer delete: got %+v, %v", got, err)
+	}
+
+	// 歌手を完全に削除するとアルバムは残り、歌手IDは 0 になる
+	if n, err := singers.Purge(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("Purge: got %d, %v", n, err)
+	}
+	orphan, err := albums.Get(ctx, 1)
+	if err != nil || orphan.SingerID != 0 {
+		t.Fatalf("Get album after singer purge: got %+v, %v", orphan, err)
+	}
+}
+
+func TestRunInTx(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	singers := sqldb.NewSingerRepository(db)
+	albums := sqldb.NewAlbumRepository(db)
+
+	alice := &model.Singer{Name: "Alice"}
+	if err := singers.Add(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	errAbort := errors.New("abort")
+	err := db.RunInTx(ctx, func(ctx context.Context) error {
+		if err := albums.Add(ctx, &model.Album{Title: "Rolled back", SingerID: alice.ID}); err != nil {
+			return err
+		}
+		if err := singers.Update(ctx, &model.Singer{ID: alice.ID, Name: "Alicia"}); err != nil {
+			return err
+		}
+		if got, err := singers.Get(ctx, alice.ID); err != nil || got.Name != "Alicia" {
+			t.Errorf("Get inside tx: got %+v, %v", got, err)
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("RunInTx: got %v, want the error returned by fn", err)
+	}
+	if got, _ := singers.Get(ctx, alice.ID); got.Name != "Alice" || got.Version != 1 {
+		t.Fatalf("Update was not rolled back: %+v", got)
+	}
+	if got, _ := albums.GetAll(ctx); len(got) != 0 {
+		t.Fatalf("Add was not rolled back: %+v", got)
+	}
+
+	if err := db.RunInTx(ctx, func(ctx context.Context) error {
+		return albums.Add(ctx, &model.Album{Title: "Committed", SingerID: alice.ID})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := albums.GetAll(ctx); len(got) != 1 {
+		t.Fatalf("committed Add: got %+v", got)
+	}
+}
@@ -0,0 +1,205 @@
+// RDB の tracks テーブルで曲データを保持するリポジトリを実装するためのファイル
+
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// trackRepository 構造体は DB を持ち、tracks テーブルに対して曲データを読み書きする
+type trackRepository struct {
+	db *DB
+}
+
+// インターフェースが正しく実装されていることを確認するためのコード
+var _ repository.TrackRepository = (*trackRepository)(nil)
+
+// NewTrackRepository は tracks テーブルを使う曲のリポジトリを生成する
+func NewTrackRepository(db *DB) *trackRepository {
+	return &trackRepository{db: db}
+}
+
+// trackColumns は SELECT する列（scanTrack の引数と同じ順番）
+const trackColumns = `id, album_id, number, title, duration, version`
+
+// scanTrack は 1 行分の曲データを読み込む
+func scanTrack(row scanner) (*model.Track, error) {
+	var track model.Track
+	if err := row.Scan(&track.ID, &track.AlbumID, &track.Number, &track.Title, &track.Duration, &track.Version); err != nil {
+		return nil, err
+	}
+	return &track, nil
+}
+
+// ListByAlbum は指定されたアルバムIDに紐づく曲を曲順に取得する
+func (r *trackRepository) ListByAlbum(ctx context.Context, albumID model.AlbumID) ([]*model.Track, error) {
+	rows, err := r.db.queryer(ctx).QueryContext(ctx, `SELECT `+trackColumns+` FROM tracks WHERE album_id = $1 ORDER BY number`, albumID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tracks := make([]*model.Track, 0)
+	for rows.Next() {
+		track, err := scanTrack(rows)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, rows.Err()
+}
+
+// Get は曲IDに対応する曲データを取得する。指定されたIDの曲が存在しない場合はエラーを返す
+func (r *trackRepository) Get(ctx context.Context, id model.TrackID) (*model.Track, error) {
+	track, err := scanTrack(r.db.queryer(ctx).QueryRowContext(ctx, `SELECT `+trackColumns+` FROM tracks WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperror.NotFound(apperror.CodeTrackNotFound, "track %d not found", id)
+	}
+	return track, err
+}
+
+// Add は新しい曲を追加する。ID が 0 の場合は採番し、Number が 0 の場合はアルバムの最後の曲順の次にする
+// 指定された ID がすでに存在する場合や、同じアルバムに同じ曲順の曲がある場合はエラーを返す
+func (r *trackRepository) Add(ctx context.Context, track *model.Track) error {
+	return r.db.withTx(ctx, func(tx *sql.Tx) error {
+		if err := r.lockAlbum(ctx, tx, track.AlbumID); err != nil {
+			return err
+		}
+		id, err := allocateID(ctx, tx, "tracks", int(track.ID))
+		if err != nil {
+			return err
+		}
+
+		number := track.Number
+		if number == 0 {
+			if err := tx.QueryRowContext(ctx,
+				`SELECT COALESCE(MAX(number), 0) + 1 FROM tracks WHERE album_id = $1`, track.AlbumID).Scan(&number); err != nil {
+				return err
+			}
+		} else if err := checkTrackNumber(ctx, tx, model.TrackID(id), track.AlbumID, number); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO tracks (id, album_id, number, title, duration, version) VALUES ($1, $2, $3, $4, $5, 1) ON CONFLICT (id) DO NOTHING`,
+			id, track.AlbumID, number, track.Title, track.Duration)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return apperror.AlreadyExists(apperror.CodeTrackAlreadyExists, "track %d already exists", id)
+		}
+
+		track.ID = model.TrackID(id)
+		track.Number = number
+		track.Version = 1
+		return nil
+	})
+}
+
+// Update は曲データを置き換える。指定されたIDの曲が存在しない場合やバージョンが一致しない場合はエラーを返す
+// Number が 0 の場合は現在の曲順のままにする
+func (r *trackRepository) Update(ctx context.Context, track *model.Track) error {
+	return r.db.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := r.lockTrack(ctx, tx, track.ID, track.Version)
+		if err != nil {
+			return err
+		}
+		if track.AlbumID != current.AlbumID {
+			if err := r.lockAlbum(ctx, tx, track.AlbumID); err != nil {
+				return err
+			}
+		}
+
+		number := track.Number
+		if number == 0 {
+			number = current.Number
+		}
+		if err := checkTrackNumber(ctx, tx, track.ID, track.AlbumID, number); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE tracks SET album_id = $1, number = $2, title = $3, duration = $4, version = $5 WHERE id = $6`,
+			track.AlbumID, number, track.Title, track.Duration, current.Version+1, track.ID); err != nil {
+			return err
+		}
+		track.Number = number
+		track.Version = current.Version + 1
+		return nil
+	})
+}
+
+// Delete は指定された曲IDに対応する曲を削除する
+// 指定されたIDの曲が存在しない場合や、version が 0 以外で現在のバージョンと一致しない場合はエラーを返す
+func (r *trackRepository) Delete(ctx context.Context, id model.TrackID, version model.Version) error {
+	return r.db.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := r.lockTrack(ctx, tx, id, version); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM tracks WHERE id = $1`, id)
+		return err
+	})
+}
+
+// DeleteByAlbum は指定されたアルバムIDに紐づく曲をすべて削除し、削除した件数を返す
+// アルバムを完全に削除した場合は外部キー制約（ON DELETE CASCADE）でも削除される
+func (r *trackRepository) DeleteByAlbum(ctx context.Context, albumID model.AlbumID) (int, error) {
+	var deleted int64
+	err := r.db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM tracks WHERE album_id = $1`, albumID)
+		if err != nil {
+			return err
+		}
+		deleted, err = res.RowsAffected()
+		return err
+	})
+	return int(deleted), err
+}
+
+// lockAlbum はアルバムの行をロックして、同じアルバムへの曲の追加を順番に実行させる（曲順を重複なく決めるため）
+// アルバムが存在しない場合は apperror.ErrNotFound を返す
+func (r *trackRepository) lockAlbum(ctx context.Context, tx *sql.Tx, albumID model.AlbumID) error {
+	var id model.AlbumID
+	err := tx.QueryRowContext(ctx, `SELECT id FROM albums WHERE id = $1`+r.db.dialect.forUpdate, albumID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperror.NotFound(apperror.CodeAlbumNotFound, "album %d not found", albumID)
+	}
+	return err
+}
+
+// lockTrack は曲の行をロックして現在の曲データを返す。expected が 0 以外で現在のバージョンと一致しない場合はエラーを返す
+func (r *trackRepository) lockTrack(ctx context.Context, tx *sql.Tx, id model.TrackID, expected model.Version) (*model.Track, error) {
+	current, err := scanTrack(tx.QueryRowContext(ctx, `SELECT `+trackColumns+` FROM tracks WHERE id = $1`+r.db.dialect.forUpdate, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperror.NotFound(apperror.CodeTrackNotFound, "track %d not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expected != 0 && expected != current.Version {
+		return nil, apperror.Precondition(apperror.CodeVersionMismatch, "track %d has version %d, not %d", id, current.Version, expected)
+	}
+	return current, nil
+}
+
+// checkTrackNumber は同じアルバムにほかの曲と同じ曲順がないかを確認する
+func checkTrackNumber(ctx context.Context, tx *sql.Tx, id model.TrackID, albumID model.AlbumID, number int) error {
+	var n int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM tracks WHERE album_id = $1 AND number = $2 AND id <> $3`, albumID, number, id).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return apperror.Conflict(apperror.CodeTrackNumberTaken, "album %d already has track number %d", albumID, number)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// 歌手とアルバムのデータを 1 つの SQLite ファイルに永続化するためのパッケージ
+// SQL の実装は infra/sqldb を SQLite 用の方言で使い、ドライバーには cgo が不要な modernc.org/sqlite を使う
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	_ "modernc.org/sqlite" // database/sql 用の SQLite ドライバー（ドライバー名 "sqlite"）
+
+	"server-recruit-challenge-sample/infra/memorydb"
+	"server-recruit-challenge-sample/infra/sqldb"
+	"server-recruit-challenge-sample/repository"
+)
+
+// DB は SQLite ファイルへの接続
+type DB struct {
+	*sqldb.DB
+}
+
+// Open は path の SQLite ファイルを開く（存在しない場合は作成する）
+// スキーマを最新の状態にし、初めて起動したときは memorydb と同じ初期データを投入する
+func Open(ctx context.Context, path string) (*DB, error) {
+	// 外部キー制約を有効にし、ほかのプロセスが書き込み中の場合は待つ
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(1) // SQLite は同時に 1 つしか書き込めないため、接続を 1 つに限定してロックの競合を避ける
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+
+	db := &DB{DB: sqldb.New(conn, sqldb.SQLite)}
+	if err := db.Migrate(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := db.seed(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("seed %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// seed は memorydb の初期データをそのまま SQLite に投入する（投入済みの場合は何もしない）
+func (db *DB) seed(ctx context.Context) error {
+	singers, err := memorydb.NewSingerRepository().GetAll(ctx) // infra/memorydb/singer.go ファイルの初期データを使う
+	if err != nil {
+		return err
+	}
+	albums, err := memorydb.NewAlbumRepository().GetAll(ctx) // infra/memorydb/album.go ファイルの初期データを使う
+	if err != nil {
+		return err
+	}
+	_, err = db.Seed(ctx, singers, albums)
+	return err
+}
+
+// NewSingerRepository は SQLite ファイルを使う歌手のリポジトリを生成する
+func NewSingerRepository(db *DB) repository.SingerRepository {
+	return sqldb.NewSingerRepository(db.DB) // infra/sqldb/singer.go ファイルの NewSingerRepository 関数を呼び出す
+}
+
+// NewAlbumRepository は SQLite ファイルを使うアルバムのリポジトリを生成する
+func NewAlbumRepository(db *DB) repository.AlbumRepository {
+	return sqldb.NewAlbumRepository(db.DB) // infra/sqldb/album.go ファイルの NewAlbumRepository 関数を呼び出す
+}
+
+// NewTrackRepository は SQLite ファイルを使う曲のリポジトリを生成する
+func NewTrackRepository(db *DB) repository.TrackRepository {
+	return sqldb.NewTrackRepository(db.DB) // infra/sqldb/track.go ファイルの NewTrackRepository 関数を呼び出す
+}
+
+// NewSearchRepository は SQLite ファイルの歌手とアルバムを検索するリポジトリを生成する
+func NewSearchRepository(db *DB) repository.SearchRepository {
+	return sqldb.NewSearchRepository(db.DB) // infra/sqldb/search.go ファイルの NewSearchRepository 関数を呼び出す
+}
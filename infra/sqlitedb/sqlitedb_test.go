@@ -0,0 +1,44 @@
+package sqlitedb_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"server-recruit-challenge-sample/infra/sqlitedb"
+	"server-recruit-challenge-sample/repository"
+	"server-recruit-challenge-sample/repository/repotest"
+)
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository) {
+		db, err := sqlitedb.Open(context.Background(), filepath.Join(t.TempDir(), "catalog.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return sqlitedb.NewSingerRepository(db), sqlitedb.NewAlbumRepository(db)
+	})
+}
+
+func TestTrackConformance(t *testing.T) {
+	repotest.RunTracks(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository, repository.TrackRepository) {
+		db, err := sqlitedb.Open(context.Background(), filepath.Join(t.TempDir(), "catalog.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return sqlitedb.NewSingerRepository(db), sqlitedb.NewAlbumRepository(db), sqlitedb.NewTrackRepository(db)
+	})
+}
+
+func TestSearchConformance(t *testing.T) {
+	repotest.RunSearch(t, func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository, repository.SearchRepository) {
+		db, err := sqlitedb.Open(context.Background(), filepath.Join(t.TempDir(), "catalog.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return sqlitedb.NewSingerRepository(db), sqlitedb.NewAlbumRepository(db), sqlitedb.NewSearchRepository(db)
+	})
+}
@@ -2,21 +2,134 @@ package main // このファイルが main パッケージであることを示
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"time"
 
+	_ "github.com/jackc/pgx/v5/stdlib" // database/sql 用の PostgreSQL ドライバー（ドライバー名 "pgx"）
+
 	"server-recruit-challenge-sample/api"
+	"server-recruit-challenge-sample/api/middleware"
+	"server-recruit-challenge-sample/infra/memorydb"
+	"server-recruit-challenge-sample/infra/sqldb"
+	"server-recruit-challenge-sample/infra/sqlitedb"
+	"server-recruit-challenge-sample/repository"
+	"server-recruit-challenge-sample/service"
 )
 
 func main() {
+	// コマンドライン引数から設定を読み込む
+	singerDeletePolicy := flag.String("singer-delete-policy", "restrict", "アルバムが紐づいている歌手を削除するときの振る舞い (restrict / cascade / orphan)")
+	backend := flag.String("db", "memory", "データの保存先 (memory / postgres / sqlite)")
+	databaseURL := flag.String("database-url", os.Getenv("DATABASE_URL"), "-db=postgres のときの接続文字列（デフォルトは環境変数 DATABASE_URL）")
+	dataDir := flag.String("data-dir", "", "-db=memory のときにログとスナップショットを書き込むディレクトリ（空の場合は永続化しない）")
+	sqlitePath := flag.String("sqlite-path", "catalog.db", "-db=sqlite のときに使う SQLite ファイルのパス")
+	trashRetention := flag.Duration("trash-retention", 30*24*time.Hour, "削除した歌手とアルバムをゴミ箱に残しておく期間（0 の場合は完全に削除しない）")
+	trashPurgeInterval := flag.Duration("trash-purge-interval", time.Hour, "保存期間が過ぎたゴミ箱の歌手とアルバムを完全に削除する間隔")
+	flag.Parse()
+
+	// ログを JSON 形式で標準エラー出力に出力する（log パッケージの出力も slog を通して JSON になる）
+	// context にリクエストIDがある場合は request_id を付ける
+	slog.SetDefault(slog.New(middleware.NewLogHandler(slog.NewJSONHandler(os.Stderr, nil))))
+
+	policy, err := service.ParseSingerDeletePolicy(*singerDeletePolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
+	// -db の指定に従ってリポジトリを作成
+	var singerRepo repository.SingerRepository
+	var albumRepo repository.AlbumRepository
+	var trackRepo repository.TrackRepository
+	var searchRepo repository.SearchRepository
+	var transactor repository.Transactor
+	switch *backend {
+	case "memory":
+		singers := memorydb.NewSingerRepository() // infra/memorydb/singer.go ファイルの NewSingerRepository 関数を呼び出す
+		albums := memorydb.NewAlbumRepository() // infra/memorydb/album.go ファイルの NewAlbumRepository 関数を呼び出す
+		tracks := memorydb.NewTrackRepository() // infra/memorydb/track.go ファイルの NewTrackRepository 関数を呼び出す
+		if *dataDir != "" {
+			var err error
+			singers, err = memorydb.OpenSingerRepository(*dataDir, memorydb.DurableOptions{}) // スナップショットとログから復元する
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer singers.Close()
+			albums, err = memorydb.OpenAlbumRepository(*dataDir, memorydb.DurableOptions{})
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer albums.Close()
+			tracks, err = memorydb.OpenTrackRepository(*dataDir, memorydb.DurableOptions{})
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer tracks.Close()
+		}
+		singerRepo, albumRepo, trackRepo = singers, albums, tracks
+		searchRepo = memorydb.NewSearchRepository(singers, albums) // infra/memorydb/search.go ファイルの NewSearchRepository 関数を呼び出す（歌手とアルバムのリポジトリが持つインデックスで検索する）
+		transactor = memorydb.NewTransactor(singers, albums, tracks) // infra/memorydb/tx.go ファイルの NewTransactor 関数を呼び出す
+	case "postgres":
+		if *databaseURL == "" {
+			log.Fatal("-database-url or DATABASE_URL is required for -db=postgres")
+		}
+		db, err := sqldb.Open(ctx, "pgx", *databaseURL, sqldb.Postgres) // 接続してスキーマを最新の状態にする
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+		singerRepo = sqldb.NewSingerRepository(db) // infra/sqldb/singer.go ファイルの NewSingerRepository 関数を呼び出す
+		albumRepo = sqldb.NewAlbumRepository(db) // infra/sqldb/album.go ファイルの NewAlbumRepository 関数を呼び出す
+		trackRepo = sqldb.NewTrackRepository(db) // infra/sqldb/track.go ファイルの NewTrackRepository 関数を呼び出す
+		searchRepo = sqldb.NewSearchRepository(db) // infra/sqldb/search.go ファイルの NewSearchRepository 関数を呼び出す
+		transactor = db
+	case "sqlite":
+		db, err := sqlitedb.Open(ctx, *sqlitePath) // ファイルがなければ作成し、初回は初期データを投入する
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+		singerRepo = sqlitedb.NewSingerRepository(db) // infra/sqlitedb/sqlitedb.go ファイルの NewSingerRepository 関数を呼び出す
+		albumRepo = sqlitedb.NewAlbumRepository(db) // infra/sqlitedb/sqlitedb.go ファイルの NewAlbumRepository 関数を呼び出す
+		trackRepo = sqlitedb.NewTrackRepository(db) // infra/sqlitedb/sqlitedb.go ファイルの NewTrackRepository 関数を呼び出す
+		searchRepo = sqlitedb.NewSearchRepository(db) // infra/sqlitedb/sqlitedb.go ファイルの NewSearchRepository 関数を呼び出す
+		transactor = db
+	default:
+		log.Fatalf("unknown db: %q", *backend)
+	}
+
 	// api パッケージ内の NewRouter 関数を呼び出して、新しいルーターを作成
-	r := api.NewRouter()
+	r := api.NewRouter(api.Config{
+		SingerRepository:   singerRepo,
+		AlbumRepository:    albumRepo,
+		TrackRepository:    trackRepo,
+		SearchRepository:   searchRepo,
+		Transactor:         transactor,
+		SingerDeletePolicy: policy,
+	})
+
+	// 保存期間が過ぎたゴミ箱の歌手とアルバムをバックグラウンドで完全に削除する
+	var background sync.WaitGroup // 終了する前に、実行中の削除のトランザクションが終わるまで待つ
+	if *trashRetention > 0 {
+		if *trashPurgeInterval <= 0 {
+			log.Fatal("-trash-purge-interval must be positive")
+		}
+		purger := service.NewTrashPurger(singerRepo, albumRepo, trackRepo, transactor, *trashRetention) // service/trash.go ファイルの NewTrashPurger 関数を呼び出す
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			purger.Run(ctx, *trashPurgeInterval) // 割り込みが発生すると戻る
+		}()
+	}
 
 	// HTTPサーバーの設定
 	server := &http.Server{
@@ -24,12 +137,23 @@ func main() {
 		Handler: r,       // ルーターをハンドラーとして設定
 	}
 	// ゴルーチン（非同期処理）を開始し、割り込み（os.Interrupt）が発生した場合にサーバーを graceful にシャットダウン
+	shutdown := make(chan struct{}) // シャットダウンが終わったら閉じる
 	go func() {
+		defer close(shutdown)
 		<-ctx.Done() // 割り込みが発生するまで待機
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // 5秒間のタイムアウトを設定
 		defer cancel()
-		server.Shutdown(ctx) // シャットダウン
+		if err := server.Shutdown(ctx); err != nil { // シャットダウン（処理中のリクエストが終わるまで待つ）
+			slog.Error("shutdown failed", "error", err.Error())
+		}
 	}()
 	log.Println("server start running at :8888") // ログを出力
-	log.Fatal(server.ListenAndServe()) // サーバーを起動 (エラーが発生した場合はログを出力して終了)
+	// サーバーを起動 (Shutdown を呼ぶと http.ErrServerClosed を返すので、それ以外のエラーの場合だけログを出力して終了)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	// log.Fatal（os.Exit）で終了すると defer が実行されないので、シャットダウンとゴミ箱の削除が終わるのを待ってから戻り、defer でリポジトリと DB を閉じる
+	<-shutdown
+	background.Wait()
+	slog.Info("server stopped")
 }
@@ -2,10 +2,55 @@
 
 package model // このファイルが model パッケージであることを示す
 
+import (
+	"strconv"
+	"time"
+)
+
 type AlbumID int // アルバム（Album）の ID
 
 type Album struct { // アルバム（Album）の構造体
-	ID       AlbumID  `json:"id"`
-	Title    string   `json:"title"`
-	SingerID SingerID `json:"singer_id"` // モデル Singer の ID と紐づきます
+	ID          AlbumID    `json:"id"`
+	Title       string     `json:"title"`
+	SingerID    SingerID   `json:"singer_id"`              // モデル Singer の ID と紐づきます
+	ReleaseDate string     `json:"release_date,omitempty"` // 発売日（YYYY-MM-DD 形式）。不明な場合は空文字
+	Genres      []string   `json:"genres,omitempty"`       // ジャンルの一覧（登録した順）
+	Credits     []Credit   `json:"credits,omitempty"`      // クレジットされた歌手の一覧（登録した順）。SingerID の歌手も primary として含む。空の場合は SingerID の歌手だけ
+	Version     Version    `json:"version"`                // 更新のたびに増えるバージョン（ETag として使う）
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`   // 削除された（ゴミ箱に入った）日時。削除されていない場合は nil
+}
+
+// SortKey はタイトルで並び替えるときに使う値（タイトルを NormalizeText で正規化したもの）を返す
+func (a *Album) SortKey() string {
+	return NormalizeText(a.Title)
+}
+
+// ValidationRules はアルバムの各項目に対する検証ルールを返す
+func (a *Album) ValidationRules() []Rule {
+	rules := []Rule{
+		PositiveOrZero("id", int(a.ID)),
+		NotBlank("title", a.Title),
+		MaxLength("title", a.Title, AlbumTitleMaxLength),
+		Positive("singer_id", int(a.SingerID)),
+		Date("release_date", a.ReleaseDate),
+		MaxItems("genres", len(a.Genres), AlbumGenresMaxItems),
+		Unique("genres", a.Genres),
+	}
+	for i, genre := range a.Genres {
+		field := "genres[" + strconv.Itoa(i) + "]"
+		rules = append(rules, NotBlank(field, genre), MaxLength(field, genre, GenreMaxLength))
+	}
+	return append(rules, a.creditRules()...)
+}
+
+// AlbumWithSinger はアルバムに歌手（Singer）の情報を付加したレスポンス用の構造体
+type AlbumWithSinger struct {
+	ID          AlbumID             `json:"id"`
+	Title       string              `json:"title"`
+	Singer      *Singer             `json:"singer"` // 歌手が見つからない（削除された）場合は null
+	ReleaseDate string              `json:"release_date,omitempty"`
+	Genres      []string            `json:"genres,omitempty"`
+	Credits     []*CreditWithSinger `json:"credits"`              // クレジットされた歌手の一覧（SingerID の歌手を含む）
+	Version     Version             `json:"version"`              // アルバムのバージョン
+	DeletedAt   *time.Time          `json:"deleted_at,omitempty"` // アルバムが削除された日時
 }
@@ -0,0 +1,19 @@
+// カタログ（歌手とアルバム）のインポート・エクスポートで扱うデータモデルを定義するためのパッケージ
+
+package model // このファイルが model パッケージであることを示す
+
+// CatalogRecordType はインポート・エクスポートする 1 件のデータの種類
+type CatalogRecordType string
+
+const (
+	CatalogSinger CatalogRecordType = "singer" // 歌手
+	CatalogAlbum  CatalogRecordType = "album"  // アルバム
+)
+
+// CatalogRecord はインポート・エクスポートする 1 件のデータ。Type に応じて Singer か Album のどちらかが設定される
+// エクスポートでは歌手をすべて書き出してからアルバムを書き出すので、そのままインポートすればアルバムが参照する歌手は先に登録される
+type CatalogRecord struct {
+	Type   CatalogRecordType
+	Singer *Singer
+	Album  *Album
+}
@@ -0,0 +1,88 @@
+// アルバムにクレジットされた歌手（Credit）に関するデータモデルを定義するためのパッケージ
+
+package model // このファイルが model パッケージであることを示す
+
+import "strconv"
+
+// CreditRole はアルバムでの歌手の役割
+type CreditRole string
+
+const (
+	CreditPrimary  CreditRole = "primary"  // メインの歌手（デュエットやコンピレーションでは複数になる）
+	CreditFeatured CreditRole = "featured" // フィーチャリングで参加した歌手
+	CreditComposer CreditRole = "composer" // 作曲者
+)
+
+type Credit struct { // アルバムにクレジットされた歌手の構造体
+	SingerID SingerID   `json:"singer_id"` // モデル Singer の ID と紐づきます
+	Role     CreditRole `json:"role"`
+}
+
+// CreditWithSinger はクレジットに歌手（Singer）の情報を付加したレスポンス用の構造体
+type CreditWithSinger struct {
+	SingerID SingerID   `json:"singer_id"`
+	Role     CreditRole `json:"role"`
+	Singer   *Singer    `json:"singer"` // 歌手が見つからない（削除された）場合は null
+}
+
+// CreditList はアルバムのクレジットを返す。クレジットが登録されていないアルバムは SingerID の歌手だけを primary として返す
+// （歌手が完全に削除されて SingerID が 0 になった場合は空）
+func (a *Album) CreditList() []Credit {
+	if len(a.Credits) == 0 {
+		if a.SingerID == 0 {
+			return nil
+		}
+		return []Credit{{SingerID: a.SingerID, Role: CreditPrimary}}
+	}
+	return a.Credits
+}
+
+// CreditedSingerIDs はアルバムの SingerID とクレジットされた歌手のIDを、重複を除いて登場した順に返す
+func (a *Album) CreditedSingerIDs() []SingerID {
+	ids := []SingerID{a.SingerID}
+	seen := map[SingerID]struct{}{a.SingerID: {}}
+	for _, c := range a.Credits {
+		if _, ok := seen[c.SingerID]; !ok {
+			seen[c.SingerID] = struct{}{}
+			ids = append(ids, c.SingerID)
+		}
+	}
+	return ids
+}
+
+// HasCredit はアルバムの SingerID またはクレジットに歌手が含まれているかを返す
+func (a *Album) HasCredit(singerID SingerID) bool {
+	if a.SingerID == singerID {
+		return true
+	}
+	for _, c := range a.Credits {
+		if c.SingerID == singerID {
+			return true
+		}
+	}
+	return false
+}
+
+// creditRules はクレジットの一覧に対する検証ルールを返す
+// 同じ歌手が同じ役割で重複してはならず、SingerID の歌手は primary としてクレジットされていなければならない
+func (a *Album) creditRules() []Rule {
+	keys := make([]string, len(a.Credits))
+	primary := len(a.Credits) == 0 || a.SingerID == 0 // クレジットを省略した場合は SingerID の歌手だけが primary になる（singer_id がない場合は別のルールで報告する）
+	rules := []Rule{MaxItems("credits", len(a.Credits), AlbumCreditsMaxItems)}
+	for i, c := range a.Credits {
+		field := "credits[" + strconv.Itoa(i) + "]"
+		rules = append(rules,
+			Positive(field+".singer_id", int(c.SingerID)),
+			OneOf(field+".role", string(c.Role), string(CreditPrimary), string(CreditFeatured), string(CreditComposer)),
+		)
+		keys[i] = strconv.Itoa(int(c.SingerID)) + "/" + string(c.Role)
+		if c.SingerID == a.SingerID && c.Role == CreditPrimary {
+			primary = true
+		}
+	}
+	rules = append(rules,
+		Unique("credits", keys),
+		Rule{Field: "credits", Message: "must include singer_id as a primary credit", OK: primary},
+	)
+	return rules
+}
@@ -0,0 +1,49 @@
+// 名前やタイトルを並び替え・絞り込み・重複の確認のために正規化するためのファイル
+
+package model // このファイルが model パッケージであることを示す
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeText は文字列を比較用に正規化する
+// NFKC で全角英数字・半角カタカナなどの幅をそろえ（ＡＢＣ → ABC、ｶﾞ → ガ）、小文字にし、カタカナをひらがなにそろえる
+// 連続する空白は 1 つの半角スペースにし、前後の空白は取り除く
+func NormalizeText(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range norm.NFKC.String(s) {
+		if unicode.IsSpace(r) {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(FoldKana(unicode.ToLower(r)))
+	}
+	return b.String()
+}
+
+// FoldKana はカタカナをひらがなに変換する。対応するひらがながない文字（ヷ や ー など）はそのまま返す
+func FoldKana(r rune) rune {
+	switch {
+	case r >= 'ァ' && r <= 'ヶ', r == 'ヽ' || r == 'ヾ':
+		return r - ('ァ' - 'ぁ')
+	}
+	return r
+}
+
+// isKana は読み（ひらがな・カタカナ）に使える文字かを返す
+func isKana(r rune) bool {
+	return unicode.In(r, unicode.Hiragana, unicode.Katakana) || r == 'ー' || r == '・' || unicode.IsSpace(r)
+}
+
+// isRomaji はローマ字表記に使える文字（ラテン文字・数字・空白・記号）かを返す
+func isRomaji(r rune) bool {
+	return unicode.Is(unicode.Latin, r) || unicode.IsDigit(r) || unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.Is(unicode.Mn, r)
+}
@@ -0,0 +1,19 @@
+// 全文検索（Search）の結果に関するデータモデルを定義するためのパッケージ
+
+package model // このファイルが model パッケージであることを示す
+
+// SearchType は検索結果の種類
+type SearchType string
+
+const (
+	SearchTypeSinger SearchType = "singer" // 歌手の名前に一致した
+	SearchTypeAlbum  SearchType = "album"  // アルバムのタイトルに一致した
+)
+
+type SearchHit struct { // 全文検索の結果の 1 件
+	Type      SearchType `json:"type"`
+	ID        int        `json:"id"`        // Type が singer の場合は SingerID、album の場合は AlbumID
+	Text      string     `json:"text"`      // 歌手の名前またはアルバムのタイトル
+	Highlight string     `json:"highlight"` // Text の一致した部分を <em> と </em> で囲んだ HTML（ほかの部分はエスケープ済み）
+	Score     float64    `json:"score"`     // 一致の度合い（大きいほど上位）
+}
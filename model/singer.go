@@ -2,9 +2,54 @@
 
 package model // このファイルが model パッケージであることを示す
 
+import (
+	"strings"
+	"time"
+)
+
 type SingerID int // 歌手（Singer）の ID
 
 type Singer struct { // 歌手（Singer）の構造体
-	ID   SingerID `json:"id"`
-	Name string   `json:"name"`
-}
\ No newline at end of file
+	ID         SingerID   `json:"id"`
+	Name       string     `json:"name"`
+	NameKana   string     `json:"name_kana,omitempty"`   // 名前の読み（ひらがなまたはカタカナ）。名前で並び替えるときに使う
+	NameRomaji string     `json:"name_romaji,omitempty"` // 名前のローマ字表記
+	Version    Version    `json:"version"`               // 更新のたびに増えるバージョン（ETag として使う）
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`  // 削除された（ゴミ箱に入った）日時。削除されていない場合は nil
+}
+
+// ValidationRules は歌手の各項目に対する検証ルールを返す
+func (s *Singer) ValidationRules() []Rule {
+	return []Rule{
+		PositiveOrZero("id", int(s.ID)),
+		NotBlank("name", s.Name),
+		MaxLength("name", s.Name, SingerNameMaxLength),
+		MaxLength("name_kana", s.NameKana, SingerNameMaxLength),
+		Kana("name_kana", s.NameKana),
+		MaxLength("name_romaji", s.NameRomaji, SingerNameMaxLength),
+		Romaji("name_romaji", s.NameRomaji),
+	}
+}
+
+// NameKey は同じ名前の歌手かを判定するために正規化した名前を返す（全角・半角、大文字・小文字、ひらがな・カタカナの違いを無視する）
+func (s *Singer) NameKey() string {
+	return NormalizeText(s.Name)
+}
+
+// SortKey は名前で並び替えるときに使う値を返す。読みがある場合は読みを、ない場合は名前を正規化したもの
+func (s *Singer) SortKey() string {
+	if s.NameKana != "" {
+		return NormalizeText(s.NameKana)
+	}
+	return s.NameKey()
+}
+
+// HasNamePrefix は名前・読み・ローマ字表記のいずれかが prefix で始まるかを返す。prefix は NormalizeText で正規化しておくこと
+func (s *Singer) HasNamePrefix(prefix string) bool {
+	for _, name := range []string{s.Name, s.NameKana, s.NameRomaji} {
+		if name != "" && strings.HasPrefix(NormalizeText(name), prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+// 曲（Track）に関するデータモデルを定義するためのパッケージ
+
+package model // このファイルが model パッケージであることを示す
+
+type TrackID int // 曲（Track）の ID
+
+type Track struct { // 曲（Track）の構造体
+	ID       TrackID `json:"id"`
+	AlbumID  AlbumID `json:"album_id"` // モデル Album の ID と紐づきます
+	Number   int     `json:"number"`   // アルバムの中での曲順（1 から始まり、同じアルバムの中で重複しない）
+	Title    string  `json:"title"`
+	Duration int     `json:"duration"` // 再生時間（秒）
+	Version  Version `json:"version"`  // 更新のたびに増えるバージョン（ETag として使う）
+}
+
+// ValidationRules は曲の各項目に対する検証ルールを返す
+func (t *Track) ValidationRules() []Rule {
+	return []Rule{
+		PositiveOrZero("id", int(t.ID)),
+		PositiveOrZero("number", t.Number),
+		NotBlank("title", t.Title),
+		MaxLength("title", t.Title, TrackTitleMaxLength),
+		Positive("duration", t.Duration),
+	}
+}
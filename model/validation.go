@@ -0,0 +1,132 @@
+// モデルの入力値を検証するためのルールを定義するためのファイル
+// 各モデルは ValidationRules で自分の項目に対するルールを宣言し、Validate がまとめて検証する
+
+package model // このファイルが model パッケージであることを示す
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"server-recruit-challenge-sample/apperror"
+)
+
+// 項目の長さの上限（文字数）
+const (
+	SingerNameMaxLength = 100
+	AlbumTitleMaxLength = 200
+	GenreMaxLength      = 50
+	TrackTitleMaxLength = 200
+)
+
+// 一覧の項目の件数の上限
+const (
+	AlbumGenresMaxItems  = 10
+	AlbumCreditsMaxItems = 50
+)
+
+// DateLayout は日付（発売日など）の JSON 上の形式
+const DateLayout = "2006-01-02"
+
+// Rule は 1 つの項目に対する検証ルールとその結果を表す
+type Rule struct {
+	Field   string // 項目名（JSON のキー）
+	Message string // ルールに違反した場合のメッセージ
+	OK      bool   // ルールを満たしているか
+}
+
+// Validatable は検証ルールを宣言できるモデル
+type Validatable interface {
+	ValidationRules() []Rule
+}
+
+// Validate は v のすべてのルールを検証し、違反があればすべての違反をまとめた apperror.ErrValidation を返す
+func Validate(v Validatable) error {
+	var violations []apperror.Violation
+	for _, rule := range v.ValidationRules() {
+		if !rule.OK {
+			violations = append(violations, apperror.Violation{Field: rule.Field, Message: rule.Message})
+		}
+	}
+	if len(violations) > 0 {
+		return apperror.ValidationFailed(violations)
+	}
+	return nil
+}
+
+// NotBlank は前後の空白を除いた文字列が空でないことを確認するルール
+func NotBlank(field, value string) Rule {
+	return Rule{Field: field, Message: "must not be blank", OK: strings.TrimSpace(value) != ""}
+}
+
+// MaxLength は文字列の長さ（文字数）が max 以下であることを確認するルール
+func MaxLength(field, value string, max int) Rule {
+	return Rule{Field: field, Message: "must be at most " + strconv.Itoa(max) + " characters", OK: utf8.RuneCountInString(value) <= max}
+}
+
+// Positive は ID などの整数が正の値であることを確認するルール
+func Positive(field string, value int) Rule {
+	return Rule{Field: field, Message: "must be a positive integer", OK: value > 0}
+}
+
+// PositiveOrZero は ID などの整数が 0 以上であることを確認するルール（0 はサーバーによる採番を表す）
+func PositiveOrZero(field string, value int) Rule {
+	return Rule{Field: field, Message: "must be a positive integer or omitted", OK: value >= 0}
+}
+
+// Date は文字列が YYYY-MM-DD 形式の実在する日付であることを確認するルール（空文字は省略を表す）
+func Date(field, value string) Rule {
+	_, err := time.Parse(DateLayout, value)
+	return Rule{Field: field, Message: "must be a date in YYYY-MM-DD format", OK: value == "" || err == nil}
+}
+
+// MaxItems は一覧の件数が max 以下であることを確認するルール
+func MaxItems(field string, count, max int) Rule {
+	return Rule{Field: field, Message: "must have at most " + strconv.Itoa(max) + " items", OK: count <= max}
+}
+
+// Unique は一覧に（大文字・小文字を区別せずに）同じ文字列が含まれていないことを確認するルール
+func Unique(field string, values []string) Rule {
+	seen := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		key := strings.ToLower(v)
+		if _, ok := seen[key]; ok {
+			return Rule{Field: field, Message: "must not contain duplicates", OK: false}
+		}
+		seen[key] = struct{}{}
+	}
+	return Rule{Field: field, OK: true}
+}
+
+// Kana は文字列がひらがな・カタカナ（半角を含む）と長音記号・中黒・空白だけでできていることを確認するルール（空文字は省略を表す）
+func Kana(field, value string) Rule {
+	return Rule{Field: field, Message: "must contain only hiragana or katakana", OK: onlyRunes(value, isKana)}
+}
+
+// Romaji は文字列がラテン文字（全角を含む）と数字・空白・記号だけでできていることを確認するルール（空文字は省略を表す）
+func Romaji(field, value string) Rule {
+	return Rule{Field: field, Message: "must contain only latin letters", OK: onlyRunes(value, isRomaji)}
+}
+
+// onlyRunes は NFKC で正規化した文字列のすべての文字が ok を満たすかを返す
+func onlyRunes(value string, ok func(rune) bool) bool {
+	for _, r := range norm.NFKC.String(value) {
+		if !ok(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// OneOf は文字列が allowed のいずれかであることを確認するルール
+func OneOf(field, value string, allowed ...string) Rule {
+	for _, a := range allowed {
+		if value == a {
+			return Rule{Field: field, OK: true}
+		}
+	}
+	return Rule{Field: field, Message: "must be one of " + strings.Join(allowed, ", "), OK: false}
+}
@@ -0,0 +1,7 @@
+// 楽観的排他制御のためのバージョンを定義するためのファイル
+
+package model // このファイルが model パッケージであることを示す
+
+// Version はリソースが更新されるたびに 1 ずつ増えるバージョン番号
+// リポジトリに渡すときに 0 を指定した場合は、バージョンを確認せずに更新・削除する
+type Version int
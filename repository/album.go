@@ -5,14 +5,21 @@ package repository // このファイルが repository パッケージである
 
 import (
 	"context"
+	"time"
 
 	"server-recruit-challenge-sample/model"
 )
 
 // AlbumRepository インターフェース：アルバムに関するデータの永続化と取得に必要な基本的なメソッドを定義
 type AlbumRepository interface {
-	GetAll(ctx context.Context) ([]*model.Album, error)               // すべてのアルバムを取得
-	Get(ctx context.Context, id model.AlbumID) (*model.Album, error) // 指定されたアルバムIDに対応するアルバムを取得
-	Add(ctx context.Context, album *model.Album) error               // 新しいアルバムを追加
-	Delete(ctx context.Context, id model.AlbumID) error               // 指定されたアルバムIDに対応するアルバムを削除
+	GetAll(ctx context.Context) ([]*model.Album, error)                                // すべてのアルバムをID順に取得
+	List(ctx context.Context, query AlbumQuery) (*Page[*model.Album], error)           // 条件に合うアルバムを指定された順にページ単位で取得
+	Get(ctx context.Context, id model.AlbumID) (*model.Album, error)                   // 指定されたアルバムIDに対応するアルバムを取得
+	ListBySinger(ctx context.Context, singerID model.SingerID) ([]*model.Album, error) // 指定された歌手IDの歌手がクレジットされた（SingerID または Credits に含まれる）アルバムをID順に取得
+	Add(ctx context.Context, album *model.Album) error                                 // 新しいアルバムを追加（Version は 1 になる。ID が 0 の場合は採番して album.ID に設定し、既存の ID と重複する場合は apperror.ErrAlreadyExists を返す）
+	Update(ctx context.Context, album *model.Album) error                              // album.ID に対応するアルバムを置き換え、album.Version を新しいバージョンにする（存在しない場合は apperror.ErrNotFound、album.Version が 0 以外で現在のバージョンと異なる場合は apperror.ErrPrecondition を返す）
+	Delete(ctx context.Context, id model.AlbumID, version model.Version) error         // 指定されたアルバムIDに対応するアルバムをゴミ箱に移動（DeletedAt を設定してバージョンを上げる。以降は Get や一覧から見えなくなる。存在しない場合は apperror.ErrNotFound、version が 0 以外で現在のバージョンと異なる場合は apperror.ErrPrecondition を返す）
+	Restore(ctx context.Context, id model.AlbumID) (*model.Album, error)               // ゴミ箱のアルバムを元に戻してバージョンを上げる（ゴミ箱にない場合は apperror.ErrNotFound を返す）
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)                   // deletedBefore より前にゴミ箱に移動したアルバムを完全に削除し、削除した件数を返す
+	UnlinkSinger(ctx context.Context, singerID model.SingerID) (int, error)            // 指定された歌手IDの歌手がクレジットされたアルバム（ゴミ箱のアルバムも含む）から歌手を外し（SingerID の場合は 0 にし、Credits からは削除する）、バージョンを上げて変更した件数を返す（歌手を完全に削除するときに使う）
 }
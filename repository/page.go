@@ -0,0 +1,53 @@
+// 一覧取得のページング（カーソル方式）に関する型を定義するためのファイル
+
+package repository // このファイルが repository パッケージであることを示す
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"server-recruit-challenge-sample/apperror"
+)
+
+// PageRequest は一覧取得で要求するページを表す
+type PageRequest struct {
+	Limit  int    // 取得する最大件数（0 以下の場合は件数を制限しない）
+	Cursor string // 前のページの Page.NextCursor（空文字の場合は先頭から）
+}
+
+// Page は一覧取得の結果のうち 1 ページ分を表す
+type Page[T any] struct {
+	Items      []T
+	NextCursor string // 次のページを取得するためのカーソル（最後のページの場合は空文字）
+}
+
+// Cursor はページの境界（直前のページの最後の要素）を表す
+// クライアントには EncodeCursor で不透明な文字列にして渡す
+type Cursor struct {
+	Sort string `json:"s,omitempty"` // カーソルを発行したときの並び順（Sort.String()）
+	Key  string `json:"k,omitempty"` // 直前のページの最後の要素の並び替えに使った値
+	ID   int    `json:"id"`          // 直前のページの最後の要素の ID
+}
+
+// EncodeCursor はカーソルをクライアントに渡す文字列に変換する
+func EncodeCursor(c Cursor) string {
+	b, _ := json.Marshal(c) // Cursor は常に JSON に変換できる
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor はクライアントから受け取った文字列をカーソルに変換する
+// カーソルが order とは別の並び順で発行されたものの場合はエラーを返す
+func DecodeCursor(s string, order Sort) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, apperror.InvalidArgument(apperror.CodeInvalidCursor, "invalid cursor")
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, apperror.InvalidArgument(apperror.CodeInvalidCursor, "invalid cursor")
+	}
+	if c.Sort != order.String() {
+		return c, apperror.InvalidArgument(apperror.CodeInvalidCursor, "cursor was issued for sort=%s", c.Sort)
+	}
+	return c, nil
+}
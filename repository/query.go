@@ -0,0 +1,49 @@
+// 一覧取得の絞り込み条件と並び順（クエリ）を定義するためのファイル
+
+package repository // このファイルが repository パッケージであることを示す
+
+import "server-recruit-challenge-sample/model"
+
+// 並び替えに使える項目
+const (
+	SortFieldID    = "id"
+	SortFieldName  = "name"
+	SortFieldTitle = "title"
+)
+
+// Sort は一覧取得の並び順を表す
+// 同じ値の要素どうしは ID で並べるため、どの並び順でも結果は一意に決まる
+type Sort struct {
+	Field string // 並び替えに使う項目（空文字の場合は SortFieldID）
+	Desc  bool   // true の場合は降順
+}
+
+// String は並び順を ?sort= に指定する形式（例: "-title"）で返す
+func (s Sort) String() string {
+	field := s.Field
+	if field == "" {
+		field = SortFieldID
+	}
+	if s.Desc {
+		return "-" + field
+	}
+	return field
+}
+
+// SingerQuery は歌手の一覧取得の条件を表す
+type SingerQuery struct {
+	NamePrefix     string // 名前・読み・ローマ字表記のいずれかがこの文字列で始まる歌手だけを取得する（model.NormalizeText で正規化して比較する）
+	NameEquals     string // 正規化した名前（model.Singer.NameKey）がこの文字列を正規化したものと一致する歌手だけを取得する
+	IncludeDeleted bool   // true の場合はゴミ箱の歌手も含める
+	Sort           Sort   // SortFieldID または SortFieldName（読みがある場合は読み、ない場合は名前を正規化したものの順）
+	Page           PageRequest
+}
+
+// AlbumQuery はアルバムの一覧取得の条件を表す
+type AlbumQuery struct {
+	SingerID       model.SingerID // 0 以外の場合はこの歌手がクレジットされたアルバムだけを取得する
+	TitleContains  string         // タイトルにこの文字列を含むアルバムだけを取得する（model.NormalizeText で正規化して比較する）
+	IncludeDeleted bool           // true の場合はゴミ箱のアルバムも含める
+	Sort           Sort           // SortFieldID または SortFieldTitle（タイトルを正規化したものの順）
+	Page           PageRequest
+}
@@ -0,0 +1,1222 @@
+// Package repotest は SingerRepository と AlbumRepository の実装が守るべき振る舞いを確認するテストスイートを提供する
+// 新しい保存先を実装したときは、その実装のテストから Run を呼び出して同じ契約を満たしていることを確認する
+// 並行処理のテストもあるので go test -race で実行すること
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// Factory はテストごとに新しいリポジトリを生成する。歌手とアルバムは同じ保存先を共有していること
+// 初期データが入っていてもよい（スイートが最初にすべて削除する）
+type Factory func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository)
+
+// Run はすべてのテストをサブテストとして実行する
+func Run(t *testing.T, newRepos Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository)
+	}{
+		{"SingerCRUD", testSingerCRUD},
+		{"SingerNotFound", testSingerNotFound},
+		{"SingerVersion", testSingerVersion},
+		{"SingerIDsAreNotReused", testSingerIDsAreNotReused},
+		{"SingerOrdering", testSingerOrdering},
+		{"SingerReadings", testSingerReadings},
+		{"SingerPagination", testSingerPagination},
+		{"SingerConcurrentAdd", testSingerConcurrentAdd},
+		{"SingerConcurrentUpdate", testSingerConcurrentUpdate},
+		{"SingerTrash", testSingerTrash},
+		{"SingerPurgeWithAlbums", testSingerPurgeWithAlbums},
+		{"AlbumCRUD", testAlbumCRUD},
+		{"AlbumNotFound", testAlbumNotFound},
+		{"AlbumVersion", testAlbumVersion},
+		{"AlbumListBySinger", testAlbumListBySinger},
+		{"AlbumCredits", testAlbumCredits},
+		{"AlbumOrdering", testAlbumOrdering},
+		{"AlbumConcurrentReadWrite", testAlbumConcurrentReadWrite},
+		{"AlbumTrash", testAlbumTrash},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			singers, albums := newRepos(t)
+			reset(t, singers, albums)
+			tt.fn(t, singers, albums)
+		})
+	}
+}
+
+// TrackFactory はテストごとに新しいリポジトリを生成する。3 つのリポジトリは同じ保存先を共有していること
+type TrackFactory func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository, repository.TrackRepository)
+
+// RunTracks は TrackRepository のテストをサブテストとして実行する
+func RunTracks(t *testing.T, newRepos TrackFactory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, albums repository.AlbumRepository, tracks repository.TrackRepository, albumID model.AlbumID)
+	}{
+		{"TrackCRUD", testTrackCRUD},
+		{"TrackNumbers", testTrackNumbers},
+		{"TrackVersion", testTrackVersion},
+		{"TrackDeleteByAlbum", testTrackDeleteByAlbum},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			singers, albums, tracks := newRepos(t)
+			reset(t, singers, albums)
+			singer := addSinger(t, singers, "Alice")
+			album := addAlbum(t, albums, "First", singer.ID)
+			tt.fn(t, albums, tracks, album.ID)
+		})
+	}
+}
+
+// SearchFactory はテストごとに新しいリポジトリを生成する。検索用のリポジトリは歌手とアルバムと同じ保存先を検索すること
+type SearchFactory func(t *testing.T) (repository.SingerRepository, repository.AlbumRepository, repository.SearchRepository)
+
+// RunSearch は SearchRepository のテストをサブテストとして実行する
+func RunSearch(t *testing.T, newRepos SearchFactory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository, search repository.SearchRepository)
+	}{
+		{"SearchRanking", testSearchRanking},
+		{"SearchFolding", testSearchFolding},
+		{"SearchFollowsWrites", testSearchFollowsWrites},
+		{"SearchTypesAndLimit", testSearchTypesAndLimit},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			singers, albums, search := newRepos(t)
+			reset(t, singers, albums)
+			tt.fn(t, singers, albums, search)
+		})
+	}
+}
+
+// reset は初期データを含むすべてのアルバムと歌手を削除し、ゴミ箱も空にする
+func reset(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository) {
+	t.Helper()
+	ctx := context.Background()
+	all, err := albums.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range all {
+		if err := albums.Delete(ctx, a.ID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	allSingers, err := singers.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range allSingers {
+		if err := singers.Delete(ctx, s.ID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := albums.Purge(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := singers.Purge(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func addSinger(t *testing.T, repo repository.SingerRepository, name string) *model.Singer {
+	t.Helper()
+	singer := &model.Singer{Name: name}
+	if err := repo.Add(context.Background(), singer); err != nil {
+		t.Fatalf("Add singer %q: %v", name, err)
+	}
+	return singer
+}
+
+func addAlbum(t *testing.T, repo repository.AlbumRepository, title string, singerID model.SingerID) *model.Album {
+	t.Helper()
+	album := &model.Album{Title: title, SingerID: singerID}
+	if err := repo.Add(context.Background(), album); err != nil {
+		t.Fatalf("Add album %q: %v", title, err)
+	}
+	return album
+}
+
+func wantErr(t *testing.T, what string, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("%s: got error %v, want %v", what, err, target)
+	}
+}
+
+func testSingerCRUD(t *testing.T, singers repository.SingerRepository, _ repository.AlbumRepository) {
+	ctx := context.Background()
+
+	alice := addSinger(t, singers, "Alice")
+	if alice.ID == 0 || alice.Version != 1 {
+		t.Fatalf("Add: got id=%d version=%d, want assigned id and version 1", alice.ID, alice.Version)
+	}
+
+	explicit := &model.Singer{ID: alice.ID + 100, Name: "Bella"}
+	if err := singers.Add(ctx, explicit); err != nil {
+		t.Fatalf("Add with explicit id: %v", err)
+	}
+	wantErr(t, "Add duplicate id", singers.Add(ctx, &model.Singer{ID: explicit.ID, Name: "Dup"}), apperror.ErrAlreadyExists)
+	if chris := addSinger(t, singers, "Chris"); chris.ID <= explicit.ID {
+		t.Fatalf("Add after explicit id %d assigned id=%d, want a larger id", explicit.ID, chris.ID)
+	}
+
+	got, err := singers.Get(ctx, alice.ID)
+	if err != nil || got.ID != alice.ID || got.Name != "Alice" || got.Version != 1 {
+		t.Fatalf("Get: got %+v, %v", got, err)
+	}
+
+	byIDs, err := singers.GetByIDs(ctx, []model.SingerID{alice.ID, explicit.ID, explicit.ID + 1000})
+	if err != nil || len(byIDs) != 2 || byIDs[explicit.ID].Name != "Bella" {
+		t.Fatalf("GetByIDs: got %v, %v", byIDs, err)
+	}
+	if byIDs, err := singers.GetByIDs(ctx, nil); err != nil || len(byIDs) != 0 {
+		t.Fatalf("GetByIDs with no ids: got %v, %v", byIDs, err)
+	}
+	locked, err := singers.LockByIDs(ctx, []model.SingerID{alice.ID, explicit.ID, explicit.ID + 1000})
+	if err != nil || len(locked) != 2 || locked[explicit.ID].Name != "Bella" {
+		t.Fatalf("LockByIDs: got %v, %v", locked, err)
+	}
+
+	if err := singers.Update(ctx, &model.Singer{ID: alice.ID, Name: "Alicia"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, err := singers.Get(ctx, alice.ID); err != nil || got.Name != "Alicia" || got.Version != 2 {
+		t.Fatalf("Get after Update: got %+v, %v", got, err)
+	}
+
+	if err := singers.Delete(ctx, alice.ID, 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	wantErr(t, "Get after Delete", getSingerErr(singers, alice.ID), apperror.ErrNotFound)
+}
+
+func getSingerErr(repo repository.SingerRepository, id model.SingerID) error {
+	_, err := repo.Get(context.Background(), id)
+	return err
+}
+
+func testSingerNotFound(t *testing.T, singers repository.SingerRepository, _ repository.AlbumRepository) {
+	ctx := context.Background()
+	wantErr(t, "Get missing", getSingerErr(singers, 12345), apperror.ErrNotFound)
+	wantErr(t, "Update missing", singers.Update(ctx, &model.Singer{ID: 12345, Name: "Nobody"}), apperror.ErrNotFound)
+	wantErr(t, "Delete missing", singers.Delete(ctx, 12345, 0), apperror.ErrNotFound)
+}
+
+func testSingerVersion(t *testing.T, singers repository.SingerRepository, _ repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+
+	wantErr(t, "Update with stale version", singers.Update(ctx, &model.Singer{ID: alice.ID, Name: "X", Version: 2}), apperror.ErrPrecondition)
+	updated := &model.Singer{ID: alice.ID, Name: "Alicia", Version: 1}
+	if err := singers.Update(ctx, updated); err != nil {
+		t.Fatalf("Update with current version: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Fatalf("Update set version=%d, want 2", updated.Version)
+	}
+	if got, _ := singers.Get(ctx, alice.ID); got == nil || got.Name != "Alicia" {
+		t.Fatalf("failed Update must not change data: got %+v", got)
+	}
+
+	wantErr(t, "Delete with stale version", singers.Delete(ctx, alice.ID, 1), apperror.ErrPrecondition)
+	if err := getSingerErr(singers, alice.ID); err != nil {
+		t.Fatalf("failed Delete must not remove data: %v", err)
+	}
+	if err := singers.Delete(ctx, alice.ID, 2); err != nil {
+		t.Fatalf("Delete with current version: %v", err)
+	}
+}
+
+func testSingerIDsAreNotReused(t *testing.T, singers repository.SingerRepository, _ repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+	if err := singers.Delete(ctx, alice.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if bella := addSinger(t, singers, "Bella"); bella.ID <= alice.ID {
+		t.Fatalf("Add after Delete assigned id=%d, want larger than deleted id %d", bella.ID, alice.ID)
+	}
+}
+
+func testSingerOrdering(t *testing.T, singers repository.SingerRepository, _ repository.AlbumRepository) {
+	ctx := context.Background()
+	// 名前は一意なので、並び替えの値が同じ歌手は読みを同じにして作る
+	for _, singer := range []*model.Singer{{Name: "Daisy"}, {Name: "alice"}, {Name: "美香", NameKana: "みか"}, {Name: "Bella"}, {Name: "Alan"}, {Name: "ミカ"}} {
+		if err := singers.Add(ctx, singer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := singers.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].ID >= all[i].ID {
+			t.Fatalf("GetAll must be in ascending id order: got %v", singerNames(all))
+		}
+	}
+
+	// 名前は正規化した値（大文字・小文字、ひらがな・カタカナを区別しない）で比較し、同じ値どうしは ID で並べる
+	page, err := singers.List(ctx, repository.SingerQuery{Sort: repository.Sort{Field: repository.SortFieldName}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "sort=name", singerNames(page.Items), "Alan", "alice", "Bella", "Daisy", "美香", "ミカ")
+
+	page, err = singers.List(ctx, repository.SingerQuery{Sort: repository.Sort{Field: repository.SortFieldName, Desc: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "sort=-name", singerNames(page.Items), "ミカ", "美香", "Daisy", "Bella", "alice", "Alan")
+
+	page, err = singers.List(ctx, repository.SingerQuery{NamePrefix: "AL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "name_prefix=AL", singerNames(page.Items), "alice", "Alan")
+}
+
+func testSingerReadings(t *testing.T, singers repository.SingerRepository, _ repository.AlbumRepository) {
+	ctx := context.Background()
+	added := []*model.Singer{
+		{Name: "宇多田ヒカル", NameKana: "うただひかる", NameRomaji: "Utada Hikaru"},
+		{Name: "安室奈美恵", NameKana: "アムロナミエ", NameRomaji: "Amuro Namie"},
+		{Name: "ｶﾅ", NameKana: "ｶﾅ"},
+		{Name: "Ａｉｋｏ"},
+	}
+	for _, s := range added {
+		if err := singers.Add(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := singers.Get(ctx, added[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.NameKana != "うただひかる" || got.NameRomaji != "Utada Hikaru" {
+		t.Fatalf("Get must return the reading and romaji as stored: got %+v", got)
+	}
+
+	// 読みがある場合は読みで、ない場合は名前で並べる（ひらがな・カタカナ、全角・半角の違いは無視する）
+	page, err := singers.List(ctx, repository.SingerQuery{Sort: repository.Sort{Field: repository.SortFieldName}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "sort=name", singerNames(page.Items), "Ａｉｋｏ", "安室奈美恵", "宇多田ヒカル", "ｶﾅ")
+
+	// 名前・読み・ローマ字表記のいずれかの前方一致で絞り込む
+	for _, tc := range []struct {
+		prefix string
+		want   []string
+	}{
+		{"ウタダ", []string{"宇多田ヒカル"}},
+		{"あむろ", []string{"安室奈美恵"}},
+		{"utada", []string{"宇多田ヒカル"}},
+		{"かな", []string{"ｶﾅ"}},
+		{"AI", []string{"Ａｉｋｏ"}},
+		{"宇多田", []string{"宇多田ヒカル"}},
+	} {
+		page, err := singers.List(ctx, repository.SingerQuery{NamePrefix: tc.prefix})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantNames(t, "name_prefix="+tc.prefix, singerNames(page.Items), tc.want...)
+	}
+
+	// 正規化した名前が一致する歌手だけを取得する
+	page, err = singers.List(ctx, repository.SingerQuery{NameEquals: "aiko"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "name_equals=aiko", singerNames(page.Items), "Ａｉｋｏ")
+	page, err = singers.List(ctx, repository.SingerQuery{NameEquals: "カナ"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "name_equals=カナ", singerNames(page.Items), "ｶﾅ")
+}
+
+func testSingerPagination(t *testing.T, singers repository.SingerRepository, _ repository.AlbumRepository) {
+	ctx := context.Background()
+	// 並び替えの値が同じ歌手がページをまたぐように、読みが同じ歌手を混ぜる
+	for _, singer := range []*model.Singer{{Name: "Ellen"}, {Name: "美香", NameKana: "みか"}, {Name: "Alice"}, {Name: "実加", NameKana: "ミカ"}, {Name: "Bella"}, {Name: "Daisy"}, {Name: "ミカ"}} {
+		if err := singers.Add(ctx, singer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, order := range []repository.Sort{
+		{},
+		{Desc: true},
+		{Field: repository.SortFieldName},
+		{Field: repository.SortFieldName, Desc: true},
+	} {
+		whole, err := singers.List(ctx, repository.SingerQuery{Sort: order})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if whole.NextCursor != "" {
+			t.Fatalf("sort=%s: List without limit must return everything", order)
+		}
+
+		// 1 件ずつたどった結果は、まとめて取得した結果と同じ並びになる
+		var paged []*model.Singer
+		req := repository.PageRequest{Limit: 2}
+		for {
+			page, err := singers.List(ctx, repository.SingerQuery{Sort: order, Page: req})
+			if err != nil {
+				t.Fatalf("sort=%s: %v", order, err)
+			}
+			if len(page.Items) > req.Limit {
+				t.Fatalf("sort=%s: page has %d items, limit %d", order, len(page.Items), req.Limit)
+			}
+			paged = append(paged, page.Items...)
+			if page.NextCursor == "" {
+				break
+			}
+			req.Cursor = page.NextCursor
+		}
+		if fmt.Sprint(singerIDs(paged)) != fmt.Sprint(singerIDs(whole.Items)) {
+			t.Fatalf("sort=%s: paged ids %v, want %v", order, singerIDs(paged), singerIDs(whole.Items))
+		}
+
+		other := repository.Sort{Field: repository.SortFieldName, Desc: !order.Desc}
+		if order.Field == repository.SortFieldName {
+			other = repository.Sort{}
+		}
+		first, err := singers.List(ctx, repository.SingerQuery{Sort: order, Page: repository.PageRequest{Limit: 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = singers.List(ctx, repository.SingerQuery{Sort: other, Page: repository.PageRequest{Limit: 1, Cursor: first.NextCursor}})
+		wantErr(t, fmt.Sprintf("cursor from sort=%s used with sort=%s", order, other), err, apperror.ErrInvalidArgument)
+	}
+
+	_, err := singers.List(ctx, repository.SingerQuery{Page: repository.PageRequest{Limit: 1, Cursor: "not a cursor"}})
+	wantErr(t, "malformed cursor", err, apperror.ErrInvalidArgument)
+}
+
+func testSingerConcurrentAdd(t *testing.T, singers repository.SingerRepository, _ repository.AlbumRepository) {
+	ctx := context.Background()
+	const n = 20
+
+	var wg sync.WaitGroup
+	added := make([]*model.Singer, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			added[i] = &model.Singer{Name: fmt.Sprintf("Singer %02d", i)}
+			errs[i] = singers.Add(ctx, added[i])
+		}(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			singers.GetAll(ctx) // 書き込みと同時に読み取っても壊れない
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[model.SingerID]bool)
+	for i, s := range added {
+		if errs[i] != nil {
+			t.Fatalf("concurrent Add: %v", errs[i])
+		}
+		if seen[s.ID] {
+			t.Fatalf("concurrent Add assigned id %d twice", s.ID)
+		}
+		seen[s.ID] = true
+	}
+	if all, err := singers.GetAll(ctx); err != nil || len(all) != n {
+		t.Fatalf("GetAll after concurrent Add: got %d singers, %v", len(all), err)
+	}
+}
+
+func testSingerConcurrentUpdate(t *testing.T, singers repository.SingerRepository, _ repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+	const n = 10
+
+	// 同じバージョンを指定した更新は 1 つだけが成功し、残りは ErrPrecondition になる
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = singers.Update(ctx, &model.Singer{ID: alice.ID, Name: fmt.Sprintf("Alice %d", i), Version: 1})
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, apperror.ErrPrecondition):
+			t.Fatalf("concurrent Update: unexpected error %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("concurrent Update with the same version: %d succeeded, want 1", succeeded)
+	}
+	if got, err := singers.Get(ctx, alice.ID); err != nil || got.Version != 2 {
+		t.Fatalf("Get after concurrent Update: got %+v, %v", got, err)
+	}
+}
+
+func testAlbumCRUD(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+
+	first := addAlbum(t, albums, "First", alice.ID)
+	if first.ID == 0 || first.Version != 1 {
+		t.Fatalf("Add: got id=%d version=%d, want assigned id and version 1", first.ID, first.Version)
+	}
+	explicit := &model.Album{ID: first.ID + 100, Title: "Second", SingerID: alice.ID}
+	if err := albums.Add(ctx, explicit); err != nil {
+		t.Fatalf("Add with explicit id: %v", err)
+	}
+	wantErr(t, "Add duplicate id", albums.Add(ctx, &model.Album{ID: explicit.ID, Title: "Dup", SingerID: alice.ID}), apperror.ErrAlreadyExists)
+	if third := addAlbum(t, albums, "Third", alice.ID); third.ID <= explicit.ID {
+		t.Fatalf("Add after explicit id %d assigned id=%d, want a larger id", explicit.ID, third.ID)
+	}
+
+	got, err := albums.Get(ctx, first.ID)
+	if err != nil || got.Title != "First" || got.SingerID != alice.ID || got.Version != 1 {
+		t.Fatalf("Get: got %+v, %v", got, err)
+	}
+
+	if err := albums.Update(ctx, &model.Album{ID: first.ID, Title: "First (Remastered)", SingerID: alice.ID}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, err := albums.Get(ctx, first.ID); err != nil || got.Title != "First (Remastered)" || got.Version != 2 {
+		t.Fatalf("Get after Update: got %+v, %v", got, err)
+	}
+
+	// 発売日とジャンルも保存され、省略した場合は空のまま返る
+	if err := albums.Update(ctx, &model.Album{ID: first.ID, Title: "First (Remastered)", SingerID: alice.ID, ReleaseDate: "2001-02-03", Genres: []string{"Rock", "J-Pop"}}); err != nil {
+		t.Fatalf("Update with release date and genres: %v", err)
+	}
+	if got, err := albums.Get(ctx, first.ID); err != nil || got.ReleaseDate != "2001-02-03" || fmt.Sprint(got.Genres) != "[Rock J-Pop]" {
+		t.Fatalf("Get after Update with release date and genres: got %+v, %v", got, err)
+	}
+	if got, err := albums.Get(ctx, explicit.ID); err != nil || got.ReleaseDate != "" || len(got.Genres) != 0 {
+		t.Fatalf("Get album without release date and genres: got %+v, %v", got, err)
+	}
+
+	if err := albums.Delete(ctx, first.ID, 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err = albums.Get(ctx, first.ID)
+	wantErr(t, "Get after Delete", err, apperror.ErrNotFound)
+}
+
+func testAlbumNotFound(t *testing.T, _ repository.SingerRepository, albums repository.AlbumRepository) {
+	ctx := context.Background()
+	_, err := albums.Get(ctx, 12345)
+	wantErr(t, "Get missing", err, apperror.ErrNotFound)
+	wantErr(t, "Update missing", albums.Update(ctx, &model.Album{ID: 12345, Title: "Nothing"}), apperror.ErrNotFound)
+	wantErr(t, "Delete missing", albums.Delete(ctx, 12345, 0), apperror.ErrNotFound)
+}
+
+func testAlbumVersion(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+	album := addAlbum(t, albums, "First", alice.ID)
+
+	wantErr(t, "Update with stale version", albums.Update(ctx, &model.Album{ID: album.ID, Title: "X", SingerID: alice.ID, Version: 2}), apperror.ErrPrecondition)
+	if err := albums.Update(ctx, &model.Album{ID: album.ID, Title: "Y", SingerID: alice.ID, Version: 1}); err != nil {
+		t.Fatalf("Update with current version: %v", err)
+	}
+	wantErr(t, "Delete with stale version", albums.Delete(ctx, album.ID, 1), apperror.ErrPrecondition)
+	if err := albums.Delete(ctx, album.ID, 2); err != nil {
+		t.Fatalf("Delete with current version: %v", err)
+	}
+}
+
+func testAlbumListBySinger(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+	bella := addSinger(t, singers, "Bella")
+	a1 := addAlbum(t, albums, "A1", alice.ID)
+	b1 := addAlbum(t, albums, "B1", bella.ID)
+	a2 := addAlbum(t, albums, "A2", alice.ID)
+
+	got, err := albums.ListBySinger(ctx, alice.ID)
+	if err != nil || fmt.Sprint(albumIDs(got)) != fmt.Sprint([]model.AlbumID{a1.ID, a2.ID}) {
+		t.Fatalf("ListBySinger: got %v, %v", albumIDs(got), err)
+	}
+
+	// 歌手を付け替えると、どちらの歌手の一覧にも反映される
+	if err := albums.Update(ctx, &model.Album{ID: a2.ID, Title: "A2", SingerID: bella.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := albums.ListBySinger(ctx, alice.ID); fmt.Sprint(albumIDs(got)) != fmt.Sprint([]model.AlbumID{a1.ID}) {
+		t.Fatalf("ListBySinger(old singer) after Update: got %v", albumIDs(got))
+	}
+	if got, _ := albums.ListBySinger(ctx, bella.ID); fmt.Sprint(albumIDs(got)) != fmt.Sprint([]model.AlbumID{b1.ID, a2.ID}) {
+		t.Fatalf("ListBySinger(new singer) after Update: got %v", albumIDs(got))
+	}
+
+	if err := albums.Delete(ctx, b1.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := albums.ListBySinger(ctx, bella.ID); fmt.Sprint(albumIDs(got)) != fmt.Sprint([]model.AlbumID{a2.ID}) {
+		t.Fatalf("ListBySinger after Delete: got %v", albumIDs(got))
+	}
+	if got, err := albums.ListBySinger(ctx, 12345); err != nil || len(got) != 0 {
+		t.Fatalf("ListBySinger for singer without albums: got %v, %v", albumIDs(got), err)
+	}
+}
+
+func testAlbumCredits(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+	bella := addSinger(t, singers, "Bella")
+	carol := addSinger(t, singers, "Carol")
+	solo := addAlbum(t, albums, "Solo", alice.ID)
+
+	duet := &model.Album{Title: "Duet", SingerID: alice.ID, Credits: []model.Credit{
+		{SingerID: alice.ID, Role: model.CreditPrimary},
+		{SingerID: bella.ID, Role: model.CreditPrimary},
+		{SingerID: carol.ID, Role: model.CreditComposer},
+		{SingerID: alice.ID, Role: model.CreditComposer},
+	}}
+	if err := albums.Add(ctx, duet); err != nil {
+		t.Fatal(err)
+	}
+
+	// クレジットは登録した順に返す
+	got, err := albums.Get(ctx, duet.ID)
+	if err != nil || fmt.Sprint(got.Credits) != fmt.Sprint(duet.Credits) {
+		t.Fatalf("Get: got %+v, %v; want credits %+v", got, err, duet.Credits)
+	}
+	if got, _ := albums.Get(ctx, solo.ID); len(got.Credits) != 0 {
+		t.Fatalf("Get(album without credits): got credits %+v", got.Credits)
+	}
+
+	// クレジットされた歌手のどちらの一覧にも含まれる
+	for _, tc := range []struct {
+		singer model.SingerID
+		want   []model.AlbumID
+	}{
+		{alice.ID, []model.AlbumID{solo.ID, duet.ID}},
+		{bella.ID, []model.AlbumID{duet.ID}},
+		{carol.ID, []model.AlbumID{duet.ID}},
+	} {
+		if got, err := albums.ListBySinger(ctx, tc.singer); err != nil || fmt.Sprint(albumIDs(got)) != fmt.Sprint(tc.want) {
+			t.Fatalf("ListBySinger(%d): got %v, %v; want %v", tc.singer, albumIDs(got), err, tc.want)
+		}
+		page, err := albums.List(ctx, repository.AlbumQuery{SingerID: tc.singer})
+		if err != nil || fmt.Sprint(albumIDs(page.Items)) != fmt.Sprint(tc.want) {
+			t.Fatalf("List(SingerID=%d): got %v, %v; want %v", tc.singer, albumIDs(page.Items), err, tc.want)
+		}
+	}
+
+	// クレジットを置き換えると、外された歌手の一覧からは消える
+	duet.Credits = []model.Credit{{SingerID: alice.ID, Role: model.CreditPrimary}, {SingerID: carol.ID, Role: model.CreditFeatured}}
+	if err := albums.Update(ctx, duet); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := albums.ListBySinger(ctx, bella.ID); len(got) != 0 {
+		t.Fatalf("ListBySinger(removed credit) after Update: got %v", albumIDs(got))
+	}
+	if got, _ := albums.Get(ctx, duet.ID); fmt.Sprint(got.Credits) != fmt.Sprint(duet.Credits) {
+		t.Fatalf("Get after Update: got credits %+v, want %+v", got.Credits, duet.Credits)
+	}
+
+	// ゴミ箱に移動したアルバムは一覧に含めないが、元に戻すとクレジットも戻る
+	if err := albums.Delete(ctx, duet.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := albums.ListBySinger(ctx, carol.ID); len(got) != 0 {
+		t.Fatalf("ListBySinger after Delete: got %v", albumIDs(got))
+	}
+	page, err := albums.List(ctx, repository.AlbumQuery{SingerID: carol.ID, IncludeDeleted: true})
+	if err != nil || fmt.Sprint(albumIDs(page.Items)) != fmt.Sprint([]model.AlbumID{duet.ID}) {
+		t.Fatalf("List(SingerID, IncludeDeleted): got %v, %v", albumIDs(page.Items), err)
+	}
+	restored, err := albums.Restore(ctx, duet.ID)
+	if err != nil || fmt.Sprint(restored.Credits) != fmt.Sprint(duet.Credits) {
+		t.Fatalf("Restore: got %+v, %v", restored, err)
+	}
+	if got, _ := albums.ListBySinger(ctx, carol.ID); fmt.Sprint(albumIDs(got)) != fmt.Sprint([]model.AlbumID{duet.ID}) {
+		t.Fatalf("ListBySinger after Restore: got %v", albumIDs(got))
+	}
+
+	// 歌手を完全に削除する前に UnlinkSinger でアルバムから外すと、ゴミ箱のアルバムのクレジットからも消える
+	if err := albums.Delete(ctx, duet.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := albums.UnlinkSinger(ctx, carol.ID); err != nil || n != 1 {
+		t.Fatalf("UnlinkSinger(credited singer): got %d, %v", n, err)
+	}
+	restored, err = albums.Restore(ctx, duet.ID)
+	want := []model.Credit{{SingerID: alice.ID, Role: model.CreditPrimary}}
+	if err != nil || fmt.Sprint(restored.Credits) != fmt.Sprint(want) {
+		t.Fatalf("Restore after UnlinkSinger: got %+v, %v; want credits %+v", restored, err, want)
+	}
+	if got, _ := albums.ListBySinger(ctx, carol.ID); len(got) != 0 {
+		t.Fatalf("ListBySinger(unlinked singer): got %v", albumIDs(got))
+	}
+	page, err = albums.List(ctx, repository.AlbumQuery{SingerID: carol.ID, IncludeDeleted: true})
+	if err != nil || len(page.Items) != 0 {
+		t.Fatalf("List(SingerID=unlinked singer, IncludeDeleted): got %v, %v", albumIDs(page.Items), err)
+	}
+
+	// SingerID の歌手を外すと、SingerID は 0 になりクレジットも空になる
+	if n, err := albums.UnlinkSinger(ctx, alice.ID); err != nil || n != 2 {
+		t.Fatalf("UnlinkSinger(primary singer): got %d, %v", n, err)
+	}
+	if got, err := albums.Get(ctx, duet.ID); err != nil || got.SingerID != 0 || len(got.Credits) != 0 || got.Version != restored.Version+1 {
+		t.Fatalf("Get after UnlinkSinger: got %+v, %v", got, err)
+	}
+	if got, _ := albums.ListBySinger(ctx, alice.ID); len(got) != 0 {
+		t.Fatalf("ListBySinger(unlinked primary singer): got %v", albumIDs(got))
+	}
+}
+
+func testAlbumOrdering(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+	bella := addSinger(t, singers, "Bella")
+	addAlbum(t, albums, "Winter Songs", alice.ID)
+	addAlbum(t, albums, "autumn", bella.ID)
+	addAlbum(t, albums, "Summer Songs", bella.ID)
+	addAlbum(t, albums, "Spring", alice.ID)
+
+	page, err := albums.List(ctx, repository.AlbumQuery{Sort: repository.Sort{Field: repository.SortFieldTitle}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "sort=title", albumTitles(page.Items), "autumn", "Spring", "Summer Songs", "Winter Songs")
+
+	page, err = albums.List(ctx, repository.AlbumQuery{TitleContains: "SONG", Sort: repository.Sort{Desc: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "title_contains=SONG sort=-id", albumTitles(page.Items), "Summer Songs", "Winter Songs")
+
+	page, err = albums.List(ctx, repository.AlbumQuery{SingerID: bella.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "singer_id", albumTitles(page.Items), "autumn", "Summer Songs")
+
+	var paged []string
+	req := repository.PageRequest{Limit: 3}
+	order := repository.Sort{Field: repository.SortFieldTitle, Desc: true}
+	for {
+		page, err := albums.List(ctx, repository.AlbumQuery{Sort: order, Page: req})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, albumTitles(page.Items)...)
+		if page.NextCursor == "" {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+	wantNames(t, "paged sort=-title", paged, "Winter Songs", "Summer Songs", "Spring", "autumn")
+}
+
+func testAlbumConcurrentReadWrite(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+	bella := addSinger(t, singers, "Bella")
+	const n = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*n)
+	for i := 0; i < n; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			album := &model.Album{Title: fmt.Sprintf("Album %02d", i), SingerID: alice.ID}
+			if err := albums.Add(ctx, album); err != nil {
+				errs <- err
+				return
+			}
+			// 追加したアルバムを別の歌手に付け替える
+			if err := albums.Update(ctx, &model.Album{ID: album.ID, Title: album.Title, SingerID: bella.ID}); err != nil {
+				errs <- err
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := albums.ListBySinger(ctx, alice.ID); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := albums.List(ctx, repository.AlbumQuery{Sort: repository.Sort{Field: repository.SortFieldTitle}}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("concurrent access: %v", err)
+	}
+
+	if got, err := albums.ListBySinger(ctx, bella.ID); err != nil || len(got) != n {
+		t.Fatalf("ListBySinger after concurrent updates: got %d albums, %v", len(got), err)
+	}
+	if got, err := albums.ListBySinger(ctx, alice.ID); err != nil || len(got) != 0 {
+		t.Fatalf("ListBySinger(old singer) after concurrent updates: got %d albums, %v", len(got), err)
+	}
+}
+
+func singerNames(singers []*model.Singer) []string {
+	names := make([]string, len(singers))
+	for i, s := range singers {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func singerIDs(singers []*model.Singer) []model.SingerID {
+	ids := make([]model.SingerID, len(singers))
+	for i, s := range singers {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+func albumTitles(albums []*model.Album) []string {
+	titles := make([]string, len(albums))
+	for i, a := range albums {
+		titles[i] = a.Title
+	}
+	return titles
+}
+
+func albumIDs(albums []*model.Album) []model.AlbumID {
+	ids := make([]model.AlbumID, len(albums))
+	for i, a := range albums {
+		ids[i] = a.ID
+	}
+	return ids
+}
+
+func wantNames(t *testing.T, what string, got []string, want ...string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("%s: got %q, want %q", what, got, want)
+	}
+}
+
+func testSingerTrash(t *testing.T, singers repository.SingerRepository, _ repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+	bella := addSinger(t, singers, "Bella")
+
+	before := time.Now()
+	if err := singers.Delete(ctx, alice.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	wantErr(t, "Get trashed", getSingerErr(singers, alice.ID), apperror.ErrNotFound)
+	wantErr(t, "Delete trashed", singers.Delete(ctx, alice.ID, 0), apperror.ErrNotFound)
+	wantErr(t, "Update trashed", singers.Update(ctx, &model.Singer{ID: alice.ID, Name: "X"}), apperror.ErrNotFound)
+	wantErr(t, "Add with trashed id", singers.Add(ctx, &model.Singer{ID: alice.ID, Name: "X"}), apperror.ErrAlreadyExists)
+	wantErr(t, "Restore live", restoreSingerErr(singers, bella.ID), apperror.ErrNotFound)
+	if all, _ := singers.GetAll(ctx); len(all) != 1 {
+		t.Fatalf("GetAll must not include trashed singers: got %v", singerNames(all))
+	}
+	if byIDs, _ := singers.GetByIDs(ctx, []model.SingerID{alice.ID, bella.ID}); len(byIDs) != 1 {
+		t.Fatalf("GetByIDs must not include trashed singers: got %v", byIDs)
+	}
+	if locked, _ := singers.LockByIDs(ctx, []model.SingerID{alice.ID, bella.ID}); len(locked) != 1 {
+		t.Fatalf("LockByIDs must not include trashed singers: got %v", locked)
+	}
+
+	page, err := singers.List(ctx, repository.SingerQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "List", singerNames(page.Items), "Bella")
+	page, err = singers.List(ctx, repository.SingerQuery{IncludeDeleted: true, Sort: repository.Sort{Field: repository.SortFieldName}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "List include_deleted", singerNames(page.Items), "Alice", "Bella")
+	if trashed := page.Items[0]; trashed.DeletedAt == nil || trashed.DeletedAt.Before(before.Add(-time.Second)) || trashed.Version != 2 {
+		t.Fatalf("trashed singer must have deleted_at and a new version: got %+v", trashed)
+	}
+
+	restored, err := singers.Restore(ctx, alice.ID)
+	if err != nil || restored.Name != "Alice" || restored.DeletedAt != nil || restored.Version != 3 {
+		t.Fatalf("Restore: got %+v, %v", restored, err)
+	}
+	if got, err := singers.Get(ctx, alice.ID); err != nil || got.Version != 3 {
+		t.Fatalf("Get after Restore: got %+v, %v", got, err)
+	}
+	wantErr(t, "Restore twice", restoreSingerErr(singers, alice.ID), apperror.ErrNotFound)
+
+	// Purge は基準の日時より前にゴミ箱に移動したものだけを完全に削除する
+	if err := singers.Delete(ctx, alice.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := singers.Purge(ctx, before.Add(-time.Hour)); err != nil || n != 0 {
+		t.Fatalf("Purge before deletion: got %d, %v", n, err)
+	}
+	if n, err := singers.Purge(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("Purge: got %d, %v", n, err)
+	}
+	wantErr(t, "Restore purged", restoreSingerErr(singers, alice.ID), apperror.ErrNotFound)
+	page, err = singers.List(ctx, repository.SingerQuery{IncludeDeleted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "List include_deleted after Purge", singerNames(page.Items), "Bella")
+	if carl := addSinger(t, singers, "Carl"); carl.ID <= bella.ID {
+		t.Fatalf("Add after Purge assigned id=%d, want a new id", carl.ID)
+	}
+}
+
+func testSingerPurgeWithAlbums(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+	bella := addSinger(t, singers, "Bella")
+	live := addAlbum(t, albums, "Live", alice.ID)
+	trashed := addAlbum(t, albums, "Trashed", alice.ID)
+	kept := addAlbum(t, albums, "Kept", bella.ID)
+	if err := albums.Delete(ctx, trashed.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := singers.Delete(ctx, alice.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// アルバムが残っている歌手は、アルバムから外してから完全に削除する（TrashPurger と同じ順番）
+	if n, err := albums.UnlinkSinger(ctx, alice.ID); err != nil || n != 2 {
+		t.Fatalf("UnlinkSinger: got %d, %v", n, err)
+	}
+	if n, err := singers.Purge(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("Purge: got %d, %v", n, err)
+	}
+
+	if got, err := albums.Get(ctx, live.ID); err != nil || got.SingerID != 0 || got.Version != 2 {
+		t.Fatalf("Get after Purge: got %+v, %v; want singer_id 0 and a new version", got, err)
+	}
+	page, err := albums.List(ctx, repository.AlbumQuery{IncludeDeleted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, album := range page.Items {
+		if album.ID == trashed.ID && (album.SingerID != 0 || album.Version != 3) {
+			t.Fatalf("trashed album after Purge: got %+v, want singer_id 0 and a new version", album)
+		}
+	}
+	if got, _ := albums.ListBySinger(ctx, alice.ID); len(got) != 0 {
+		t.Fatalf("ListBySinger(purged singer): got %v", albumIDs(got))
+	}
+	if got, err := albums.Get(ctx, kept.ID); err != nil || got.SingerID != bella.ID || got.Version != 1 {
+		t.Fatalf("UnlinkSinger must not change albums of other singers: got %+v, %v", got, err)
+	}
+	if n, err := albums.UnlinkSinger(ctx, alice.ID); err != nil || n != 0 {
+		t.Fatalf("UnlinkSinger again: got %d, %v", n, err)
+	}
+}
+
+func restoreSingerErr(repo repository.SingerRepository, id model.SingerID) error {
+	_, err := repo.Restore(context.Background(), id)
+	return err
+}
+
+func testAlbumTrash(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository) {
+	ctx := context.Background()
+	alice := addSinger(t, singers, "Alice")
+	first := addAlbum(t, albums, "First", alice.ID)
+	addAlbum(t, albums, "Second", alice.ID)
+
+	if err := albums.Delete(ctx, first.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	_, err := albums.Get(ctx, first.ID)
+	wantErr(t, "Get trashed", err, apperror.ErrNotFound)
+	wantErr(t, "Delete trashed", albums.Delete(ctx, first.ID, 0), apperror.ErrNotFound)
+	wantErr(t, "Update trashed", albums.Update(ctx, &model.Album{ID: first.ID, Title: "X", SingerID: alice.ID}), apperror.ErrNotFound)
+	if got, _ := albums.ListBySinger(ctx, alice.ID); len(got) != 1 || got[0].Title != "Second" {
+		t.Fatalf("ListBySinger must not include trashed albums: got %+v", got)
+	}
+
+	page, err := albums.List(ctx, repository.AlbumQuery{SingerID: alice.ID, IncludeDeleted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 || page.Items[0].ID != first.ID || page.Items[0].DeletedAt == nil {
+		t.Fatalf("List include_deleted: got %+v", page.Items)
+	}
+
+	restored, err := albums.Restore(ctx, first.ID)
+	if err != nil || restored.Title != "First" || restored.SingerID != alice.ID || restored.DeletedAt != nil {
+		t.Fatalf("Restore: got %+v, %v", restored, err)
+	}
+	if got, _ := albums.ListBySinger(ctx, alice.ID); len(got) != 2 {
+		t.Fatalf("ListBySinger after Restore: got %+v", got)
+	}
+
+	if err := albums.Delete(ctx, first.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := albums.Purge(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("Purge: got %d, %v", n, err)
+	}
+	if _, err := albums.Restore(ctx, first.ID); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("Restore purged: got %v, want %v", err, apperror.ErrNotFound)
+	}
+}
+
+func addTrack(t *testing.T, repo repository.TrackRepository, albumID model.AlbumID, number int, title string) *model.Track {
+	t.Helper()
+	track := &model.Track{AlbumID: albumID, Number: number, Title: title, Duration: 180}
+	if err := repo.Add(context.Background(), track); err != nil {
+		t.Fatalf("Add track %q: %v", title, err)
+	}
+	return track
+}
+
+func trackTitles(tracks []*model.Track) []string {
+	titles := make([]string, len(tracks))
+	for i, track := range tracks {
+		titles[i] = track.Title
+	}
+	return titles
+}
+
+func testTrackCRUD(t *testing.T, _ repository.AlbumRepository, tracks repository.TrackRepository, albumID model.AlbumID) {
+	ctx := context.Background()
+
+	intro := addTrack(t, tracks, albumID, 0, "Intro")
+	if intro.ID == 0 || intro.Number != 1 || intro.Version != 1 {
+		t.Fatalf("Add: got %+v, want assigned id, number 1 and version 1", intro)
+	}
+	explicit := &model.Track{ID: intro.ID + 100, AlbumID: albumID, Title: "Explicit", Duration: 200}
+	if err := tracks.Add(ctx, explicit); err != nil {
+		t.Fatalf("Add with explicit id: %v", err)
+	}
+	wantErr(t, "Add duplicate id", tracks.Add(ctx, &model.Track{ID: explicit.ID, AlbumID: albumID, Title: "Dup", Duration: 1}), apperror.ErrAlreadyExists)
+	if next := addTrack(t, tracks, albumID, 0, "Next"); next.ID <= explicit.ID {
+		t.Fatalf("Add after explicit id %d assigned id=%d, want a larger id", explicit.ID, next.ID)
+	}
+
+	got, err := tracks.Get(ctx, intro.ID)
+	if err != nil || got.AlbumID != albumID || got.Title != "Intro" || got.Duration != 180 || got.Version != 1 {
+		t.Fatalf("Get: got %+v, %v", got, err)
+	}
+
+	if err := tracks.Update(ctx, &model.Track{ID: intro.ID, AlbumID: albumID, Title: "Overture", Duration: 90}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, err := tracks.Get(ctx, intro.ID); err != nil || got.Title != "Overture" || got.Number != 1 || got.Duration != 90 || got.Version != 2 {
+		t.Fatalf("Get after Update (number 0 keeps the current number): got %+v, %v", got, err)
+	}
+
+	if err := tracks.Delete(ctx, intro.ID, 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err = tracks.Get(ctx, intro.ID)
+	wantErr(t, "Get after Delete", err, apperror.ErrNotFound)
+	wantErr(t, "Delete missing", tracks.Delete(ctx, intro.ID, 0), apperror.ErrNotFound)
+	wantErr(t, "Update missing", tracks.Update(ctx, &model.Track{ID: intro.ID, AlbumID: albumID, Title: "X", Duration: 1}), apperror.ErrNotFound)
+}
+
+func testTrackNumbers(t *testing.T, albums repository.AlbumRepository, tracks repository.TrackRepository, albumID model.AlbumID) {
+	ctx := context.Background()
+
+	addTrack(t, tracks, albumID, 3, "Third")
+	addTrack(t, tracks, albumID, 1, "First")
+	fourth := addTrack(t, tracks, albumID, 0, "Fourth")
+	if fourth.Number != 4 {
+		t.Fatalf("Add without number: got number %d, want 4 (after the last track)", fourth.Number)
+	}
+	wantErr(t, "Add with a taken number", tracks.Add(ctx, &model.Track{AlbumID: albumID, Number: 3, Title: "Dup", Duration: 1}), apperror.ErrConflict)
+	wantErr(t, "Update to a taken number", tracks.Update(ctx, &model.Track{ID: fourth.ID, AlbumID: albumID, Number: 1, Title: "Fourth", Duration: 1}), apperror.ErrConflict)
+
+	list, err := tracks.ListByAlbum(ctx, albumID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "ListByAlbum", trackTitles(list), "First", "Third", "Fourth")
+
+	// 曲順の重複はアルバムごとに確認する
+	first, err := albums.Get(ctx, albumID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := addAlbum(t, albums, "Other", first.SingerID)
+	if other := addTrack(t, tracks, other.ID, 1, "Other First"); other.Number != 1 {
+		t.Fatalf("Add to another album: got number %d, want 1", other.Number)
+	}
+	if list, _ := tracks.ListByAlbum(ctx, albumID); len(list) != 3 {
+		t.Fatalf("ListByAlbum must not include tracks of other albums: got %v", trackTitles(list))
+	}
+	if list, err := tracks.ListByAlbum(ctx, 12345); err != nil || len(list) != 0 {
+		t.Fatalf("ListByAlbum of an album without tracks: got %v, %v", list, err)
+	}
+}
+
+func testTrackVersion(t *testing.T, _ repository.AlbumRepository, tracks repository.TrackRepository, albumID model.AlbumID) {
+	ctx := context.Background()
+	track := addTrack(t, tracks, albumID, 0, "Intro")
+
+	wantErr(t, "Update with stale version", tracks.Update(ctx, &model.Track{ID: track.ID, AlbumID: albumID, Title: "X", Duration: 1, Version: 2}), apperror.ErrPrecondition)
+	updated := &model.Track{ID: track.ID, AlbumID: albumID, Title: "Overture", Duration: 1, Version: 1}
+	if err := tracks.Update(ctx, updated); err != nil {
+		t.Fatalf("Update with current version: %v", err)
+	}
+	if updated.Version != 2 || updated.Number != 1 {
+		t.Fatalf("Update set version=%d number=%d, want 2 and 1", updated.Version, updated.Number)
+	}
+	wantErr(t, "Delete with stale version", tracks.Delete(ctx, track.ID, 1), apperror.ErrPrecondition)
+	if err := tracks.Delete(ctx, track.ID, 2); err != nil {
+		t.Fatalf("Delete with current version: %v", err)
+	}
+}
+
+func testTrackDeleteByAlbum(t *testing.T, albums repository.AlbumRepository, tracks repository.TrackRepository, albumID model.AlbumID) {
+	ctx := context.Background()
+	addTrack(t, tracks, albumID, 0, "One")
+	addTrack(t, tracks, albumID, 0, "Two")
+	first, err := albums.Get(ctx, albumID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := addAlbum(t, albums, "Other", first.SingerID)
+	addTrack(t, tracks, other.ID, 0, "Kept")
+
+	if n, err := tracks.DeleteByAlbum(ctx, albumID); err != nil || n != 2 {
+		t.Fatalf("DeleteByAlbum: got %d, %v", n, err)
+	}
+	if list, _ := tracks.ListByAlbum(ctx, albumID); len(list) != 0 {
+		t.Fatalf("ListByAlbum after DeleteByAlbum: got %v", trackTitles(list))
+	}
+	if list, _ := tracks.ListByAlbum(ctx, other.ID); len(list) != 1 {
+		t.Fatalf("DeleteByAlbum must not delete tracks of other albums: got %v", trackTitles(list))
+	}
+	if n, err := tracks.DeleteByAlbum(ctx, albumID); err != nil || n != 0 {
+		t.Fatalf("DeleteByAlbum again: got %d, %v", n, err)
+	}
+}
+
+// searchHits は検索結果を "種類:ID" の形式で返す
+func searchHits(t *testing.T, search repository.SearchRepository, query repository.SearchQuery) []string {
+	t.Helper()
+	hits, err := search.Search(context.Background(), query)
+	if err != nil {
+		t.Fatalf("Search %q: %v", query.Text, err)
+	}
+	got := make([]string, 0, len(hits))
+	for _, h := range hits {
+		got = append(got, fmt.Sprintf("%s:%d", h.Type, h.ID))
+	}
+	return got
+}
+
+func hitKey(typ model.SearchType, id any) string {
+	return fmt.Sprintf("%s:%v", typ, id)
+}
+
+func testSearchRanking(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository, search repository.SearchRepository) {
+	alice := addSinger(t, singers, "Alice")
+	alicia := addSinger(t, singers, "Alicia Keys")
+	addSinger(t, singers, "Bob")
+	album := addAlbum(t, albums, "Songs for Alice", alice.ID)
+
+	got := searchHits(t, search, repository.SearchQuery{Text: "alice"})
+	wantNames(t, "Search alice", got, hitKey(model.SearchTypeSinger, alice.ID), hitKey(model.SearchTypeAlbum, album.ID))
+
+	got = searchHits(t, search, repository.SearchQuery{Text: "ali"})
+	wantNames(t, "Search ali (prefix)", got,
+		hitKey(model.SearchTypeSinger, alice.ID), hitKey(model.SearchTypeSinger, alicia.ID), hitKey(model.SearchTypeAlbum, album.ID))
+
+	got = searchHits(t, search, repository.SearchQuery{Text: "songs alice"})
+	wantNames(t, "Search songs alice (all terms)", got, hitKey(model.SearchTypeAlbum, album.ID))
+
+	hits, err := search.Search(context.Background(), repository.SearchQuery{Text: "ALICE", Types: []model.SearchType{model.SearchTypeAlbum}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Text != "Songs for Alice" || hits[0].Highlight != "Songs for <em>Alice</em>" {
+		t.Fatalf("Search ALICE: got %+v, want highlighted album title", hits)
+	}
+
+	if got := searchHits(t, search, repository.SearchQuery{Text: "zzz"}); len(got) != 0 {
+		t.Fatalf("Search zzz: got %v, want no hits", got)
+	}
+}
+
+func testSearchFolding(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository, search repository.SearchRepository) {
+	hikaru := addSinger(t, singers, "宇多田ヒカル")
+	band := addSinger(t, singers, "ＡＢＣ　Ｂａｎｄ")
+	album := addAlbum(t, albums, "ﾌｧｰｽﾄ・ﾗｳﾞ", hikaru.ID)
+
+	wantNames(t, "Search 宇多田", searchHits(t, search, repository.SearchQuery{Text: "宇多田"}), hitKey(model.SearchTypeSinger, hikaru.ID))
+	wantNames(t, "Search ヒカル", searchHits(t, search, repository.SearchQuery{Text: "ヒカル"}), hitKey(model.SearchTypeSinger, hikaru.ID))
+	wantNames(t, "Search abc (fullwidth)", searchHits(t, search, repository.SearchQuery{Text: "abc"}), hitKey(model.SearchTypeSinger, band.ID))
+	wantNames(t, "Search ラヴ (halfwidth)", searchHits(t, search, repository.SearchQuery{Text: "ラヴ"}), hitKey(model.SearchTypeAlbum, album.ID))
+}
+
+func testSearchFollowsWrites(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository, search repository.SearchRepository) {
+	ctx := context.Background()
+	singer := addSinger(t, singers, "Carol")
+	wantNames(t, "Search carol", searchHits(t, search, repository.SearchQuery{Text: "carol"}), hitKey(model.SearchTypeSinger, singer.ID))
+
+	singer.Name = "Dave"
+	if err := singers.Update(ctx, singer); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchHits(t, search, repository.SearchQuery{Text: "carol"}); len(got) != 0 {
+		t.Fatalf("Search carol after rename: got %v, want no hits", got)
+	}
+	wantNames(t, "Search dave", searchHits(t, search, repository.SearchQuery{Text: "dave"}), hitKey(model.SearchTypeSinger, singer.ID))
+
+	album := addAlbum(t, albums, "Dave Live", singer.ID)
+	if err := albums.Delete(ctx, album.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "Search dave after deleting album", searchHits(t, search, repository.SearchQuery{Text: "dave"}), hitKey(model.SearchTypeSinger, singer.ID))
+	if _, err := albums.Restore(ctx, album.ID); err != nil {
+		t.Fatal(err)
+	}
+	wantNames(t, "Search dave after restoring album", searchHits(t, search, repository.SearchQuery{Text: "dave"}),
+		hitKey(model.SearchTypeSinger, singer.ID), hitKey(model.SearchTypeAlbum, album.ID))
+}
+
+func testSearchTypesAndLimit(t *testing.T, singers repository.SingerRepository, albums repository.AlbumRepository, search repository.SearchRepository) {
+	first := addSinger(t, singers, "Echo")
+	second := addSinger(t, singers, "Echo Park")
+	album := addAlbum(t, albums, "Echo", first.ID)
+
+	wantNames(t, "Search echo", searchHits(t, search, repository.SearchQuery{Text: "echo"}),
+		hitKey(model.SearchTypeSinger, first.ID), hitKey(model.SearchTypeAlbum, album.ID), hitKey(model.SearchTypeSinger, second.ID))
+	wantNames(t, "Search echo type=singer", searchHits(t, search, repository.SearchQuery{Text: "echo", Types: []model.SearchType{model.SearchTypeSinger}}),
+		hitKey(model.SearchTypeSinger, first.ID), hitKey(model.SearchTypeSinger, second.ID))
+	wantNames(t, "Search echo limit=2", searchHits(t, search, repository.SearchQuery{Text: "echo", Limit: 2}),
+		hitKey(model.SearchTypeSinger, first.ID), hitKey(model.SearchTypeAlbum, album.ID))
+}
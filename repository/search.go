@@ -0,0 +1,22 @@
+// 歌手とアルバムをまとめて全文検索するためのリポジトリ（Repository）を定義するパッケージ
+
+package repository // このファイルが repository パッケージであることを示す
+
+import (
+	"context"
+
+	"server-recruit-challenge-sample/model"
+)
+
+// SearchQuery は全文検索の条件を表す
+type SearchQuery struct {
+	Text  string             // 検索語。空白で区切った語がすべて含まれるもの（英数字は語の前方一致）に一致する。大文字・小文字と全角・半角は区別しない
+	Types []model.SearchType // 検索する種類（空の場合はすべて）
+	Limit int                // 取得する最大の件数（0 の場合は無制限）
+}
+
+// SearchRepository インターフェース：歌手の名前とアルバムのタイトルを全文検索するメソッドを定義
+// ゴミ箱に入っている歌手とアルバムは検索しない
+type SearchRepository interface {
+	Search(ctx context.Context, query SearchQuery) ([]*model.SearchHit, error) // 一致の度合いが大きい順に取得（同じ場合は歌手、アルバムの順、その中では ID 順）
+}
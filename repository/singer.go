@@ -5,14 +5,21 @@ package repository // このファイルが repository パッケージである
 
 import (
 	"context"
+	"time"
 
 	"server-recruit-challenge-sample/model"
 )
 
 // SingerRepository インターフェース：歌手に関するデータの永続化と取得に必要な基本的なメソッドを定義
 type SingerRepository interface {
-	GetAll(ctx context.Context) ([]*model.Singer, error)               // すべての歌手を取得
-	Get(ctx context.Context, id model.SingerID) (*model.Singer, error) // 指定された歌手IDに対応する歌手を取得
-	Add(ctx context.Context, singer *model.Singer) error               // 新しい歌手を追加
-	Delete(ctx context.Context, id model.SingerID) error               // 指定された歌手IDに対応する歌手を削除
+	GetAll(ctx context.Context) ([]*model.Singer, error)                                           // すべての歌手をID順に取得
+	List(ctx context.Context, query SingerQuery) (*Page[*model.Singer], error)                     // 条件に合う歌手を指定された順にページ単位で取得
+	Get(ctx context.Context, id model.SingerID) (*model.Singer, error)                             // 指定された歌手IDに対応する歌手を取得
+	GetByIDs(ctx context.Context, ids []model.SingerID) (map[model.SingerID]*model.Singer, error)  // 指定された複数の歌手IDに対応する歌手をまとめて取得（存在しないIDは結果に含まれない）
+	LockByIDs(ctx context.Context, ids []model.SingerID) (map[model.SingerID]*model.Singer, error) // GetByIDs と同じだが、トランザクションの中ではコミットするまでほかのトランザクションが取得した歌手を変更・削除できないようにロックする
+	Add(ctx context.Context, singer *model.Singer) error                                           // 新しい歌手を追加（Version は 1 になる。ID が 0 の場合は採番して singer.ID に設定し、既存の ID と重複する場合は apperror.ErrAlreadyExists を返す）
+	Update(ctx context.Context, singer *model.Singer) error                                        // singer.ID に対応する歌手を置き換え、singer.Version を新しいバージョンにする（存在しない場合は apperror.ErrNotFound、singer.Version が 0 以外で現在のバージョンと異なる場合は apperror.ErrPrecondition を返す）
+	Delete(ctx context.Context, id model.SingerID, version model.Version) error                    // 指定された歌手IDに対応する歌手をゴミ箱に移動（DeletedAt を設定してバージョンを上げる。以降は Get や一覧から見えなくなる。存在しない場合は apperror.ErrNotFound、version が 0 以外で現在のバージョンと異なる場合は apperror.ErrPrecondition を返す）
+	Restore(ctx context.Context, id model.SingerID) (*model.Singer, error)                         // ゴミ箱の歌手を元に戻してバージョンを上げる（ゴミ箱にない場合は apperror.ErrNotFound を返す）
+	Purge(ctx context.Context, deletedBefore time.Time) (int, error)                               // deletedBefore より前にゴミ箱に移動した歌手を完全に削除し、削除した件数を返す
 }
@@ -0,0 +1,20 @@
+// 曲（Track）に関するデータの永続化と取得のためのリポジトリ（Repository）を定義するパッケージ
+
+package repository // このファイルが repository パッケージであることを示す
+
+import (
+	"context"
+
+	"server-recruit-challenge-sample/model"
+)
+
+// TrackRepository インターフェース：曲に関するデータの永続化と取得に必要な基本的なメソッドを定義
+// 曲はアルバムに属し、曲順（Number）は同じアルバムの中で重複しない
+type TrackRepository interface {
+	ListByAlbum(ctx context.Context, albumID model.AlbumID) ([]*model.Track, error) // 指定されたアルバムIDに紐づく曲を曲順に取得
+	Get(ctx context.Context, id model.TrackID) (*model.Track, error)                // 指定された曲IDに対応する曲を取得（存在しない場合は apperror.ErrNotFound を返す）
+	Add(ctx context.Context, track *model.Track) error                              // 新しい曲を追加（Version は 1 になる。ID が 0 の場合は採番し、Number が 0 の場合はアルバムの最後の曲順の次にする。既存の ID と重複する場合は apperror.ErrAlreadyExists、曲順が重複する場合は apperror.ErrConflict を返す）
+	Update(ctx context.Context, track *model.Track) error                           // track.ID に対応する曲を置き換え、track.Version を新しいバージョンにする（存在しない場合は apperror.ErrNotFound、曲順が重複する場合は apperror.ErrConflict、track.Version が 0 以外で現在のバージョンと異なる場合は apperror.ErrPrecondition を返す）
+	Delete(ctx context.Context, id model.TrackID, version model.Version) error      // 指定された曲IDに対応する曲を削除（存在しない場合は apperror.ErrNotFound、version が 0 以外で現在のバージョンと異なる場合は apperror.ErrPrecondition を返す）
+	DeleteByAlbum(ctx context.Context, albumID model.AlbumID) (int, error)          // 指定されたアルバムIDに紐づく曲をすべて削除し、削除した件数を返す（アルバムを完全に削除するときに使う）
+}
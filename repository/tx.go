@@ -0,0 +1,13 @@
+// 複数のリポジトリにまたがる操作をまとめて実行するためのトランザクション（Unit of Work）を定義するファイル
+
+package repository // このファイルが repository パッケージであることを示す
+
+import "context"
+
+// Transactor は複数のリポジトリにまたがる操作を 1 つのトランザクションとして実行する
+type Transactor interface {
+	// RunInTx は fn をトランザクションの中で実行する。fn に渡された ctx をリポジトリのメソッドに渡すと、その操作はトランザクションに含まれる
+	// fn がエラーを返した場合はトランザクションの中の変更をすべて取り消し、そのエラーを返す
+	// トランザクションの途中の状態はほかの読み取りからは見えない。ctx がすでにトランザクションの中の場合は、そのトランザクションに参加する
+	RunInTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
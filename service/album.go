@@ -5,6 +5,7 @@ package service // このファイルが service パッケージであること
 import (
 	"context"
 
+	"server-recruit-challenge-sample/apperror"
 	"server-recruit-challenge-sample/model"
 	"server-recruit-challenge-sample/repository"
 )
@@ -12,10 +13,15 @@ import (
 
 // AlbumService はアルバム（Album）に関するサービスを提供するためのインターフェース
 type AlbumService interface {
-	GetAlbumListService(ctx context.Context) ([]*model.Album, error) // 一覧を取得する
-	GetAlbumService(ctx context.Context, albumID model.AlbumID) (*model.Album, error) // 取得する
-	PostAlbumService(ctx context.Context, album *model.Album) error // 追加する
-	DeleteAlbumService(ctx context.Context, albumID model.AlbumID) error // 削除する
+	GetAlbumListService(ctx context.Context, query repository.AlbumQuery) (*repository.Page[*model.AlbumWithSinger], error) // 条件に合う一覧を歌手の情報を付加してページ単位で取得する
+	GetAlbumService(ctx context.Context, albumID model.AlbumID) (*model.AlbumWithSinger, error) // 歌手の情報を付加して取得する
+	GetSingerAlbumListService(ctx context.Context, singerID model.SingerID) ([]*model.AlbumWithSinger, error) // 指定された歌手のアルバム一覧を取得する
+	PostAlbumService(ctx context.Context, album *model.Album) (*model.AlbumWithSinger, error) // 追加し、歌手の情報を付加して返す
+	PutAlbumService(ctx context.Context, album *model.Album) (*model.AlbumWithSinger, error) // 置き換え、歌手の情報を付加して返す（album.Version が 0 以外の場合は現在のバージョンと一致するときだけ置き換える）
+	PatchAlbumService(ctx context.Context, albumID model.AlbumID, version model.Version, apply func(*model.Album) error) (*model.AlbumWithSinger, error) // 部分的に更新し、歌手の情報を付加して返す（version が 0 以外の場合は現在のバージョンと一致するときだけ更新する）
+	DeleteAlbumService(ctx context.Context, albumID model.AlbumID, version model.Version) error // ゴミ箱に移動する（存在しない場合は apperror.ErrNotFound を返す。version が 0 以外の場合は現在のバージョンと一致するときだけ移動する）
+	RestoreAlbumService(ctx context.Context, albumID model.AlbumID) (*model.AlbumWithSinger, error) // ゴミ箱から元に戻し、歌手の情報を付加して返す
+	BatchAlbumService(ctx context.Context, ops []*BatchOperation[model.Album], atomic bool) ([]*BatchResult[model.AlbumWithSinger], error) // 追加・置き換え・削除をまとめて実行し、操作ごとの結果を返す（atomic が true の場合は 1 件でも失敗したらすべて取り消す）
 }
 
 
@@ -23,6 +29,10 @@ type AlbumService interface {
 type albumService struct {
 	// repository/album.go ファイルの AlbumRepository インターフェースを埋め込む
 	albumRepository repository.AlbumRepository
+	// アルバムに歌手の情報を付加するために repository/singer.go ファイルの SingerRepository インターフェースも持つ
+	singerRepository repository.SingerRepository
+	// 歌手の存在確認とアルバムの書き込みをまとめて実行するための repository/tx.go ファイルの Transactor インターフェース
+	transactor repository.Transactor
 }
 
 
@@ -31,46 +41,302 @@ var _ AlbumService = (*albumService)(nil)
 
 
 // NewAlbumService はアルバム（Album）に関するサービスを提供するための構造体を生成する
-func NewAlbumService(albumRepository repository.AlbumRepository) *albumService {
-	return &albumService{albumRepository: albumRepository}
+func NewAlbumService(albumRepository repository.AlbumRepository, singerRepository repository.SingerRepository, transactor repository.Transactor) *albumService {
+	return &albumService{albumRepository: albumRepository, singerRepository: singerRepository, transactor: transactor}
 }
 
 
 // 以下、サービスメソッドの実装
 
-// アルバム（Album）の一覧を取得するサービスメソッド
-func (s *albumService) GetAlbumListService(ctx context.Context) ([]*model.Album, error) {
-	albums, err := s.albumRepository.GetAll(ctx) // repository/album.go ファイルの GetAll メソッドを呼び出す
+// 条件に合うアルバム（Album）の一覧をページ単位で取得するサービスメソッド
+func (s *albumService) GetAlbumListService(ctx context.Context, query repository.AlbumQuery) (*repository.Page[*model.AlbumWithSinger], error) {
+	albums, err := s.albumRepository.List(ctx, query) // repository/album.go ファイルの List メソッドを呼び出す
 	if err != nil {
 		return nil, err
 	}
-	return albums, nil
+	items, err := s.withSingers(ctx, albums.Items)
+	if err != nil {
+		return nil, err
+	}
+	return &repository.Page[*model.AlbumWithSinger]{Items: items, NextCursor: albums.NextCursor}, nil
 }
 
 
 // 指定されたアルバムIDに対応するアルバム（Album）を取得するサービスメソッド
-func (s *albumService) GetAlbumService(ctx context.Context, albumID model.AlbumID) (*model.Album, error) {
+func (s *albumService) GetAlbumService(ctx context.Context, albumID model.AlbumID) (*model.AlbumWithSinger, error) {
 	album, err := s.albumRepository.Get(ctx, albumID) // repository/album.go ファイルの Get メソッドを呼び出す
 	if err != nil {
 		return nil, err
 	}
-	return album, nil
+	return s.withSinger(ctx, album)
+}
+
+
+// 指定された歌手IDに対応する歌手（Singer）がクレジットされたアルバム（Album）一覧を取得するサービスメソッド
+// 歌手が存在しない場合は apperror.ErrNotFound を返す
+func (s *albumService) GetSingerAlbumListService(ctx context.Context, singerID model.SingerID) ([]*model.AlbumWithSinger, error) {
+	if _, err := s.singerRepository.Get(ctx, singerID); err != nil { // repository/singer.go ファイルの Get メソッドを呼び出す
+		return nil, err
+	}
+
+	albums, err := s.albumRepository.ListBySinger(ctx, singerID) // repository/album.go ファイルの ListBySinger メソッドを呼び出す（クレジットされたアルバムも含む）
+	if err != nil {
+		return nil, err
+	}
+	return s.withSingers(ctx, albums)
 }
 
 
 // 新しいアルバム（Album）を追加するサービスメソッド
-func (s *albumService) PostAlbumService(ctx context.Context, album *model.Album) error {
-	if err := s.albumRepository.Add(ctx, album); err != nil { // repository/album.go ファイルの Add メソッドを呼び出す
+// アルバムが参照する（クレジットする）歌手が存在しない場合は apperror.ErrValidation を返す
+// 歌手の存在確認と追加は 1 つのトランザクションで行うので、確認した後に歌手が削除されることはない
+// album には採番したIDと新しいバージョンを設定し、GET /albums/{id} と同じく歌手の情報を付加したアルバムを返す
+func (s *albumService) PostAlbumService(ctx context.Context, album *model.Album) (*model.AlbumWithSinger, error) {
+	if err := validateAlbum(album); err != nil { // 入力値を検証し、違反している項目をまとめて返す
+		return nil, err
+	}
+
+	err := s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		if err := s.checkSingersExist(ctx, album.CreditedSingerIDs()); err != nil {
+			return err
+		}
+		return s.albumRepository.Add(ctx, album) // repository/album.go ファイルの Add メソッドを呼び出す
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.withSinger(ctx, album)
+}
+
+
+// アルバム（Album）を置き換えるサービスメソッド
+// アルバムが参照する（クレジットする）歌手が存在しない場合は apperror.ErrValidation を返す
+// album には新しいバージョンを設定し、歌手の情報を付加したアルバムを返す
+func (s *albumService) PutAlbumService(ctx context.Context, album *model.Album) (*model.AlbumWithSinger, error) {
+	if err := validateAlbum(album); err != nil { // 入力値を検証し、違反している項目をまとめて返す
+		return nil, err
+	}
+
+	err := s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		if err := s.checkSingersExist(ctx, album.CreditedSingerIDs()); err != nil {
+			return err
+		}
+		return s.albumRepository.Update(ctx, album) // repository/album.go ファイルの Update メソッドを呼び出す
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.withSinger(ctx, album)
+}
+
+
+// 指定されたアルバムIDに対応するアルバム（Album）を部分的に更新するサービスメソッド
+// apply には現在のアルバムのコピーが渡されるので、変更したい項目だけを書き換える（ID は変更できない）
+// クレジットを変更せずに singer_id だけを変更した場合は、元の歌手の primary のクレジットを新しい歌手に置き換える
+func (s *albumService) PatchAlbumService(ctx context.Context, albumID model.AlbumID, version model.Version, apply func(*model.Album) error) (*model.AlbumWithSinger, error) {
+	current, err := s.albumRepository.Get(ctx, albumID) // repository/album.go ファイルの Get メソッドを呼び出す
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && version != current.Version {
+		return nil, apperror.Precondition(apperror.CodeVersionMismatch, "album %d has version %d, not %d", albumID, current.Version, version)
+	}
+
+	album := *current // リポジトリが保持しているデータを直接書き換えないようにコピーする
+	if err := apply(&album); err != nil {
+		return nil, err
+	}
+	album.Version = current.Version // バージョンはパッチで変更できない。取得してから更新するまでに他の更新があった場合はリポジトリがエラーを返す
+	if album.ID != albumID {
+		return nil, apperror.Validation(apperror.CodeImmutableField, "id cannot be changed")
+	}
+	if album.SingerID != current.SingerID && equalCredits(album.Credits, current.Credits) {
+		album.Credits = replacePrimaryCredit(album.Credits, current.SingerID, album.SingerID)
+	}
+	if err := validateAlbum(&album); err != nil { // パッチを適用した結果を検証する
+		return nil, err
+	}
+
+	err = s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		// 新しくクレジットされた歌手だけを確認する（歌手だけを削除したアルバムもタイトルなどは変更できるようにする）
+		if err := s.checkSingersExist(ctx, addedSingerIDs(current, &album)); err != nil {
+			return err
+		}
+		return s.albumRepository.Update(ctx, &album) // repository/album.go ファイルの Update メソッドを呼び出す
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.withSinger(ctx, &album)
+}
+
+
+// 指定されたアルバムIDに対応するアルバム（Album）をゴミ箱に移動するサービスメソッド
+func (s *albumService) DeleteAlbumService(ctx context.Context, albumID model.AlbumID, version model.Version) error {
+	if err := s.albumRepository.Delete(ctx, albumID, version); err != nil { // repository/album.go ファイルの Delete メソッドを呼び出す
 		return err
 	}
 	return nil
 }
 
 
-// 指定されたアルバムIDに対応するアルバム（Album）を削除するサービスメソッド
-func (s *albumService) DeleteAlbumService(ctx context.Context, albumID model.AlbumID) error {
-	if err := s.albumRepository.Delete(ctx, albumID); err != nil { // repository/album.go ファイルの Delete メソッドを呼び出す
+// 指定されたアルバムIDに対応するアルバム（Album）をゴミ箱から元に戻すサービスメソッド
+// アルバムがクレジットする歌手が存在しない（ゴミ箱に入っている）場合は元に戻さずに apperror.ErrValidation を返すので、先に歌手を元に戻す
+func (s *albumService) RestoreAlbumService(ctx context.Context, albumID model.AlbumID) (*model.AlbumWithSinger, error) {
+	var album *model.Album
+	err := s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		var err error
+		album, err = s.albumRepository.Restore(ctx, albumID) // repository/album.go ファイルの Restore メソッドを呼び出す
+		if err != nil {
+			return err
+		}
+		return s.checkSingersExist(ctx, album.CreditedSingerIDs()) // 歌手が存在しない場合はトランザクションごと取り消す
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.withSinger(ctx, album)
+}
+
+
+// checkSingersExist はアルバムが参照する歌手がすべて存在するかを確認し、存在しない歌手がいる場合は apperror.ErrValidation を返す
+// 確認した歌手はトランザクションが終わるまでロックするので、確認してからアルバムを書き込むまでに歌手がゴミ箱に移動されることはない
+func (s *albumService) checkSingersExist(ctx context.Context, singerIDs []model.SingerID) error {
+	if len(singerIDs) == 0 {
+		return nil
+	}
+	singers, err := s.singerRepository.LockByIDs(ctx, singerIDs) // repository/singer.go ファイルの LockByIDs メソッドを呼び出す
+	if err != nil {
 		return err
 	}
+	for _, id := range singerIDs {
+		if _, ok := singers[id]; !ok {
+			return apperror.Validation(apperror.CodeReferencedSingerMissing, "singer %d does not exist", id)
+		}
+	}
 	return nil
 }
+
+
+// addedSingerIDs は更新後のアルバムで新しく参照するようになった歌手のIDを返す
+func addedSingerIDs(current, updated *model.Album) []model.SingerID {
+	var added []model.SingerID
+	for _, id := range updated.CreditedSingerIDs() {
+		if !current.HasCredit(id) {
+			added = append(added, id)
+		}
+	}
+	return added
+}
+
+
+// equalCredits は 2 つのクレジットの一覧が同じ順番で同じ内容かを返す
+func equalCredits(a, b []model.Credit) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+
+// replacePrimaryCredit は from の歌手の primary のクレジットを to の歌手に置き換えた新しい一覧を返す
+// to の歌手がすでに primary としてクレジットされている場合は from のクレジットを取り除く
+func replacePrimaryCredit(credits []model.Credit, from, to model.SingerID) []model.Credit {
+	result := make([]model.Credit, 0, len(credits))
+	seen := false
+	for _, c := range credits {
+		if c.Role == model.CreditPrimary && (c.SingerID == from || c.SingerID == to) {
+			if seen {
+				continue
+			}
+			c.SingerID, seen = to, true
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+
+// withSingers はアルバムの一覧に歌手とクレジットされた歌手の情報を付加する
+// アルバムごとに歌手を取得するのではなく、歌手IDをまとめて一度だけリポジトリに問い合わせる
+func (s *albumService) withSingers(ctx context.Context, albums []*model.Album) ([]*model.AlbumWithSinger, error) {
+	ids := make([]model.SingerID, 0, len(albums))
+	seen := make(map[model.SingerID]struct{}, len(albums))
+	for _, album := range albums {
+		for _, id := range album.CreditedSingerIDs() {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
+	}
+
+	singers, err := s.singerRepository.GetByIDs(ctx, ids) // repository/singer.go ファイルの GetByIDs メソッドを呼び出す
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.AlbumWithSinger, 0, len(albums))
+	for _, album := range albums {
+		result = append(result, newAlbumWithSinger(album, singers))
+	}
+	return result, nil
+}
+
+
+// withSinger は 1 件のアルバムに歌手とクレジットされた歌手の情報を付加する
+func (s *albumService) withSinger(ctx context.Context, album *model.Album) (*model.AlbumWithSinger, error) {
+	albums, err := s.withSingers(ctx, []*model.Album{album})
+	if err != nil {
+		return nil, err
+	}
+	return albums[0], nil
+}
+
+
+// newAlbumWithSinger はアルバムに歌手の情報を付加したレスポンス用の構造体を生成する
+// singers に含まれない（削除された）歌手は null にする
+func newAlbumWithSinger(album *model.Album, singers map[model.SingerID]*model.Singer) *model.AlbumWithSinger {
+	credits := make([]*model.CreditWithSinger, 0, len(album.Credits)+1)
+	for _, c := range album.CreditList() {
+		credits = append(credits, &model.CreditWithSinger{SingerID: c.SingerID, Role: c.Role, Singer: singers[c.SingerID]})
+	}
+	return &model.AlbumWithSinger{
+		ID:          album.ID,
+		Title:       album.Title,
+		Singer:      singers[album.SingerID],
+		ReleaseDate: album.ReleaseDate,
+		Genres:      album.Genres,
+		Credits:     credits,
+		Version:     album.Version,
+		DeletedAt:   album.DeletedAt,
+	}
+}
+
+
+// アルバム（Album）の追加・置き換え・削除をまとめて実行するサービスメソッド
+// 操作ごとに PostAlbumService・PutAlbumService・DeleteAlbumService を呼び出すので、入力値の検証や歌手の存在確認と、結果のアルバムの形式は個別の操作と同じ
+func (s *albumService) BatchAlbumService(ctx context.Context, ops []*BatchOperation[model.Album], atomic bool) ([]*BatchResult[model.AlbumWithSinger], error) {
+	return runBatch(ctx, s.transactor, ops, atomic, func(ctx context.Context, op *BatchOperation[model.Album]) (int, *model.AlbumWithSinger, error) {
+		switch op.Op {
+		case BatchCreate:
+			album := *op.Value
+			value, err := s.PostAlbumService(ctx, &album)
+			return int(album.ID), value, err
+		case BatchUpdate:
+			album := *op.Value
+			album.ID, album.Version = model.AlbumID(op.ID), op.Version
+			value, err := s.PutAlbumService(ctx, &album)
+			return op.ID, value, err
+		case BatchDelete:
+			return op.ID, nil, s.DeleteAlbumService(ctx, model.AlbumID(op.ID), op.Version)
+		}
+		return op.ID, nil, unknownBatchOp(op.Op)
+	})
+}
@@ -0,0 +1,82 @@
+// 複数の追加・置き換え・削除をまとめて実行するバッチ処理を提供するためのファイル
+
+package service
+
+import (
+	"context"
+	"errors"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// BatchOp はバッチで実行する操作の種類
+type BatchOp string
+
+const (
+	BatchCreate BatchOp = "create" // 追加する（Post と同じ）
+	BatchUpdate BatchOp = "update" // 置き換える（Put と同じ）
+	BatchDelete BatchOp = "delete" // ゴミ箱に移動する（Delete と同じ）
+)
+
+// BatchOperation はバッチの 1 件の操作。T は model.Singer または model.Album
+type BatchOperation[T any] struct {
+	Op      BatchOp
+	ID      int           // update と delete の対象のID（create では使わない。追加するIDは Value に指定する）
+	Version model.Version // update と delete で 0 以外の場合は、現在のバージョンと一致するときだけ実行する
+	Value   *T            // create と update で書き込む内容（delete では nil）
+}
+
+// BatchResult はバッチの 1 件の操作の結果。R は結果として返すデータの型（model.Singer または model.AlbumWithSinger）
+type BatchResult[R any] struct {
+	Op      BatchOp
+	ID      int   // 操作したデータのID（create で失敗した場合と、Aborted の create は 0。取り消した create で採番したIDは存在しないので返さない）
+	Value   *R    // create と update で書き込んだ内容（失敗した場合や delete では nil）
+	Err     error // 失敗した理由
+	Aborted bool  // Atomic でほかの操作が失敗したため、取り消した（または実行しなかった）
+}
+
+// errBatchAborted は Atomic のバッチで失敗した操作があったときに、変更を取り消すために RunInTx の fn から返すエラー
+var errBatchAborted = errors.New("batch aborted")
+
+// runBatch は ops を順番に apply で実行し、操作ごとの結果を ops と同じ順で返す
+// atomic が false の場合は操作ごとに各サービスのトランザクションで実行し、失敗した操作があっても残りの操作を続ける
+// atomic が true の場合はすべての操作を 1 つのトランザクションで実行し、失敗した時点で残りの操作を実行せずにすべてを取り消す
+// 取り消した操作と実行しなかった操作は Aborted にする
+func runBatch[T, R any](ctx context.Context, transactor repository.Transactor, ops []*BatchOperation[T], atomic bool, apply func(ctx context.Context, op *BatchOperation[T]) (id int, value *R, err error)) ([]*BatchResult[R], error) {
+	results := make([]*BatchResult[R], len(ops))
+	run := func(ctx context.Context) error {
+		for i, op := range ops {
+			id, value, err := apply(ctx, op)
+			results[i] = &BatchResult[R]{Op: op.Op, ID: id, Err: err}
+			if err == nil {
+				results[i].Value = value
+				continue
+			}
+			if atomic {
+				for j, op := range ops { // 取り消した操作で採番したIDは使われないので、指定されたIDだけを返す
+					if j != i {
+						results[j] = &BatchResult[R]{Op: op.Op, ID: op.ID, Aborted: true}
+					}
+				}
+				return errBatchAborted
+			}
+		}
+		return nil
+	}
+
+	if !atomic {
+		run(ctx)
+		return results, nil
+	}
+	if err := transactor.RunInTx(ctx, run); err != nil && !errors.Is(err, errBatchAborted) { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		return nil, err
+	}
+	return results, nil
+}
+
+// unknownBatchOp は操作の種類が不正な場合のエラーを返す
+func unknownBatchOp(op BatchOp) error {
+	return apperror.InvalidArgument(apperror.CodeInvalidBatchOp, "op must be %s, %s or %s, not %q", BatchCreate, BatchUpdate, BatchDelete, op)
+}
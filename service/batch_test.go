@@ -0,0 +1,131 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/service"
+)
+
+func TestBatchSingerAtomicRollsBack(t *testing.T) {
+	ctx := context.Background()
+	s := newServices()
+	ops := []*service.BatchOperation[model.Singer]{
+		{Op: service.BatchCreate, Value: &model.Singer{Name: "Frank"}},
+		{Op: service.BatchUpdate, ID: 1, Value: &model.Singer{Name: "Alicia"}},
+		{Op: service.BatchDelete, ID: 5},
+		{Op: service.BatchUpdate, ID: 99, Value: &model.Singer{Name: "Nobody"}},
+		{Op: service.BatchDelete, ID: 4},
+	}
+
+	results, err := s.singers.BatchSingerService(ctx, ops, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(ops) {
+		t.Fatalf("got %d results, want %d", len(results), len(ops))
+	}
+	if err := results[3].Err; !errors.Is(err, apperror.ErrNotFound) || results[3].Aborted {
+		t.Fatalf("failed operation: got %+v, want %v", results[3], apperror.ErrNotFound)
+	}
+	for _, i := range []int{0, 1, 2, 4} {
+		if r := results[i]; !r.Aborted || r.Err != nil || r.Value != nil || r.ID != ops[i].ID {
+			t.Fatalf("results[%d]: got %+v, want aborted with the requested id", i, r)
+		}
+	}
+
+	// すべての操作が取り消され、採番したIDも使われない
+	if all, _ := s.singerRepo.GetAll(ctx); len(all) != 5 {
+		t.Fatalf("got %d singers after an aborted batch, want 5", len(all))
+	}
+	if alice, _ := s.singerRepo.Get(ctx, 1); alice.Name != "Alice" || alice.Version != 1 {
+		t.Fatalf("aborted update was applied: %+v", alice)
+	}
+	if !singerExists(s, 5) {
+		t.Fatal("aborted delete was applied")
+	}
+}
+
+func TestBatchSingerNonAtomicKeepsSuccessfulOperations(t *testing.T) {
+	ctx := context.Background()
+	s := newServices()
+	ops := []*service.BatchOperation[model.Singer]{
+		{Op: service.BatchCreate, Value: &model.Singer{Name: "Frank"}},
+		{Op: service.BatchUpdate, ID: 1, Version: 7, Value: &model.Singer{Name: "Alicia"}},
+		{Op: service.BatchDelete, ID: 2}, // アルバムが残っているので削除できない（SingerDeleteRestrict）
+		{Op: service.BatchDelete, ID: 5},
+		{Op: "merge", ID: 3},
+	}
+
+	results, err := s.singers.BatchSingerService(ctx, ops, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frank := results[0]
+	if frank.Err != nil || frank.ID == 0 || frank.Value == nil || frank.Value.Name != "Frank" || frank.Value.Version != 1 {
+		t.Fatalf("create: got %+v", frank)
+	}
+	for i, want := range map[int]error{1: apperror.ErrPrecondition, 2: apperror.ErrConflict, 4: apperror.ErrInvalidArgument} {
+		if err := results[i].Err; !errors.Is(err, want) {
+			t.Fatalf("results[%d]: got %v, want %v", i, err, want)
+		}
+	}
+	if r := results[3]; r.Err != nil || r.ID != 5 || r.Value != nil {
+		t.Fatalf("delete: got %+v", r)
+	}
+	for i, r := range results {
+		if r.Aborted {
+			t.Fatalf("results[%d] is aborted in a non-atomic batch", i)
+		}
+	}
+
+	if !singerExists(s, model.SingerID(frank.ID)) || singerExists(s, 5) || !singerExists(s, 2) {
+		t.Fatal("successful operations were not kept")
+	}
+}
+
+func TestBatchAlbumAtomic(t *testing.T) {
+	ctx := context.Background()
+	s := newServices()
+	ops := []*service.BatchOperation[model.Album]{
+		{Op: service.BatchCreate, Value: &model.Album{Title: "New", SingerID: 3}},
+		{Op: service.BatchUpdate, ID: 1, Value: &model.Album{Title: "Renamed", SingerID: 2}},
+		{Op: service.BatchDelete, ID: 3},
+	}
+
+	// すべて成功した場合は反映し、結果には歌手の情報を付加したアルバムを返す
+	results, err := s.albums.BatchAlbumService(ctx, ops, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range results {
+		if r.Err != nil || r.Aborted {
+			t.Fatalf("results[%d]: got %+v", i, r)
+		}
+	}
+	if v := results[0].Value; v == nil || v.ID == 0 || v.Singer == nil || v.Singer.Name != "Chris" {
+		t.Fatalf("create: got %+v", v)
+	}
+	if v := results[1].Value; v == nil || v.Title != "Renamed" || v.Singer == nil || v.Singer.Name != "Bella" || v.Version != 2 {
+		t.Fatalf("update: got %+v", v)
+	}
+
+	// 歌手が存在しないアルバムがあると、ほかの操作も取り消す
+	ops = []*service.BatchOperation[model.Album]{
+		{Op: service.BatchUpdate, ID: 2, Value: &model.Album{Title: "Changed", SingerID: 1}},
+		{Op: service.BatchCreate, Value: &model.Album{Title: "Unknown singer", SingerID: 99}},
+	}
+	results, err = s.albums.BatchAlbumService(ctx, ops, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results[0].Aborted || !errors.Is(results[1].Err, apperror.ErrValidation) || results[1].ID != 0 {
+		t.Fatalf("got %+v, %+v", results[0], results[1])
+	}
+	if album, _ := s.albumRepo.Get(ctx, 2); album.Title != "Alice's 2nd Album" {
+		t.Fatalf("aborted update was applied: %+v", album)
+	}
+}
@@ -0,0 +1,324 @@
+// カタログ（歌手とアルバム）をまとめてインポート・エクスポートするサービスを提供するためのファイル
+
+package service
+
+import (
+	"context"
+	"errors"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// CatalogService はカタログをまとめてインポート・エクスポートするサービスを提供するためのインターフェース
+type CatalogService interface {
+	ImportCatalogService(ctx context.Context, rows []*ImportRow, opts ImportOptions) (*ImportReport, error) // 行ごとに追加または置き換え、行ごとの結果を返す
+	ExportCatalogService(ctx context.Context, emit func(*model.CatalogRecord) error) error                  // ゴミ箱に入っていない歌手とアルバムを 1 件ずつ emit に渡す
+}
+
+// ImportRow はインポートする 1 行
+type ImportRow struct {
+	Line     int                  // 入力の行番号（1 から始まる）
+	Record   *model.CatalogRecord // 読み込んだデータ（ParseErr が nil でない場合は nil）
+	ParseErr error                // 行を読み込めなかった場合のエラー（apperror.ErrValidation）
+}
+
+// ImportOptions はインポートの動作を指定する
+type ImportOptions struct {
+	DryRun bool // true の場合は結果を報告するだけで、変更はすべて取り消す
+	Atomic bool // true の場合は 1 行でも失敗したらすべての行を取り消す（false の場合は成功した行だけを反映する）
+}
+
+// ImportAction はインポートした 1 行の結果の種類
+type ImportAction string
+
+const (
+	ImportCreated ImportAction = "created" // 追加した
+	ImportUpdated ImportAction = "updated" // 同じIDのデータを置き換えた
+	ImportFailed  ImportAction = "failed"  // 失敗した（Err に理由がある）
+	ImportSkipped ImportAction = "skipped" // Atomic でほかの行が失敗したため実行しなかった
+)
+
+// ImportResult はインポートした 1 行の結果
+type ImportResult struct {
+	Line   int
+	Type   model.CatalogRecordType
+	ID     int // 追加または置き換えたデータのID（失敗した場合は入力のID）
+	Action ImportAction
+	Err    error
+}
+
+// ImportReport はインポート全体の結果
+type ImportReport struct {
+	Committed bool // 変更を反映したか（DryRun の場合や、Atomic で失敗した行がある場合は false）
+	Succeeded int
+	Failed    int
+	Results   []*ImportResult // 入力の行の順
+}
+
+// exportPageSize はエクスポートで一度にリポジトリから読む件数（この件数を超えてメモリに保持しない）
+const exportPageSize = 100
+
+// errRollback はインポートの変更を取り消すために RunInTx の fn から返すエラー
+var errRollback = errors.New("rollback import")
+
+// カタログのインポート・エクスポートのサービスを提供するための構造体
+type catalogService struct {
+	// 入力値の検証と参照の確認を個別の API と同じにするため、歌手とアルバムのサービスを通して書き込む
+	singerService SingerService
+	albumService  AlbumService
+	// 同じIDのデータがあるか（追加か置き換えか）の確認と、エクスポートのための読み込みに使う
+	singerRepository repository.SingerRepository
+	albumRepository  repository.AlbumRepository
+	// DryRun と Atomic のときにすべての行を 1 つのトランザクションで実行するための repository/tx.go ファイルの Transactor インターフェース
+	transactor repository.Transactor
+}
+
+// 構造体 catalogService が CatalogService インターフェースを実装していることをコンパイラに伝える
+var _ CatalogService = (*catalogService)(nil)
+
+// NewCatalogService はカタログのインポート・エクスポートのサービスを提供するための構造体を生成する
+func NewCatalogService(singerService SingerService, albumService AlbumService, singerRepository repository.SingerRepository, albumRepository repository.AlbumRepository, transactor repository.Transactor) *catalogService {
+	return &catalogService{
+		singerService:    singerService,
+		albumService:     albumService,
+		singerRepository: singerRepository,
+		albumRepository:  albumRepository,
+		transactor:       transactor,
+	}
+}
+
+// カタログをインポートするサービスメソッド
+// 行を順番に実行し、ID が指定されていて同じIDのデータがある場合は置き換え、ない場合は追加する
+// DryRun と Atomic の場合はすべての行を 1 つのトランザクションで実行し、DryRun の場合は最後に、Atomic の場合は失敗した時点で取り消す
+// Atomic の場合は、まず全行を読み込みと入力値の検証だけで確認し、失敗した行があれば何も実行せずにすべての失敗を報告する
+func (s *catalogService) ImportCatalogService(ctx context.Context, rows []*ImportRow, opts ImportOptions) (*ImportReport, error) {
+	report := &ImportReport{Results: make([]*ImportResult, len(rows))}
+	for i, row := range rows {
+		report.Results[i] = newImportResult(row)
+	}
+
+	if opts.Atomic && precheckRows(rows, report) {
+		return report, nil
+	}
+
+	apply := func(ctx context.Context) error {
+		for i, row := range rows {
+			result := report.Results[i]
+			if result.Action == ImportSkipped {
+				break
+			}
+			if result.Err == nil {
+				result.Err = s.importRecord(ctx, row.Record, result)
+			}
+			if result.Err != nil {
+				result.Action = ImportFailed
+				report.Failed++
+				if opts.Atomic { // 残りの行は実行しない
+					skipAfter(report.Results, i)
+					return errRollback
+				}
+				continue
+			}
+			report.Succeeded++
+		}
+		if opts.DryRun {
+			return errRollback
+		}
+		return nil
+	}
+
+	if !opts.DryRun && !opts.Atomic { // 行ごとに各サービスのトランザクションで実行し、成功した行だけを反映する
+		apply(ctx)
+		report.Committed = true
+		return report, nil
+	}
+	err := s.transactor.RunInTx(ctx, apply) // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+	if err != nil && !errors.Is(err, errRollback) {
+		return nil, err
+	}
+	report.Committed = err == nil
+	return report, nil
+}
+
+// newImportResult は行の結果を初期化する。読み込めなかった行は失敗にする
+func newImportResult(row *ImportRow) *ImportResult {
+	result := &ImportResult{Line: row.Line, Err: row.ParseErr}
+	if row.ParseErr != nil {
+		result.Action = ImportFailed
+		return result
+	}
+	result.Type = row.Record.Type
+	switch row.Record.Type {
+	case model.CatalogSinger:
+		result.ID = int(row.Record.Singer.ID)
+	case model.CatalogAlbum:
+		result.ID = int(row.Record.Album.ID)
+	}
+	return result
+}
+
+// precheckRows は Atomic のインポートを実行する前に、全行の読み込みと入力値の検証の結果を確認する
+// 失敗した行がある場合は失敗した行を報告し、ほかの行を skipped にして true を返す
+func precheckRows(rows []*ImportRow, report *ImportReport) bool {
+	for i, row := range rows {
+		result := report.Results[i]
+		if result.Err == nil {
+			result.Err = validateRecord(row.Record)
+		}
+		if result.Err != nil {
+			result.Action = ImportFailed
+			report.Failed++
+		}
+	}
+	if report.Failed == 0 {
+		return false
+	}
+	for _, result := range report.Results {
+		if result.Err == nil {
+			result.Action = ImportSkipped
+		}
+	}
+	return true
+}
+
+// validateRecord は 1 件のデータの入力値だけを検証する（コピーを検証するので、データは書き換えない）
+func validateRecord(record *model.CatalogRecord) error {
+	switch record.Type {
+	case model.CatalogSinger:
+		singer := *record.Singer
+		return validateSinger(&singer)
+	case model.CatalogAlbum:
+		album := *record.Album
+		album.Genres = append([]string(nil), album.Genres...)
+		album.Credits = append([]model.Credit(nil), album.Credits...)
+		return validateAlbum(&album)
+	}
+	return apperror.Validation(apperror.CodeValidationFailed, "unknown record type: %q", record.Type)
+}
+
+// skipAfter は i 番目より後の行を skipped にする
+func skipAfter(results []*ImportResult, i int) {
+	for _, result := range results[i+1:] {
+		if result.Action == "" {
+			result.Action = ImportSkipped
+		}
+	}
+}
+
+// importRecord は 1 件のデータを追加または置き換え、結果を result に設定する
+// 入力のバージョンは使わず、現在のバージョンに関係なく置き換える
+// 同じIDのデータがゴミ箱に入っている場合は、追加も置き換えもせずに ErrConflict（singer_in_trash / album_in_trash）を返す
+func (s *catalogService) importRecord(ctx context.Context, record *model.CatalogRecord, result *ImportResult) error {
+	switch record.Type {
+	case model.CatalogSinger:
+		singer := *record.Singer
+		singer.Version = 0
+		exists, err := s.singerExists(ctx, singer.ID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			err = s.singerService.PutSingerService(ctx, &singer) // service/singer.go ファイルの PutSingerService メソッドを呼び出す
+			result.Action = ImportUpdated
+		} else {
+			err = s.singerService.PostSingerService(ctx, &singer) // service/singer.go ファイルの PostSingerService メソッドを呼び出す
+			result.Action = ImportCreated
+			if hasCode(err, apperror.CodeSingerAlreadyExists) { // Get で見つからないのにIDが使われている場合はゴミ箱に入っている
+				err = apperror.Conflict(apperror.CodeSingerInTrash, "singer %d is in the trash; restore it before importing", singer.ID)
+			}
+		}
+		result.ID = int(singer.ID)
+		return err
+	case model.CatalogAlbum:
+		album := *record.Album
+		album.Version = 0
+		exists, err := s.albumExists(ctx, album.ID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			_, err = s.albumService.PutAlbumService(ctx, &album) // service/album.go ファイルの PutAlbumService メソッドを呼び出す
+			result.Action = ImportUpdated
+		} else {
+			_, err = s.albumService.PostAlbumService(ctx, &album) // service/album.go ファイルの PostAlbumService メソッドを呼び出す
+			result.Action = ImportCreated
+			if hasCode(err, apperror.CodeAlbumAlreadyExists) { // Get で見つからないのにIDが使われている場合はゴミ箱に入っている
+				err = apperror.Conflict(apperror.CodeAlbumInTrash, "album %d is in the trash; restore it before importing", album.ID)
+			}
+		}
+		result.ID = int(album.ID)
+		return err
+	}
+	return apperror.Validation(apperror.CodeValidationFailed, "unknown record type: %q", record.Type)
+}
+
+// hasCode は err が指定されたエラーコードの apperror.Error かを返す
+func hasCode(err error, code string) bool {
+	var appErr *apperror.Error
+	return errors.As(err, &appErr) && appErr.Code == code
+}
+
+// singerExists は ID が指定されていて、その歌手が存在するか（ゴミ箱に入っていないか）を返す
+func (s *catalogService) singerExists(ctx context.Context, id model.SingerID) (bool, error) {
+	if id == 0 {
+		return false, nil
+	}
+	_, err := s.singerRepository.Get(ctx, id) // repository/singer.go ファイルの Get メソッドを呼び出す
+	if errors.Is(err, apperror.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// albumExists は ID が指定されていて、そのアルバムが存在するか（ゴミ箱に入っていないか）を返す
+func (s *catalogService) albumExists(ctx context.Context, id model.AlbumID) (bool, error) {
+	if id == 0 {
+		return false, nil
+	}
+	_, err := s.albumRepository.Get(ctx, id) // repository/album.go ファイルの Get メソッドを呼び出す
+	if errors.Is(err, apperror.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// カタログをエクスポートするサービスメソッド
+// 歌手をすべて渡してからアルバムを渡す。リポジトリからは exportPageSize 件ずつ読むので、カタログ全体をメモリに保持しない
+// ページごとに別々に読むので、エクスポート中に変更されたデータは反映される場合とされない場合がある
+func (s *catalogService) ExportCatalogService(ctx context.Context, emit func(*model.CatalogRecord) error) error {
+	page := repository.PageRequest{Limit: exportPageSize}
+	for {
+		singers, err := s.singerRepository.List(ctx, repository.SingerQuery{Page: page}) // repository/singer.go ファイルの List メソッドを呼び出す
+		if err != nil {
+			return err
+		}
+		for _, singer := range singers.Items {
+			if err := emit(&model.CatalogRecord{Type: model.CatalogSinger, Singer: singer}); err != nil {
+				return err
+			}
+		}
+		if singers.NextCursor == "" {
+			break
+		}
+		page.Cursor = singers.NextCursor
+	}
+
+	page = repository.PageRequest{Limit: exportPageSize}
+	for {
+		albums, err := s.albumRepository.List(ctx, repository.AlbumQuery{Page: page}) // repository/album.go ファイルの List メソッドを呼び出す
+		if err != nil {
+			return err
+		}
+		for _, album := range albums.Items {
+			if err := emit(&model.CatalogRecord{Type: model.CatalogAlbum, Album: album}); err != nil {
+				return err
+			}
+		}
+		if albums.NextCursor == "" {
+			return nil
+		}
+		page.Cursor = albums.NextCursor
+	}
+}
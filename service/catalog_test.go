@@ -0,0 +1,216 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/service"
+)
+
+func singerRow(line int, singer *model.Singer) *service.ImportRow {
+	return &service.ImportRow{Line: line, Record: &model.CatalogRecord{Type: model.CatalogSinger, Singer: singer}}
+}
+
+func albumRow(line int, album *model.Album) *service.ImportRow {
+	return &service.ImportRow{Line: line, Record: &model.CatalogRecord{Type: model.CatalogAlbum, Album: album}}
+}
+
+// actions は行ごとの結果の種類を返す
+func actions(report *service.ImportReport) []service.ImportAction {
+	got := make([]service.ImportAction, len(report.Results))
+	for i, result := range report.Results {
+		got[i] = result.Action
+	}
+	return got
+}
+
+func wantActions(t *testing.T, report *service.ImportReport, want ...service.ImportAction) {
+	t.Helper()
+	if got := actions(report); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("actions: got %v, want %v", got, want)
+	}
+}
+
+func singerExists(s *services, id model.SingerID) bool {
+	_, err := s.singerRepo.Get(context.Background(), id)
+	return err == nil
+}
+
+func TestImportCatalogDryRunRollsBack(t *testing.T) {
+	ctx := context.Background()
+	s := newServices()
+	rows := []*service.ImportRow{
+		singerRow(1, &model.Singer{ID: 10, Name: "Frank"}),
+		albumRow(2, &model.Album{ID: 10, Title: "Frank's 1st Album", SingerID: 10}),
+		singerRow(3, &model.Singer{ID: 1, Name: "Alicia"}),
+	}
+
+	report, err := s.catalog.ImportCatalogService(ctx, rows, service.ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Committed || report.Succeeded != 3 || report.Failed != 0 {
+		t.Fatalf("report: got committed=%v succeeded=%d failed=%d", report.Committed, report.Succeeded, report.Failed)
+	}
+	wantActions(t, report, service.ImportCreated, service.ImportCreated, service.ImportUpdated)
+
+	if singerExists(s, 10) {
+		t.Fatal("dry run added a singer")
+	}
+	if _, err := s.albumRepo.Get(ctx, 10); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("dry run added an album: %v", err)
+	}
+	if alice, _ := s.singerRepo.Get(ctx, 1); alice.Name != "Alice" || alice.Version != 1 {
+		t.Fatalf("dry run updated a singer: %+v", alice)
+	}
+}
+
+func TestImportCatalogAtomicPrecheck(t *testing.T) {
+	ctx := context.Background()
+	s := newServices()
+	rows := []*service.ImportRow{
+		singerRow(1, &model.Singer{ID: 10, Name: "Frank"}),
+		singerRow(2, &model.Singer{ID: 11, Name: ""}),
+		{Line: 3, ParseErr: apperror.Validation(apperror.CodeValidationFailed, "broken row")},
+		singerRow(4, &model.Singer{ID: 12, Name: "Grace"}),
+	}
+
+	report, err := s.catalog.ImportCatalogService(ctx, rows, service.ImportOptions{Atomic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 入力値の検証で失敗した行をすべて報告し、ほかの行は実行しない
+	if report.Committed || report.Succeeded != 0 || report.Failed != 2 {
+		t.Fatalf("report: got committed=%v succeeded=%d failed=%d", report.Committed, report.Succeeded, report.Failed)
+	}
+	wantActions(t, report, service.ImportSkipped, service.ImportFailed, service.ImportFailed, service.ImportSkipped)
+	if err := report.Results[1].Err; !errors.Is(err, apperror.ErrValidation) {
+		t.Fatalf("invalid row: got %v, want %v", err, apperror.ErrValidation)
+	}
+	if singerExists(s, 10) || singerExists(s, 12) {
+		t.Fatal("atomic import with invalid rows added singers")
+	}
+}
+
+func TestImportCatalogAtomicSkipsRemainingRows(t *testing.T) {
+	ctx := context.Background()
+	s := newServices()
+	rows := []*service.ImportRow{
+		singerRow(1, &model.Singer{ID: 10, Name: "Frank"}),
+		albumRow(2, &model.Album{ID: 10, Title: "Unknown singer", SingerID: 99}), // 入力値は正しいが、歌手が存在しない
+		singerRow(3, &model.Singer{ID: 11, Name: "Grace"}),
+	}
+
+	report, err := s.catalog.ImportCatalogService(ctx, rows, service.ImportOptions{Atomic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Committed || report.Succeeded != 1 || report.Failed != 1 {
+		t.Fatalf("report: got committed=%v succeeded=%d failed=%d", report.Committed, report.Succeeded, report.Failed)
+	}
+	wantActions(t, report, service.ImportCreated, service.ImportFailed, service.ImportSkipped)
+	if singerExists(s, 10) || singerExists(s, 11) {
+		t.Fatal("failed atomic import was not rolled back")
+	}
+}
+
+func TestImportCatalogKeepsSuccessfulRows(t *testing.T) {
+	ctx := context.Background()
+	s := newServices()
+	rows := []*service.ImportRow{
+		singerRow(1, &model.Singer{ID: 10, Name: "Frank"}),
+		albumRow(2, &model.Album{ID: 10, Title: "Unknown singer", SingerID: 99}),
+		singerRow(3, &model.Singer{Name: "Grace"}), // ID を省略した行は採番して追加する
+		albumRow(4, &model.Album{ID: 1, Title: "Renamed", SingerID: 10}),
+	}
+
+	report, err := s.catalog.ImportCatalogService(ctx, rows, service.ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Committed || report.Succeeded != 3 || report.Failed != 1 {
+		t.Fatalf("report: got committed=%v succeeded=%d failed=%d", report.Committed, report.Succeeded, report.Failed)
+	}
+	wantActions(t, report, service.ImportCreated, service.ImportFailed, service.ImportCreated, service.ImportUpdated)
+	if err := report.Results[1].Err; !errors.Is(err, apperror.ErrValidation) {
+		t.Fatalf("album with an unknown singer: got %v, want %v", err, apperror.ErrValidation)
+	}
+
+	grace := report.Results[2].ID
+	if grace == 0 || !singerExists(s, 10) || !singerExists(s, model.SingerID(grace)) {
+		t.Fatalf("successful rows were not kept (grace id=%d)", grace)
+	}
+	if album, err := s.albumRepo.Get(ctx, 1); err != nil || album.Title != "Renamed" || album.SingerID != 10 {
+		t.Fatalf("replaced album: got %+v, %v", album, err)
+	}
+	if _, err := s.albumRepo.Get(ctx, 10); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("failed row was written: %v", err)
+	}
+}
+
+func TestImportCatalogReportsTrashedIDs(t *testing.T) {
+	ctx := context.Background()
+	s := newServices()
+	if err := s.singers.DeleteSingerService(ctx, 5, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.albums.DeleteAlbumService(ctx, 3, 0); err != nil {
+		t.Fatal(err)
+	}
+	rows := []*service.ImportRow{
+		singerRow(1, &model.Singer{ID: 5, Name: "Ellen"}),
+		albumRow(2, &model.Album{ID: 3, Title: "Bella's 1st Album", SingerID: 2}),
+	}
+
+	report, err := s.catalog.ImportCatalogService(ctx, rows, service.ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantActions(t, report, service.ImportFailed, service.ImportFailed)
+	for i, code := range []string{apperror.CodeSingerInTrash, apperror.CodeAlbumInTrash} {
+		var appErr *apperror.Error
+		if err := report.Results[i].Err; !errors.As(err, &appErr) || appErr.Code != code || !errors.Is(err, apperror.ErrConflict) {
+			t.Fatalf("row %d: got %v, want a conflict with code %s", i+1, err, code)
+		}
+	}
+}
+
+func TestExportCatalog(t *testing.T) {
+	ctx := context.Background()
+	s := newServices()
+
+	var got []string
+	err := s.catalog.ExportCatalogService(ctx, func(record *model.CatalogRecord) error {
+		switch record.Type {
+		case model.CatalogSinger:
+			got = append(got, fmt.Sprintf("singer:%d", record.Singer.ID))
+		case model.CatalogAlbum:
+			got = append(got, fmt.Sprintf("album:%d", record.Album.ID))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 歌手をすべて渡してからアルバムを渡す
+	want := "[singer:1 singer:2 singer:3 singer:4 singer:5 album:1 album:2 album:3]"
+	if fmt.Sprint(got) != want {
+		t.Fatalf("export: got %v, want %v", got, want)
+	}
+
+	errStop := errors.New("stop")
+	count := 0
+	err = s.catalog.ExportCatalogService(ctx, func(*model.CatalogRecord) error {
+		if count++; count == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) || count != 2 {
+		t.Fatalf("export with a failing emit: got %v after %d records, want %v after 2", err, count, errStop)
+	}
+}
@@ -0,0 +1,45 @@
+// 歌手とアルバムをまとめて全文検索するサービスを提供するためのファイル
+
+package service
+
+import (
+	"context"
+	"strings"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// SearchService は歌手の名前とアルバムのタイトルを全文検索するサービスを提供するためのインターフェース
+type SearchService interface {
+	GetSearchResultService(ctx context.Context, query repository.SearchQuery) ([]*model.SearchHit, error) // 検索語に一致する歌手とアルバムを一致の度合いが大きい順に取得する
+}
+
+// 全文検索のサービスを提供するための構造体
+type searchService struct {
+	searchRepository repository.SearchRepository
+}
+
+// 構造体 searchService が SearchService インターフェースを実装していることをコンパイラに伝える
+var _ SearchService = (*searchService)(nil)
+
+// NewSearchService は全文検索のサービスを提供するための構造体を生成する
+func NewSearchService(searchRepository repository.SearchRepository) *searchService {
+	return &searchService{searchRepository: searchRepository}
+}
+
+// 歌手とアルバムを全文検索するサービスメソッド
+// 検索語が空白だけの場合はすべてに一致させず、apperror.ErrInvalidArgument を返す
+func (s *searchService) GetSearchResultService(ctx context.Context, query repository.SearchQuery) ([]*model.SearchHit, error) {
+	query.Text = strings.TrimSpace(query.Text)
+	if query.Text == "" {
+		return nil, apperror.InvalidArgument(apperror.CodeInvalidSearchQuery, "search query must not be blank")
+	}
+
+	hits, err := s.searchRepository.Search(ctx, query) // repository/search.go ファイルの Search メソッドを呼び出す
+	if err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
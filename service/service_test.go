@@ -0,0 +1,30 @@
+package service_test
+
+import (
+	"server-recruit-challenge-sample/infra/memorydb"
+	"server-recruit-challenge-sample/repository"
+	"server-recruit-challenge-sample/service"
+)
+
+// services は memorydb のリポジトリ（初期データの歌手 1〜5 とアルバム 1〜3 を持つ）で組み立てたサービス
+type services struct {
+	singerRepo repository.SingerRepository
+	albumRepo  repository.AlbumRepository
+	singers    service.SingerService
+	albums     service.AlbumService
+	catalog    service.CatalogService
+}
+
+func newServices() *services {
+	singerRepo, albumRepo := memorydb.NewSingerRepository(), memorydb.NewAlbumRepository()
+	tx := memorydb.NewTransactor(singerRepo, albumRepo)
+	singers := service.NewSingerService(singerRepo, albumRepo, tx, service.SingerDeleteRestrict)
+	albums := service.NewAlbumService(albumRepo, singerRepo, tx)
+	return &services{
+		singerRepo: singerRepo,
+		albumRepo:  albumRepo,
+		singers:    singers,
+		albums:     albums,
+		catalog:    service.NewCatalogService(singers, albums, singerRepo, albumRepo, tx),
+	}
+}
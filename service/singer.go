@@ -4,7 +4,9 @@ package service // このファイルが service パッケージであること
 
 import (
 	"context"
+	"fmt"
 
+	"server-recruit-challenge-sample/apperror"
 	"server-recruit-challenge-sample/model"
 	"server-recruit-challenge-sample/repository"
 )
@@ -12,17 +14,49 @@ import (
 
 // SingerService は歌手（Singer）に関するサービスを提供するためのインターフェース
 type SingerService interface {
-	GetSingerListService(ctx context.Context) ([]*model.Singer, error) // 一覧を取得する
+	GetSingerListService(ctx context.Context, query repository.SingerQuery) (*repository.Page[*model.Singer], error) // 条件に合う一覧をページ単位で取得する
 	GetSingerService(ctx context.Context, singerID model.SingerID) (*model.Singer, error) // 取得する
 	PostSingerService(ctx context.Context, singer *model.Singer) error // 追加する
-	DeleteSingerService(ctx context.Context, singerID model.SingerID) error // 削除する
+	PutSingerService(ctx context.Context, singer *model.Singer) error // 置き換える（singer.Version が 0 以外の場合は現在のバージョンと一致するときだけ置き換える）
+	PatchSingerService(ctx context.Context, singerID model.SingerID, version model.Version, apply func(*model.Singer) error) (*model.Singer, error) // 部分的に更新する（version が 0 以外の場合は現在のバージョンと一致するときだけ更新する）
+	DeleteSingerService(ctx context.Context, singerID model.SingerID, version model.Version) error // ゴミ箱に移動する（存在しない場合は apperror.ErrNotFound を返す。version が 0 以外の場合は現在のバージョンと一致するときだけ移動する）
+	RestoreSingerService(ctx context.Context, singerID model.SingerID) (*model.Singer, error) // ゴミ箱から元に戻す
+	BatchSingerService(ctx context.Context, ops []*BatchOperation[model.Singer], atomic bool) ([]*BatchResult[model.Singer], error) // 追加・置き換え・削除をまとめて実行し、操作ごとの結果を返す（atomic が true の場合は 1 件でも失敗したらすべて取り消す）
 }
 
 
+// SingerDeletePolicy はアルバムが紐づいている歌手（Singer）を削除しようとしたときの振る舞いを表す
+type SingerDeletePolicy int
+
+const (
+	SingerDeleteRestrict SingerDeletePolicy = iota // クレジットされたアルバムが残っている場合は削除を拒否する（デフォルト）
+	SingerDeleteCascade                            // 歌手と一緒にその歌手のアルバムも削除し、ほかの歌手のアルバムからはクレジットを外す
+	SingerDeleteOrphan                             // アルバムは残したまま歌手だけを削除する
+)
+
+// ParseSingerDeletePolicy は文字列（restrict / cascade / orphan）から SingerDeletePolicy を生成する
+func ParseSingerDeletePolicy(s string) (SingerDeletePolicy, error) {
+	switch s {
+	case "", "restrict":
+		return SingerDeleteRestrict, nil
+	case "cascade":
+		return SingerDeleteCascade, nil
+	case "orphan":
+		return SingerDeleteOrphan, nil
+	}
+	return 0, fmt.Errorf("unknown singer delete policy: %q", s)
+}
+
 // 歌手（Singer）に関するサービスを提供するための構造体
 type singerService struct {
 	// repository/singer.go ファイルの SingerRepository インターフェースを埋め込む
 	singerRepository repository.SingerRepository
+	// 歌手を削除するときに紐づくアルバムを扱うため repository/album.go ファイルの AlbumRepository インターフェースも持つ
+	albumRepository repository.AlbumRepository
+	// 歌手とアルバムにまたがる操作をまとめて実行するための repository/tx.go ファイルの Transactor インターフェース
+	transactor repository.Transactor
+	// アルバムが紐づいている歌手を削除するときの振る舞い
+	deletePolicy SingerDeletePolicy
 }
 
 
@@ -31,16 +65,21 @@ var _ SingerService = (*singerService)(nil)
 
 
 // NewSingerService は歌手（Singer）に関するサービスを提供するための構造体を生成する
-func NewSingerService(singerRepository repository.SingerRepository) *singerService {
-	return &singerService{singerRepository: singerRepository}
+func NewSingerService(singerRepository repository.SingerRepository, albumRepository repository.AlbumRepository, transactor repository.Transactor, deletePolicy SingerDeletePolicy) *singerService {
+	return &singerService{
+		singerRepository: singerRepository,
+		albumRepository:  albumRepository,
+		transactor:       transactor,
+		deletePolicy:     deletePolicy,
+	}
 }
 
 
 // 以下、サービスメソッドの実装
 
-// 歌手（Singer）の一覧を取得するサービスメソッド
-func (s *singerService) GetSingerListService(ctx context.Context) ([]*model.Singer, error) {
-	singers, err := s.singerRepository.GetAll(ctx) // repository/singer.go ファイルの GetAll メソッドを呼び出す
+// 条件に合う歌手（Singer）の一覧をページ単位で取得するサービスメソッド
+func (s *singerService) GetSingerListService(ctx context.Context, query repository.SingerQuery) (*repository.Page[*model.Singer], error) {
+	singers, err := s.singerRepository.List(ctx, query) // repository/singer.go ファイルの List メソッドを呼び出す
 	if err != nil {
 		return nil, err
 	}
@@ -59,18 +98,176 @@ func (s *singerService) GetSingerService(ctx context.Context, singerID model.Sin
 
 
 // 新しい歌手（Singer）を追加するサービスメソッド
+// 正規化した名前が同じ歌手がすでにいる場合は追加しない。確認と追加は 1 つのトランザクションで行う
 func (s *singerService) PostSingerService(ctx context.Context, singer *model.Singer) error {
-	if err := s.singerRepository.Add(ctx, singer); err != nil { // repository/singer.go ファイルの Add メソッドを呼び出す
+	if err := validateSinger(singer); err != nil { // 入力値を検証し、違反している項目をまとめて返す
 		return err
 	}
-	return nil
+	return s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		if err := s.checkNameAvailable(ctx, singer); err != nil {
+			return err
+		}
+		return s.singerRepository.Add(ctx, singer) // repository/singer.go ファイルの Add メソッドを呼び出す
+	})
 }
 
 
-// 指定された歌手IDに対応する歌手（Singer）を削除するサービスメソッド
-func (s *singerService) DeleteSingerService(ctx context.Context, singerID model.SingerID) error {
-	if err := s.singerRepository.Delete(ctx, singerID); err != nil { // repository/singer.go ファイルの Delete メソッドを呼び出す
+// 歌手（Singer）を置き換えるサービスメソッド
+// 確認してから置き換えるので、失敗した場合に途中まで書き込んだ状態が呼び出し側のトランザクションに残ることはない
+func (s *singerService) PutSingerService(ctx context.Context, singer *model.Singer) error {
+	if err := validateSinger(singer); err != nil { // 入力値を検証し、違反している項目をまとめて返す
+		return err
+	}
+	return s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		if _, err := s.singerRepository.Get(ctx, singer.ID); err != nil { // 存在しない歌手の場合は名前の重複より先に apperror.ErrNotFound を返す
+			return err
+		}
+		if err := s.checkNameAvailable(ctx, singer); err != nil {
+			return err
+		}
+		return s.singerRepository.Update(ctx, singer) // repository/singer.go ファイルの Update メソッドを呼び出す
+	})
+}
+
+
+// 指定された歌手IDに対応する歌手（Singer）を部分的に更新するサービスメソッド
+// apply には現在の歌手のコピーが渡されるので、変更したい項目だけを書き換える（ID は変更できない）
+func (s *singerService) PatchSingerService(ctx context.Context, singerID model.SingerID, version model.Version, apply func(*model.Singer) error) (*model.Singer, error) {
+	var singer model.Singer
+	err := s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		current, err := s.singerRepository.Get(ctx, singerID) // repository/singer.go ファイルの Get メソッドを呼び出す
+		if err != nil {
+			return err
+		}
+		if version != 0 && version != current.Version {
+			return apperror.Precondition(apperror.CodeVersionMismatch, "singer %d has version %d, not %d", singerID, current.Version, version)
+		}
+
+		singer = *current // リポジトリが保持しているデータを直接書き換えないようにコピーする
+		if err := apply(&singer); err != nil {
+			return err
+		}
+		singer.Version = current.Version // バージョンはパッチで変更できない
+		if singer.ID != singerID {
+			return apperror.Validation(apperror.CodeImmutableField, "id cannot be changed")
+		}
+		if err := validateSinger(&singer); err != nil { // パッチを適用した結果を検証する
+			return err
+		}
+		if err := s.checkNameAvailable(ctx, &singer); err != nil {
+			return err
+		}
+		return s.singerRepository.Update(ctx, &singer) // repository/singer.go ファイルの Update メソッドを呼び出す
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &singer, nil
+}
+
+
+// checkNameAvailable は正規化した名前（全角・半角、大文字・小文字、ひらがな・カタカナの違いを無視した名前）が同じ歌手がほかにいないことを確認する
+// ゴミ箱の歌手は確認しないので、元に戻すときにもう一度確認する
+// この確認は重複している歌手をエラーメッセージで示すためのもの。同時に書き込んだ場合の重複は sqldb では一意インデックスが防ぎ、memorydb ではトランザクションが書き込み用のロックを持つので起きない
+func (s *singerService) checkNameAvailable(ctx context.Context, singer *model.Singer) error {
+	same, err := s.singerRepository.List(ctx, repository.SingerQuery{NameEquals: singer.Name}) // repository/singer.go ファイルの List メソッドを呼び出す（件数を指定しないので全件）
+	if err != nil {
 		return err
 	}
+	for _, other := range same.Items {
+		if other.ID != singer.ID {
+			return apperror.Conflict(apperror.CodeSingerNameTaken, "singer %d already has the name %q", other.ID, other.Name)
+		}
+	}
 	return nil
 }
+
+
+// 指定された歌手IDに対応する歌手（Singer）を削除するサービスメソッド
+// 歌手にアルバムが紐づいている場合は deletePolicy に従って処理する
+// アルバムと歌手の削除は 1 つのトランザクションで行うので、途中で失敗した場合は何も削除されず、途中の状態がほかのリクエストから見えることもない
+func (s *singerService) DeleteSingerService(ctx context.Context, singerID model.SingerID, version model.Version) error {
+	return s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		// アルバムを確認する前に歌手をゴミ箱に移動する（存在することとバージョンもここで確認する）
+		// 歌手をロックしてからアルバムを取得するので、同時に追加されたアルバムも確実に見つかり、これ以降はこの歌手を参照するアルバムを追加できない
+		if err := s.singerRepository.Delete(ctx, singerID, version); err != nil { // repository/singer.go ファイルの Delete メソッドを呼び出す
+			return err
+		}
+
+		if s.deletePolicy != SingerDeleteOrphan {
+			albums, err := s.albumRepository.ListBySinger(ctx, singerID) // repository/album.go ファイルの ListBySinger メソッドを呼び出す
+			if err != nil {
+				return err
+			}
+			if len(albums) > 0 && s.deletePolicy == SingerDeleteRestrict { // ゴミ箱への移動はトランザクションごと取り消される
+				return apperror.Conflict(apperror.CodeSingerHasAlbums, "singer %d still has %d album(s)", singerID, len(albums))
+			}
+			for _, album := range albums { // SingerDeleteCascade の場合はアルバムも削除する
+				if album.SingerID != singerID { // ほかの歌手のアルバムは残し、この歌手のクレジットだけを外す
+					album.Credits = removeCredits(album.Credits, singerID)
+					if err := s.albumRepository.Update(ctx, album); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := s.albumRepository.Delete(ctx, album.ID, 0); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+
+// removeCredits は指定された歌手のクレジットをすべて取り除いた新しい一覧を返す
+func removeCredits(credits []model.Credit, singerID model.SingerID) []model.Credit {
+	result := make([]model.Credit, 0, len(credits))
+	for _, c := range credits {
+		if c.SingerID != singerID {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+
+// 指定された歌手IDに対応する歌手（Singer）をゴミ箱から元に戻すサービスメソッド
+// SingerDeleteCascade で一緒にゴミ箱に移動したアルバムは元に戻さないので、必要な場合はアルバムごとに元に戻す
+// ゴミ箱に移動している間に同じ名前の歌手が追加された場合は元に戻さない
+func (s *singerService) RestoreSingerService(ctx context.Context, singerID model.SingerID) (*model.Singer, error) {
+	var singer *model.Singer
+	err := s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		var err error
+		if singer, err = s.singerRepository.Restore(ctx, singerID); err != nil { // repository/singer.go ファイルの Restore メソッドを呼び出す
+			return err
+		}
+		return s.checkNameAvailable(ctx, singer) // 元に戻した歌手自身は除いて確認し、重複していればトランザクションごと取り消す
+	})
+	if err != nil {
+		return nil, err
+	}
+	return singer, nil
+}
+
+
+// 歌手（Singer）の追加・置き換え・削除をまとめて実行するサービスメソッド
+// 操作ごとに PostSingerService・PutSingerService・DeleteSingerService を呼び出すので、入力値の検証や名前の重複の確認は個別の操作と同じ
+func (s *singerService) BatchSingerService(ctx context.Context, ops []*BatchOperation[model.Singer], atomic bool) ([]*BatchResult[model.Singer], error) {
+	return runBatch(ctx, s.transactor, ops, atomic, func(ctx context.Context, op *BatchOperation[model.Singer]) (int, *model.Singer, error) {
+		switch op.Op {
+		case BatchCreate:
+			singer := *op.Value
+			err := s.PostSingerService(ctx, &singer)
+			return int(singer.ID), &singer, err
+		case BatchUpdate:
+			singer := *op.Value
+			singer.ID, singer.Version = model.SingerID(op.ID), op.Version
+			err := s.PutSingerService(ctx, &singer)
+			return op.ID, &singer, err
+		case BatchDelete:
+			return op.ID, nil, s.DeleteSingerService(ctx, model.SingerID(op.ID), op.Version)
+		}
+		return op.ID, nil, unknownBatchOp(op.Op)
+	})
+}
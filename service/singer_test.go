@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/infra/memorydb"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/service"
+)
+
+func TestDeleteSingerServicePolicies(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		policy      service.SingerDeletePolicy
+		wantErr     error
+		albumsAlive bool // 歌手 1 のアルバム（1 と 2）が残るか
+	}{
+		{"restrict", service.SingerDeleteRestrict, apperror.ErrConflict, true},
+		{"cascade", service.SingerDeleteCascade, nil, false},
+		{"orphan", service.SingerDeleteOrphan, nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			singerRepo, albumRepo := memorydb.NewSingerRepository(), memorydb.NewAlbumRepository()
+			singers := service.NewSingerService(singerRepo, albumRepo, memorydb.NewTransactor(singerRepo, albumRepo), tc.policy)
+
+			err := singers.DeleteSingerService(ctx, 1, 0)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("DeleteSingerService: got %v, want %v", err, tc.wantErr)
+			}
+			// restrict で失敗した場合は、歌手をゴミ箱に移動したこともバージョンを上げたことも取り消す
+			alice, err := singerRepo.Get(ctx, 1)
+			if tc.wantErr != nil && (err != nil || alice.Version != 1) {
+				t.Fatalf("singer after a failed delete: got %+v, %v", alice, err)
+			}
+			if tc.wantErr == nil && !errors.Is(err, apperror.ErrNotFound) {
+				t.Fatalf("singer after delete: got %v, want ErrNotFound", err)
+			}
+			for _, id := range []model.AlbumID{1, 2} {
+				if _, err := albumRepo.Get(ctx, id); (err == nil) != tc.albumsAlive {
+					t.Fatalf("album %d: got %v, alive=%v", id, err, tc.albumsAlive)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteSingerServiceChecksVersionFirst(t *testing.T) {
+	ctx := context.Background()
+	s := newServices()
+	if err := s.singers.DeleteSingerService(ctx, 1, 2); !errors.Is(err, apperror.ErrPrecondition) {
+		t.Fatalf("stale version: got %v, want ErrPrecondition", err)
+	}
+	if err := s.singers.DeleteSingerService(ctx, 99, 0); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("missing singer: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestPostAlbumServiceRejectsTrashedSinger(t *testing.T) {
+	ctx := context.Background()
+	s := newServices()
+	if err := s.singers.DeleteSingerService(ctx, 5, 0); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.albums.PostAlbumService(ctx, &model.Album{Title: "Ellen's 1st Album", SingerID: 5})
+	if !errors.Is(err, apperror.ErrValidation) {
+		t.Fatalf("album for a trashed singer: got %v, want ErrValidation", err)
+	}
+}
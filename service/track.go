@@ -0,0 +1,146 @@
+// 曲（Track）に関するサービスを提供するためのファイル
+
+package service
+
+import (
+	"context"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+	"server-recruit-challenge-sample/repository"
+)
+
+// TrackService は曲（Track）に関するサービスを提供するためのインターフェース
+// 曲はアルバムのサブリソースなので、すべてのメソッドはアルバムIDを受け取り、アルバムが存在しない（ゴミ箱に入っている）場合は apperror.ErrNotFound を返す
+type TrackService interface {
+	GetTrackListService(ctx context.Context, albumID model.AlbumID) ([]*model.Track, error)                                                                           // アルバムの曲を曲順に取得する
+	GetTrackService(ctx context.Context, albumID model.AlbumID, trackID model.TrackID) (*model.Track, error)                                                          // 取得する
+	PostTrackService(ctx context.Context, track *model.Track) error                                                                                                   // 追加する（track.AlbumID のアルバムに追加する）
+	PutTrackService(ctx context.Context, track *model.Track) error                                                                                                    // 置き換える（track.Version が 0 以外の場合は現在のバージョンと一致するときだけ置き換える）
+	PatchTrackService(ctx context.Context, albumID model.AlbumID, trackID model.TrackID, version model.Version, apply func(*model.Track) error) (*model.Track, error) // 部分的に更新する（version が 0 以外の場合は現在のバージョンと一致するときだけ更新する）
+	DeleteTrackService(ctx context.Context, albumID model.AlbumID, trackID model.TrackID, version model.Version) error                                                // 削除する（version が 0 以外の場合は現在のバージョンと一致するときだけ削除する）
+}
+
+// 曲（Track）に関するサービスを提供するための構造体
+type trackService struct {
+	trackRepository repository.TrackRepository
+	// 曲が属するアルバムの存在を確認するための repository/album.go ファイルの AlbumRepository インターフェース
+	albumRepository repository.AlbumRepository
+	// アルバムの存在確認と曲の書き込みをまとめて実行するための repository/tx.go ファイルの Transactor インターフェース
+	transactor repository.Transactor
+}
+
+// 構造体 trackService が TrackService インターフェースを実装していることをコンパイラに伝える
+var _ TrackService = (*trackService)(nil)
+
+// NewTrackService は曲（Track）に関するサービスを提供するための構造体を生成する
+func NewTrackService(trackRepository repository.TrackRepository, albumRepository repository.AlbumRepository, transactor repository.Transactor) *trackService {
+	return &trackService{trackRepository: trackRepository, albumRepository: albumRepository, transactor: transactor}
+}
+
+// 指定されたアルバムの曲（Track）を曲順に取得するサービスメソッド
+func (s *trackService) GetTrackListService(ctx context.Context, albumID model.AlbumID) ([]*model.Track, error) {
+	if _, err := s.albumRepository.Get(ctx, albumID); err != nil { // repository/album.go ファイルの Get メソッドを呼び出す
+		return nil, err
+	}
+	tracks, err := s.trackRepository.ListByAlbum(ctx, albumID) // repository/track.go ファイルの ListByAlbum メソッドを呼び出す
+	if err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// 指定されたアルバムの曲（Track）を取得するサービスメソッド
+func (s *trackService) GetTrackService(ctx context.Context, albumID model.AlbumID, trackID model.TrackID) (*model.Track, error) {
+	return s.getTrackInAlbum(ctx, albumID, trackID)
+}
+
+// 新しい曲（Track）をアルバムに追加するサービスメソッド
+// アルバムの存在確認と追加は 1 つのトランザクションで行うので、確認した後にアルバムが削除されることはない
+func (s *trackService) PostTrackService(ctx context.Context, track *model.Track) error {
+	if err := validateTrack(track); err != nil { // 入力値を検証し、違反している項目をまとめて返す
+		return err
+	}
+
+	return s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		if _, err := s.albumRepository.Get(ctx, track.AlbumID); err != nil { // repository/album.go ファイルの Get メソッドを呼び出す
+			return err
+		}
+		return s.trackRepository.Add(ctx, track) // repository/track.go ファイルの Add メソッドを呼び出す
+	})
+}
+
+// 曲（Track）を置き換えるサービスメソッド
+func (s *trackService) PutTrackService(ctx context.Context, track *model.Track) error {
+	if err := validateTrack(track); err != nil { // 入力値を検証し、違反している項目をまとめて返す
+		return err
+	}
+
+	return s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		if _, err := s.getTrackInAlbum(ctx, track.AlbumID, track.ID); err != nil {
+			return err
+		}
+		return s.trackRepository.Update(ctx, track) // repository/track.go ファイルの Update メソッドを呼び出す
+	})
+}
+
+// 指定されたアルバムの曲（Track）を部分的に更新するサービスメソッド
+// apply には現在の曲のコピーが渡されるので、変更したい項目だけを書き換える（ID とアルバムIDは変更できない）
+func (s *trackService) PatchTrackService(ctx context.Context, albumID model.AlbumID, trackID model.TrackID, version model.Version, apply func(*model.Track) error) (*model.Track, error) {
+	var track model.Track
+	err := s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		current, err := s.getTrackInAlbum(ctx, albumID, trackID)
+		if err != nil {
+			return err
+		}
+		if version != 0 && version != current.Version {
+			return apperror.Precondition(apperror.CodeVersionMismatch, "track %d has version %d, not %d", trackID, current.Version, version)
+		}
+
+		track = *current
+		if err := apply(&track); err != nil {
+			return err
+		}
+		track.Version = current.Version // バージョンはパッチで変更できない
+		if track.ID != trackID {
+			return apperror.Validation(apperror.CodeImmutableField, "id cannot be changed")
+		}
+		if track.AlbumID != albumID {
+			return apperror.Validation(apperror.CodeImmutableField, "album_id cannot be changed")
+		}
+		if err := validateTrack(&track); err != nil { // パッチを適用した結果を検証する
+			return err
+		}
+		return s.trackRepository.Update(ctx, &track) // repository/track.go ファイルの Update メソッドを呼び出す
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &track, nil
+}
+
+// 指定されたアルバムの曲（Track）を削除するサービスメソッド
+func (s *trackService) DeleteTrackService(ctx context.Context, albumID model.AlbumID, trackID model.TrackID, version model.Version) error {
+	return s.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		if _, err := s.getTrackInAlbum(ctx, albumID, trackID); err != nil {
+			return err
+		}
+		return s.trackRepository.Delete(ctx, trackID, version) // repository/track.go ファイルの Delete メソッドを呼び出す
+	})
+}
+
+// getTrackInAlbum はアルバムが存在し、曲がそのアルバムに属していることを確認して曲を返す
+// ほかのアルバムの曲を指定した場合も、曲が存在しない場合と同じく apperror.ErrNotFound を返す
+func (s *trackService) getTrackInAlbum(ctx context.Context, albumID model.AlbumID, trackID model.TrackID) (*model.Track, error) {
+	if _, err := s.albumRepository.Get(ctx, albumID); err != nil { // repository/album.go ファイルの Get メソッドを呼び出す
+		return nil, err
+	}
+	track, err := s.trackRepository.Get(ctx, trackID) // repository/track.go ファイルの Get メソッドを呼び出す
+	if err != nil {
+		return nil, err
+	}
+	if track.AlbumID != albumID {
+		return nil, apperror.NotFound(apperror.CodeTrackNotFound, "track %d not found in album %d", trackID, albumID)
+	}
+	return track, nil
+}
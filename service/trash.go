@@ -0,0 +1,119 @@
+// ゴミ箱に移動した歌手とアルバムを保存期間が過ぎた後に完全に削除するためのファイル
+
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"server-recruit-challenge-sample/repository"
+)
+
+// TrashPurger はゴミ箱に移動してから retention 以上経過した歌手とアルバムを定期的に完全に削除する
+type TrashPurger interface {
+	PurgeTrashService(ctx context.Context, now time.Time) (singers, albums int, err error) // now より retention 以上前にゴミ箱に移動したものを完全に削除する
+	Run(ctx context.Context, interval time.Duration)                                       // ctx が終了するまで interval ごとに PurgeTrashService を実行する
+}
+
+// ゴミ箱の歌手とアルバムを完全に削除するための構造体
+type trashPurger struct {
+	singerRepository repository.SingerRepository
+	albumRepository  repository.AlbumRepository
+	trackRepository  repository.TrackRepository
+	transactor       repository.Transactor
+	retention        time.Duration // ゴミ箱に残しておく期間
+}
+
+// 構造体 trashPurger が TrashPurger インターフェースを実装していることをコンパイラに伝える
+var _ TrashPurger = (*trashPurger)(nil)
+
+// NewTrashPurger はゴミ箱の歌手とアルバムを完全に削除するための構造体を生成する
+func NewTrashPurger(singerRepository repository.SingerRepository, albumRepository repository.AlbumRepository, trackRepository repository.TrackRepository, transactor repository.Transactor, retention time.Duration) *trashPurger {
+	return &trashPurger{
+		singerRepository: singerRepository,
+		albumRepository:  albumRepository,
+		trackRepository:  trackRepository,
+		transactor:       transactor,
+		retention:        retention,
+	}
+}
+
+// PurgeTrashService は保存期間が過ぎた歌手とアルバムを 1 つのトランザクションで完全に削除し、削除した件数を返す
+// 歌手より先にアルバムを、アルバムより先にその曲を削除する。残るアルバムからは、歌手を削除する前にその歌手を外す
+func (p *trashPurger) PurgeTrashService(ctx context.Context, now time.Time) (singers, albums int, err error) {
+	deletedBefore := now.Add(-p.retention)
+	err = p.transactor.RunInTx(ctx, func(ctx context.Context) error { // repository/tx.go ファイルの RunInTx メソッドを呼び出す
+		if err := p.purgeTracks(ctx, deletedBefore); err != nil {
+			return err
+		}
+		var err error
+		if albums, err = p.albumRepository.Purge(ctx, deletedBefore); err != nil { // repository/album.go ファイルの Purge メソッドを呼び出す
+			return err
+		}
+		if err := p.unlinkSingers(ctx, deletedBefore); err != nil {
+			return err
+		}
+		singers, err = p.singerRepository.Purge(ctx, deletedBefore) // repository/singer.go ファイルの Purge メソッドを呼び出す
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return singers, albums, nil
+}
+
+// purgeTracks は完全に削除するアルバムの曲を削除する
+func (p *trashPurger) purgeTracks(ctx context.Context, deletedBefore time.Time) error {
+	albums, err := p.albumRepository.List(ctx, repository.AlbumQuery{IncludeDeleted: true}) // repository/album.go ファイルの List メソッドを呼び出す（件数を指定しないので全件）
+	if err != nil {
+		return err
+	}
+	for _, album := range albums.Items {
+		if album.DeletedAt == nil || !album.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+		if _, err := p.trackRepository.DeleteByAlbum(ctx, album.ID); err != nil { // repository/track.go ファイルの DeleteByAlbum メソッドを呼び出す
+			return err
+		}
+	}
+	return nil
+}
+
+// unlinkSingers は完全に削除する歌手を、残るアルバム（ゴミ箱のアルバムも含む）の歌手IDから外す
+func (p *trashPurger) unlinkSingers(ctx context.Context, deletedBefore time.Time) error {
+	singers, err := p.singerRepository.List(ctx, repository.SingerQuery{IncludeDeleted: true}) // repository/singer.go ファイルの List メソッドを呼び出す（件数を指定しないので全件）
+	if err != nil {
+		return err
+	}
+	for _, singer := range singers.Items {
+		if singer.DeletedAt == nil || !singer.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+		if _, err := p.albumRepository.UnlinkSinger(ctx, singer.ID); err != nil { // repository/album.go ファイルの UnlinkSinger メソッドを呼び出す
+			return err
+		}
+	}
+	return nil
+}
+
+// Run は ctx が終了するまで interval ごとに PurgeTrashService を実行する。失敗してもログに出力して次の実行を待つ
+func (p *trashPurger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			singers, albums, err := p.PurgeTrashService(ctx, now)
+			if err != nil {
+				slog.ErrorContext(ctx, "purge trash failed", "error", err.Error())
+				continue
+			}
+			if singers > 0 || albums > 0 {
+				slog.InfoContext(ctx, "purged trash", "singers", singers, "albums", albums)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// サービス層で行う入力値の検証を定義するためのファイル
+
+package service // このファイルが service パッケージであることを示す
+
+import (
+	"strings"
+
+	"server-recruit-challenge-sample/apperror"
+	"server-recruit-challenge-sample/model"
+)
+
+// errEmptyBody はリクエストボディが null などで値がない場合のエラー
+func errEmptyBody() error {
+	return apperror.ValidationFailed([]apperror.Violation{{Field: "", Message: "body must be a JSON object"}})
+}
+
+// validateSinger は歌手の名前・読み・ローマ字表記の前後の空白を取り除いてから、model.Singer の検証ルールをすべて確認する
+func validateSinger(singer *model.Singer) error {
+	if singer == nil {
+		return errEmptyBody()
+	}
+	singer.Name = strings.TrimSpace(singer.Name)
+	singer.NameKana = strings.TrimSpace(singer.NameKana)
+	singer.NameRomaji = strings.TrimSpace(singer.NameRomaji)
+	return model.Validate(singer)
+}
+
+// validateAlbum はアルバムのタイトルの前後の空白を取り除き、クレジットを整えてから、model.Album の検証ルールをすべて確認する
+func validateAlbum(album *model.Album) error {
+	if album == nil {
+		return errEmptyBody()
+	}
+	album.Title = strings.TrimSpace(album.Title)
+	for i, genre := range album.Genres {
+		album.Genres[i] = strings.TrimSpace(genre)
+	}
+	normalizeCredits(album)
+	return model.Validate(album)
+}
+
+// normalizeCredits はアルバムのクレジットと SingerID の省略された方をもう一方から補う
+// クレジットを省略した場合は SingerID の歌手だけを primary とし、singer_id を省略した場合は最初の primary の歌手を SingerID にする
+// 両方を指定して SingerID の歌手が primary としてクレジットされていない場合は、検証ルールで報告する
+func normalizeCredits(album *model.Album) {
+	if len(album.Credits) == 0 {
+		if album.SingerID != 0 {
+			album.Credits = []model.Credit{{SingerID: album.SingerID, Role: model.CreditPrimary}}
+		}
+		return
+	}
+	if album.SingerID == 0 {
+		for _, c := range album.Credits {
+			if c.Role == model.CreditPrimary {
+				album.SingerID = c.SingerID
+				return
+			}
+		}
+	}
+}
+
+// validateTrack は曲のタイトルの前後の空白を取り除いてから、model.Track の検証ルールをすべて確認する
+func validateTrack(track *model.Track) error {
+	if track == nil {
+		return errEmptyBody()
+	}
+	track.Title = strings.TrimSpace(track.Title)
+	return model.Validate(track)
+}